@@ -0,0 +1,198 @@
+// Command multiboard runs one-shot operations without the server and queue.
+//
+//	multiboard export --database staging [--out FILE|-] [flags]
+//
+// The export dump goes to stdout when --out is "-" or not given, so it can
+// be piped into psql or gzip; all logging goes to stderr.
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/config"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+)
+
+func main() {
+	_ = godotenv.Load()
+	// zerolog's global logger writes to stderr, which keeps stdout free
+	// for the dump.
+	zerolog.TimeFieldFormat = time.RFC3339
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(ctx, os.Args[2:])
+	case "-h", "--help", "help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg(os.Args[1] + " failed")
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: multiboard export --database NAME [--out FILE|-] [flags]")
+}
+
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var (
+		db          = fs.String("database", "", "database to export (production, staging, dev or localhost)")
+		out         = fs.String("out", "-", `file to write the dump to; "-" writes to stdout`)
+		schema      = fs.String("schema", "", "source schema (default public)")
+		include     = fs.String("include", "", "comma-separated tables to export instead of the default set")
+		exclude     = fs.String("exclude", "", "comma-separated tables to leave out")
+		sampleRows  = fs.Int("sample-rows", 0, "export at most this many rows per table")
+		parallelism = fs.Int("parallelism", 0, "tables streamed at once (default EXPORT_PARALLELISM)")
+		compress    = fs.Bool("compress", false, "gzip the dump")
+		extensions  = fs.Bool("extensions", false, "emit CREATE EXTENSION for extensions the tables use")
+		orderRows   = fs.Bool("order-rows", false, "order rows by primary key for reproducible dumps")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	name := strings.ToLower(strings.TrimSpace(*db))
+	if name == "" {
+		fs.Usage()
+		return fmt.Errorf("--database is required")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if level, err := zerolog.ParseLevel(cfg.LogLevel); err == nil {
+		zerolog.SetGlobalLevel(level)
+	}
+	opts := export.ExportOptions{
+		Schema:            *schema,
+		Include:           splitList(*include),
+		Exclude:           splitList(*exclude),
+		SampleRows:        *sampleRows,
+		Parallelism:       *parallelism,
+		IncludeExtensions: *extensions,
+		OrderRows:         *orderRows,
+	}
+	if opts.Parallelism == 0 {
+		opts.Parallelism = cfg.ExportParallelism
+	}
+	if cfg.MaskingConfigFile != "" {
+		if opts.Masking, err = export.LoadMaskingRules(cfg.MaskingConfigFile); err != nil {
+			return fmt.Errorf("masking config: %w", err)
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	mgr, err := database.NewManager(ctx, database.LoadURLs(), database.PingPolicy{
+		Attempts: cfg.DBPingAttempts,
+		Backoff:  cfg.DBPingBackoff,
+	})
+	if err != nil {
+		return err
+	}
+	defer mgr.Close()
+	exporter := export.New(mgr)
+	exporter.SetDenyTables(cfg.ExportDenyTables)
+
+	var (
+		w      io.Writer = os.Stdout
+		file   *os.File
+		target = "stdout"
+	)
+	if *out != "-" {
+		target = *out
+		if file, err = os.Create(export.TempPath(*out)); err != nil {
+			return err
+		}
+		defer func() {
+			file.Close()
+			os.Remove(file.Name())
+		}()
+		w = file
+	}
+	var gz *gzip.Writer
+	if *compress {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+
+	lastTable := ""
+	manifest, err := exporter.Export(ctx, name, w, opts, func(p export.Progress) {
+		if p.TableName != lastTable {
+			log.Info().Str("table", p.TableName).Msgf("exporting table %d/%d", p.TableIndex, p.TotalTables)
+			lastTable = p.TableName
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("export %s: %w", name, err)
+	}
+	for _, t := range manifest.Skipped {
+		log.Warn().Str("table", t.Name).Msg("skipped data: " + t.Error)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("write %s: %w", target, err)
+		}
+	}
+	if file != nil {
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("write %s: %w", target, err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("write %s: %w", target, err)
+		}
+		if err := os.Rename(file.Name(), *out); err != nil {
+			return err
+		}
+		if err := export.SyncDir(filepath.Dir(*out)); err != nil {
+			return err
+		}
+	}
+	log.Info().Str("database", name).Str("out", target).Int64("rows", manifest.TotalRows()).Msg("export complete")
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"strings"
 	"syscall"
 	"time"
 
@@ -12,8 +14,10 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/koilabcode/multiboard-sync-service/internal/audit"
 	"github.com/koilabcode/multiboard-sync-service/internal/config"
 	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
 	"github.com/koilabcode/multiboard-sync-service/internal/handlers"
 	"github.com/koilabcode/multiboard-sync-service/internal/models"
 	"github.com/koilabcode/multiboard-sync-service/internal/queue"
@@ -23,7 +27,10 @@ func main() {
 	_ = godotenv.Load()
 
 	zerolog.TimeFieldFormat = time.RFC3339
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid configuration")
+	}
 
 	level, err := zerolog.ParseLevel(cfg.LogLevel)
 	if err != nil {
@@ -34,71 +41,191 @@ func main() {
 	log.Info().Msgf("Server starting on port %s", cfg.Port)
 
 	urls := database.LoadURLs()
-	mgr, err := database.NewManager(context.Background(), urls)
+	mgr, err := database.NewManager(context.Background(), urls, database.PingPolicy{
+		Attempts: cfg.DBPingAttempts,
+		Backoff:  cfg.DBPingBackoff,
+	})
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to initialize database manager")
 	}
+	if cfg.DBWarmup {
+		for name, err := range mgr.Warmup(context.Background()) {
+			if err != nil {
+				log.Warn().Err(err).Str("database", name).Msg("database warm-up failed; will retry on first use")
+				continue
+			}
+			log.Info().Str("database", name).Msg("database pool ready")
+		}
+	}
 
 	jobs := models.NewJobStore()
-	client, err := queue.NewClient(cfg.RedisURL)
+	auditLog, err := newAuditLogger(cfg, mgr)
+	if err != nil {
+		log.Fatal().Err(err).Msg("audit log error")
+	}
+	if auditLog != nil {
+		jobs.OnTransition(auditLog.JobTransition)
+	}
+	client, err := queue.NewClient(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("asynq client error")
 	}
-	worker, err := queue.NewWorker(cfg.RedisURL, jobs, mgr)
+	worker, err := queue.NewWorker(cfg, jobs, mgr)
 	if err != nil {
 		log.Fatal().Err(err).Msg("asynq worker error")
 	}
 	_ = worker.Start
+	scheduler, err := queue.NewScheduler(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("scheduler error")
+	}
+
+	maintenance := handlers.NewMaintenance(cfg.MaintenanceMode)
+	if cfg.MaintenanceMode {
+		log.Warn().Msg("starting in maintenance mode; new sync jobs are refused")
+	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/health", handlers.Health)
+	hh := &handlers.HealthHandler{
+		Maintenance:      maintenance,
+		WorkerHeartbeat:  worker.LastHeartbeat,
+		HeartbeatTimeout: cfg.HeartbeatTimeout,
+	}
+	mux.HandleFunc("/health", hh.Health)
+	if err := handlers.ValidateOpenAPI(); err != nil {
+		log.Fatal().Err(err).Msg("openapi spec error")
+	}
+	mux.HandleFunc("/api/openapi.json", handlers.OpenAPI)
 
 	dbh := handlers.DatabasesHandler{Manager: mgr}
 	mux.HandleFunc("/api/databases", dbh.List)
 	mux.HandleFunc("/api/databases/test", dbh.Test)
 
-	eh := &handlers.ExportHandler{Jobs: jobs, Client: client}
-	mux.HandleFunc("/api/sync/export", func(w http.ResponseWriter, r *http.Request) {
+	var masking export.MaskingRules
+	if cfg.MaskingConfigFile != "" {
+		if masking, err = export.LoadMaskingRules(cfg.MaskingConfigFile); err != nil {
+			log.Fatal().Err(err).Msg("masking config error")
+		}
+	}
+	streamExporter := export.New(mgr)
+	streamExporter.SetDenyTables(cfg.ExportDenyTables)
+	seh := &handlers.StreamExportHandler{
+		Exporter:        streamExporter,
+		Masking:         masking,
+		Timeout:         cfg.StreamExportTimeout,
+		MaxRows:         cfg.StreamExportMaxRows,
+		MaxBytes:        cfg.StreamExportMaxBytes,
+		TimestampFormat: cfg.DumpTimestampFormat,
+	}
+	streamExport := handlers.RequireAPIKey(cfg.AdminAPIKey, seh.Export)
+	mux.HandleFunc("/api/databases/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/export.sql") {
+			streamExport(w, r)
+			return
+		}
+		handlers.NotFound(w, r)
+	})
+
+	eh := &handlers.ExportHandler{Jobs: jobs, Client: client, JobTimeout: cfg.JobTimeout}
+	mux.HandleFunc("/api/sync/export", maintenance.Guard(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			handlers.MethodNotAllowed(w, r)
 			return
 		}
 		eh.StartExport(w, r)
-	})
+	}))
 
-	ih := &handlers.ImportHandler{Jobs: jobs, Client: client}
-	mux.HandleFunc("/api/sync/import", func(w http.ResponseWriter, r *http.Request) {
+	ih := &handlers.ImportHandler{Jobs: jobs, Client: client, JobTimeout: cfg.JobTimeout, AllowSwapImport: cfg.AllowSwapImport, TimestampFormat: cfg.DumpTimestampFormat, DumpFilename: cfg.DumpFilename}
+	mux.HandleFunc("/api/sync/import", maintenance.Guard(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			handlers.MethodNotAllowed(w, r)
 			return
 		}
 		ih.StartImport(w, r)
-	})
+	}))
+	mux.HandleFunc("/api/sync/import/bundle", maintenance.Guard(ih.StartBundle))
+	mux.HandleFunc("/api/sync/restore", maintenance.Guard(ih.Restore))
 
+	th := &handlers.TableSyncHandler{Jobs: jobs, Client: client, JobTimeout: cfg.JobTimeout, Manager: mgr}
+	mux.HandleFunc("/api/sync/table", maintenance.Guard(th.StartTableSync))
+
+	vh := &handlers.VerifyHandler{Jobs: jobs, Client: client, JobTimeout: cfg.JobTimeout}
+	mux.HandleFunc("/api/sync/verify", maintenance.Guard(vh.StartVerify))
+
+	inspector, err := queue.NewInspector(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("asynq inspector error")
+	}
+	ah := &handlers.AdminHandler{Manager: mgr, LoadURLs: reloadURLs, Inspector: inspector, Jobs: jobs}
+	terminateJobQueries := handlers.RequireAPIKey(cfg.AdminAPIKey, ah.TerminateJobQueries)
+	rh := &handlers.RetryHandler{Jobs: jobs, Client: client, JobTimeout: cfg.JobTimeout}
+	retry := maintenance.Guard(rh.Retry)
 	mux.HandleFunc("/api/jobs", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			handlers.MethodNotAllowed(w, r)
 			return
 		}
 		eh.ListJobs(w, r)
 	})
 	mux.HandleFunc("/api/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/terminate-db") {
+			terminateJobQueries(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/retry") {
+			retry(w, r)
+			return
+		}
 		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			handlers.MethodNotAllowed(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/logs") {
+			eh.GetJobLogs(w, r)
 			return
 		}
 		eh.GetJob(w, r)
 	})
 
-	fs := http.FileServer(http.Dir("cmd/server/static"))
-	mux.Handle("/", fs)
+	dh := &handlers.DumpsHandler{Dir: "dumps"}
+	mux.HandleFunc("/api/dumps", dh.List)
+	mux.HandleFunc("/api/dumps/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/info") {
+			dh.Info(w, r)
+			return
+		}
+		dh.Download(w, r)
+	})
+
+	sh := &handlers.SchedulesHandler{Scheduler: scheduler}
+	mux.HandleFunc("/api/schedules", sh.List)
+	mux.HandleFunc("/api/schedules/", sh.Toggle)
+
+	mux.HandleFunc("/api/admin/reload", handlers.RequireAPIKey(cfg.AdminAPIKey, ah.Reload))
+	mux.HandleFunc("/api/admin/queue/purge", handlers.RequireAPIKey(cfg.AdminAPIKey, ah.PurgeQueue))
+	mux.HandleFunc("/api/admin/maintenance", handlers.RequireAPIKey(cfg.AdminAPIKey, maintenance.Toggle))
+
+	ch := &handlers.ConfigHandler{Config: cfg, Manager: mgr, DumpsDir: dh.Dir}
+	mux.HandleFunc("/api/config", handlers.RequireAPIKey(cfg.AdminAPIKey, ch.Get))
+
+	if cfg.EnablePprof {
+		handlers.RegisterDebug(mux, func(next http.HandlerFunc) http.HandlerFunc {
+			return handlers.RequireAPIKey(cfg.AdminAPIKey, next)
+		})
+		log.Info().Msg("pprof and /debug/vars enabled")
+	}
+
+	mux.Handle("/", handlers.StaticFiles("cmd/server/static"))
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
-		Handler: loggingMiddleware(mux),
+		Handler: loggingMiddleware(recoveryMiddleware(mux)),
 	}
 
 	worker.Start()
+	if err := scheduler.Start(); err != nil {
+		log.Fatal().Err(err).Msg("scheduler start error")
+	}
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -115,17 +242,73 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	mgr.Close()
+	scheduler.Shutdown()
 	worker.Shutdown()
 	if err := client.Close(); err != nil {
 		log.Error().Err(err).Msg("Redis close error")
 	}
+	_ = inspector.Close()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Error().Err(err).Msg("graceful shutdown failed")
 	} else {
 		log.Info().Msg("server stopped gracefully")
 	}
+	if auditLog != nil {
+		if err := auditLog.Close(); err != nil {
+			log.Error().Err(err).Msg("audit log close error")
+		}
+	}
+	// Last, once the jobs, requests and audit log using the pools are done.
+	mgr.Close()
+}
+
+// newAuditLogger returns the configured job audit log, or nil if none is.
+func newAuditLogger(cfg config.Config, mgr *database.Manager) (*audit.Logger, error) {
+	switch {
+	case cfg.AuditLogFile != "":
+		sink, err := audit.NewFileSink(cfg.AuditLogFile, cfg.AuditLogMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		return audit.New(sink), nil
+	case cfg.AuditLogTable != "":
+		return audit.New(audit.NewPostgresSink(mgr, cfg.AuditLogTable)), nil
+	}
+	return nil, nil
+}
+
+// reloadURLs re-reads .env over the current environment so edited database
+// URLs take effect, then loads them the same way as at startup.
+func reloadURLs() database.URLs {
+	if err := godotenv.Overload(); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Msg("reload .env")
+	}
+	return database.LoadURLs()
+}
+
+// recoveryMiddleware answers 500 when a handler panics and logs the panic
+// with its stack. http.ErrAbortHandler is re-raised so net/http still
+// aborts the response as intended.
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			log.Error().
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Str("stack", string(debug.Stack())).
+				Msgf("panic in handler: %v", v)
+			handlers.InternalError(w, r)
+		}()
+		next.ServeHTTP(w, r)
+	})
 }
 
 func loggingMiddleware(next http.Handler) http.Handler {
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++
+	})
+	mux.HandleFunc("/abort", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	srv := httptest.NewServer(loggingMiddleware(recoveryMiddleware(mux)))
+	defer srv.Close()
+
+	tests := []struct {
+		path    string
+		want    int
+		wantErr bool
+	}{
+		{path: "/ok", want: http.StatusOK},
+		{path: "/panic", want: http.StatusInternalServerError},
+		{path: "/abort", wantErr: true},
+		// The server is still up after both panics.
+		{path: "/ok", want: http.StatusOK},
+		{path: "/panic", want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + tt.path)
+		if tt.wantErr {
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("GET %s answered %d, want the response aborted", tt.path, resp.StatusCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
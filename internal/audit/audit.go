@@ -0,0 +1,112 @@
+// Package audit keeps an append-only record of job lifecycle events outside
+// the process, for when the in-memory job store and logs are not enough.
+package audit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+)
+
+// Event names beyond the job statuses they mirror.
+const (
+	EventCreated = "created"
+	EventStarted = "started"
+)
+
+type Event struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	JobID     string    `json:"jobId"`
+	Database  string    `json:"database,omitempty"`
+	Trigger   string    `json:"trigger,omitempty"`
+	Principal string    `json:"principal,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Sink stores events. Write is only ever called from one goroutine.
+type Sink interface {
+	Write(ctx context.Context, e Event) error
+	Close() error
+}
+
+// queueSize bounds the events waiting for a slow sink; beyond it events are
+// dropped (and logged) rather than stalling job handling.
+const queueSize = 1024
+
+// Logger records events to a Sink in the background.
+type Logger struct {
+	sink   Sink
+	events chan Event
+	done   chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func New(sink Sink) *Logger {
+	l := &Logger{sink: sink, events: make(chan Event, queueSize), done: make(chan struct{})}
+	go l.run()
+	return l
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+	for e := range l.events {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := l.sink.Write(ctx, e); err != nil {
+			log.Printf("audit: failed to record %s for job %s: %v", e.Event, e.JobID, err)
+		}
+		cancel()
+	}
+}
+
+func (l *Logger) Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		log.Printf("audit: logger closed, dropped %s for job %s", e.Event, e.JobID)
+		return
+	}
+	select {
+	case l.events <- e:
+	default:
+		log.Printf("audit: queue full, dropped %s for job %s", e.Event, e.JobID)
+	}
+}
+
+// JobTransition is a models.TransitionFunc that records the transition.
+func (l *Logger) JobTransition(j models.Job, from models.JobStatus) {
+	e := Event{
+		Event:     string(j.Status),
+		JobID:     j.ID,
+		Database:  j.Database,
+		Trigger:   j.Trigger,
+		Principal: j.RequestedBy,
+		Error:     j.Error,
+	}
+	switch {
+	case from == "":
+		e.Event = EventCreated
+	case j.Status == models.StatusRunning:
+		e.Event = EventStarted
+	}
+	l.Record(e)
+}
+
+// Close records what is queued and closes the sink. Later events are
+// dropped.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	close(l.events)
+	l.mu.Unlock()
+	<-l.done
+	return l.sink.Close()
+}
@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+)
+
+// PostgresDatabase is the only database PostgresSink writes to.
+const PostgresDatabase = "localhost"
+
+// PostgresSink inserts events into a table on the localhost database,
+// creating it on first use.
+type PostgresSink struct {
+	mgr     *database.Manager
+	table   string
+	created bool
+}
+
+// NewPostgresSink writes to table, which may be schema-qualified
+// ("audit.job_events").
+func NewPostgresSink(mgr *database.Manager, table string) *PostgresSink {
+	return &PostgresSink{mgr: mgr, table: pgx.Identifier(strings.Split(table, ".")).Sanitize()}
+}
+
+func (s *PostgresSink) Write(ctx context.Context, e Event) error {
+	pool, err := s.mgr.Pool(ctx, PostgresDatabase)
+	if err != nil {
+		return err
+	}
+	if !s.created {
+		q := fmt.Sprintf(`create table if not exists %s (
+  id bigserial primary key,
+  time timestamptz not null,
+  event text not null,
+  job_id text not null,
+  database text,
+  trigger text,
+  principal text,
+  error text
+)`, s.table)
+		if _, err := pool.Exec(ctx, q); err != nil {
+			return fmt.Errorf("create %s: %w", s.table, err)
+		}
+		s.created = true
+	}
+	q := fmt.Sprintf(`insert into %s (time, event, job_id, database, trigger, principal, error) values ($1, $2, $3, $4, $5, $6, $7)`, s.table)
+	_, err = pool.Exec(ctx, q, e.Time, e.Event, e.JobID, e.Database, e.Trigger, e.Principal, e.Error)
+	return err
+}
+
+func (s *PostgresSink) Close() error { return nil }
@@ -4,12 +4,146 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	Port     string
 	LogLevel string
 	RedisURL string
+
+	RedisTLS      bool
+	RedisPassword string
+	RedisDB       int
+
+	JobTimeout        time.Duration
+	StallTimeout      time.Duration
+	HeartbeatTimeout  time.Duration
+	StatementTimeout  time.Duration
+	ExportParallelism int
+	ImportParallelism int
+	MaskingConfigFile string
+	ExportSchedules   string
+	AllowSwapImport   bool
+	AutoCreateTarget  bool
+	AdminAPIKey       string
+	EnablePprof       bool
+	MaintenanceMode   bool
+	ProgressChannel   string
+	Hooks             Hooks
+	DBPingAttempts    int
+	DBPingBackoff     time.Duration
+	DBWarmup          bool
+	MaxInflightJobs   int
+	// DumpFilenameTemplate names export dumps; DumpFilename is its parsed
+	// form.
+	DumpFilenameTemplate string
+	DumpFilename         *FilenameTemplate
+	// DumpTimestampFormat is the UTC time layout of {{.Timestamp}}.
+	DumpTimestampFormat string
+	// Limits for GET /api/databases/{name}/export.sql.
+	StreamExportTimeout  time.Duration
+	StreamExportMaxRows  int64
+	StreamExportMaxBytes int64
+	// Job lifecycle audit log: a JSON-lines file rotated at AuditLogMaxBytes,
+	// or a table on the localhost database. At most one is set.
+	AuditLogFile     string
+	AuditLogMaxBytes int64
+	AuditLogTable    string
+	// ExportDenyTables are never exported, whatever a request includes.
+	ExportDenyTables []string
+}
+
+// Hooks are paths to SQL scripts run around imports and exports. Empty paths
+// are skipped.
+type Hooks struct {
+	PreImport  string `json:"preImport"`
+	PostImport string `json:"postImport"`
+	PostExport string `json:"postExport"`
+}
+
+// Redacted is the subset of Config that is safe to expose: credentials are
+// reduced to whether they are set.
+type Redacted struct {
+	Port                 string   `json:"port"`
+	LogLevel             string   `json:"logLevel"`
+	RedisURL             string   `json:"redisUrl"`
+	RedisTLS             bool     `json:"redisTls"`
+	RedisPasswordSet     bool     `json:"redisPasswordSet"`
+	RedisDB              int      `json:"redisDb"`
+	JobTimeout           string   `json:"jobTimeout"`
+	StallTimeout         string   `json:"stallTimeout"`
+	HeartbeatTimeout     string   `json:"heartbeatTimeout"`
+	StatementTimeout     string   `json:"statementTimeout"`
+	ExportParallelism    int      `json:"exportParallelism"`
+	ImportParallelism    int      `json:"importParallelism"`
+	MaskingConfigFile    string   `json:"maskingConfigFile"`
+	ExportSchedules      string   `json:"exportSchedules"`
+	AllowSwapImport      bool     `json:"allowSwapImport"`
+	AutoCreateTarget     bool     `json:"autoCreateTarget"`
+	AdminAPIKeySet       bool     `json:"adminApiKeySet"`
+	EnablePprof          bool     `json:"enablePprof"`
+	MaintenanceMode      bool     `json:"maintenanceMode"`
+	ProgressChannel      string   `json:"progressChannel"`
+	Hooks                Hooks    `json:"hooks"`
+	DBPingAttempts       int      `json:"dbPingAttempts"`
+	DBPingBackoff        string   `json:"dbPingBackoff"`
+	DBWarmup             bool     `json:"dbWarmup"`
+	MaxInflightJobs      int      `json:"maxInflightJobs"`
+	DumpFilenameTemplate string   `json:"dumpFilenameTemplate"`
+	DumpTimestampFormat  string   `json:"dumpTimestampFormat"`
+	StreamExportTimeout  string   `json:"streamExportTimeout"`
+	StreamExportMaxRows  int64    `json:"streamExportMaxRows"`
+	StreamExportMaxBytes int64    `json:"streamExportMaxBytes"`
+	AuditLogFile         string   `json:"auditLogFile"`
+	AuditLogMaxBytes     int64    `json:"auditLogMaxBytes"`
+	AuditLogTable        string   `json:"auditLogTable"`
+	ExportDenyTables     []string `json:"exportDenyTables"`
+}
+
+func (c Config) Redacted() Redacted {
+	redisURL := c.RedisURL
+	if u, err := url.Parse(redisURL); err == nil {
+		redisURL = u.Redacted()
+	}
+	return Redacted{
+		Port:                 c.Port,
+		LogLevel:             c.LogLevel,
+		RedisURL:             redisURL,
+		RedisTLS:             c.RedisTLS,
+		RedisPasswordSet:     c.RedisPassword != "",
+		RedisDB:              c.RedisDB,
+		JobTimeout:           c.JobTimeout.String(),
+		StallTimeout:         c.StallTimeout.String(),
+		HeartbeatTimeout:     c.HeartbeatTimeout.String(),
+		StatementTimeout:     c.StatementTimeout.String(),
+		ExportParallelism:    c.ExportParallelism,
+		ImportParallelism:    c.ImportParallelism,
+		MaskingConfigFile:    c.MaskingConfigFile,
+		ExportSchedules:      c.ExportSchedules,
+		AllowSwapImport:      c.AllowSwapImport,
+		AutoCreateTarget:     c.AutoCreateTarget,
+		AdminAPIKeySet:       c.AdminAPIKey != "",
+		EnablePprof:          c.EnablePprof,
+		MaintenanceMode:      c.MaintenanceMode,
+		ProgressChannel:      c.ProgressChannel,
+		Hooks:                c.Hooks,
+		DBPingAttempts:       c.DBPingAttempts,
+		DBPingBackoff:        c.DBPingBackoff.String(),
+		DBWarmup:             c.DBWarmup,
+		MaxInflightJobs:      c.MaxInflightJobs,
+		DumpFilenameTemplate: c.DumpFilenameTemplate,
+		DumpTimestampFormat:  c.DumpTimestampFormat,
+		StreamExportTimeout:  c.StreamExportTimeout.String(),
+		StreamExportMaxRows:  c.StreamExportMaxRows,
+		StreamExportMaxBytes: c.StreamExportMaxBytes,
+		AuditLogFile:         c.AuditLogFile,
+		AuditLogMaxBytes:     c.AuditLogMaxBytes,
+		AuditLogTable:        c.AuditLogTable,
+		ExportDenyTables:     c.ExportDenyTables,
+	}
 }
 
 func getenv(key, def string) string {
@@ -19,7 +153,56 @@ func getenv(key, def string) string {
 	return def
 }
 
-func Load() Config {
+// envReader reads typed variables, keeping the first malformed one as err
+// so Load refuses it rather than quietly running on the default.
+type envReader struct {
+	err error
+}
+
+func (e *envReader) int(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.fail(key, v, "an integer")
+		return def
+	}
+	return n
+}
+
+func (e *envReader) bool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail(key, v, "true or false")
+		return def
+	}
+	return b
+}
+
+func (e *envReader) fail(key, value, want string) {
+	if e.err == nil {
+		e.err = fmt.Errorf("invalid %s %q: must be %s", key, value, want)
+	}
+}
+
+// getenvList splits a comma-separated variable, dropping empty entries.
+func getenvList(key string) []string {
+	var out []string
+	for _, s := range strings.Split(os.Getenv(key), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func Load() (Config, error) {
 	port := getenv("PORT", "8080")
 	logLevel := getenv("LOG_LEVEL", "info")
 	redisURL := getenv("REDIS_URL", "redis://127.0.0.1:6379")
@@ -27,9 +210,66 @@ func Load() Config {
 		redisURL = "redis://127.0.0.1:6379"
 		_ = fmt.Errorf("invalid REDIS_URL; defaulting to %s", redisURL)
 	}
-	return Config{
+	dumpFilenameTmpl := getenv("DUMP_FILENAME_TEMPLATE", DefaultDumpFilename)
+	dumpFilename, err := ParseFilenameTemplate(dumpFilenameTmpl)
+	if err != nil {
+		return Config{}, err
+	}
+	dumpTimestampFormat := getenv("DUMP_TIMESTAMP_FORMAT", DefaultDumpTimestampFormat)
+	if err := CheckTimestampFormat(dumpTimestampFormat); err != nil {
+		return Config{}, err
+	}
+	auditFile, auditTable := os.Getenv("AUDIT_LOG_FILE"), os.Getenv("AUDIT_LOG_TABLE")
+	if auditFile != "" && auditTable != "" {
+		return Config{}, fmt.Errorf("set at most one of AUDIT_LOG_FILE and AUDIT_LOG_TABLE")
+	}
+	env := &envReader{}
+	cfg := Config{
 		Port:     port,
 		LogLevel: logLevel,
 		RedisURL: redisURL,
+
+		RedisTLS:      env.bool("REDIS_TLS", false),
+		RedisPassword: os.Getenv("REDIS_PASSWORD"),
+		RedisDB:       env.int("REDIS_DB", -1),
+
+		JobTimeout:        time.Duration(env.int("JOB_TIMEOUT_MINUTES", 60)) * time.Minute,
+		StallTimeout:      time.Duration(env.int("JOB_STALL_TIMEOUT_MINUTES", 0)) * time.Minute,
+		HeartbeatTimeout:  time.Duration(env.int("WORKER_HEARTBEAT_TIMEOUT_SECONDS", 60)) * time.Second,
+		StatementTimeout:  time.Duration(env.int("STATEMENT_TIMEOUT_SECONDS", 0)) * time.Second,
+		ExportParallelism: env.int("EXPORT_PARALLELISM", 1),
+		ImportParallelism: env.int("IMPORT_PARALLELISM", 4),
+		MaskingConfigFile: os.Getenv("MASKING_CONFIG_FILE"),
+		ExportSchedules:   os.Getenv("EXPORT_SCHEDULES"),
+		AllowSwapImport:   env.bool("ALLOW_SWAP_IMPORT", false),
+		AutoCreateTarget:  env.bool("AUTO_CREATE_TARGET_DB", false),
+		AdminAPIKey:       os.Getenv("ADMIN_API_KEY"),
+		EnablePprof:       env.bool("ENABLE_PPROF", false),
+		MaintenanceMode:   env.bool("MAINTENANCE_MODE", false),
+		ProgressChannel:   os.Getenv("PROGRESS_REDIS_CHANNEL"),
+		DBPingAttempts:    env.int("DB_PING_ATTEMPTS", 3),
+		DBPingBackoff:     time.Duration(env.int("DB_PING_BACKOFF_MS", 500)) * time.Millisecond,
+		DBWarmup:          env.bool("DB_WARMUP", true),
+		MaxInflightJobs:   env.int("MAX_INFLIGHT_JOBS", 0),
+
+		DumpFilenameTemplate: dumpFilenameTmpl,
+		DumpFilename:         dumpFilename,
+		DumpTimestampFormat:  dumpTimestampFormat,
+		StreamExportTimeout:  time.Duration(env.int("STREAM_EXPORT_TIMEOUT_SECONDS", 120)) * time.Second,
+		StreamExportMaxRows:  int64(env.int("STREAM_EXPORT_MAX_ROWS", 1000000)),
+		StreamExportMaxBytes: int64(env.int("STREAM_EXPORT_MAX_MB", 256)) << 20,
+		AuditLogFile:         auditFile,
+		AuditLogMaxBytes:     int64(env.int("AUDIT_LOG_MAX_MB", 100)) << 20,
+		AuditLogTable:        auditTable,
+		ExportDenyTables:     getenvList("EXPORT_DENY_TABLES"),
+		Hooks: Hooks{
+			PreImport:  os.Getenv("PRE_IMPORT_SQL_FILE"),
+			PostImport: os.Getenv("POST_IMPORT_SQL_FILE"),
+			PostExport: os.Getenv("POST_EXPORT_SQL_FILE"),
+		},
+	}
+	if env.err != nil {
+		return Config{}, env.err
 	}
+	return cfg, nil
 }
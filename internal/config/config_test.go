@@ -0,0 +1,45 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadRejectsMalformedNumbers(t *testing.T) {
+	tests := []struct {
+		key, value string
+		wantErr    bool
+	}{
+		{"EXPORT_PARALLELISM", "4", false},
+		{"EXPORT_PARALLELISM", "eight", true},
+		{"JOB_TIMEOUT_MINUTES", "1.5", true},
+		{"REDIS_DB", "-1", false},
+		{"REDIS_TLS", "true", false},
+		{"REDIS_TLS", "yes", true},
+		{"STREAM_EXPORT_MAX_MB", "256MB", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			_, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() = %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("error %q does not name %s", err, tt.key)
+			}
+		})
+	}
+}
+
+func TestLoadParsesNumbers(t *testing.T) {
+	t.Setenv("EXPORT_PARALLELISM", "3")
+	t.Setenv("MAINTENANCE_MODE", "1")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ExportParallelism != 3 || !cfg.MaintenanceMode {
+		t.Errorf("ExportParallelism = %d, MaintenanceMode = %t, want 3, true", cfg.ExportParallelism, cfg.MaintenanceMode)
+	}
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// DefaultDumpFilename reproduces the historical dumps/<db>_<ts>.sql names.
+const DefaultDumpFilename = "{{.Database}}_{{.Timestamp}}.sql"
+
+// DefaultDumpTimestampFormat is the layout of {{.Timestamp}}, formatted in
+// UTC so names sort chronologically whatever the server's time zone.
+const DefaultDumpTimestampFormat = "20060102T150405Z"
+
+// LegacyDumpTimestampFormat is the server local time layout dumps were
+// named with before DUMP_TIMESTAMP_FORMAT; such dumps can still be restored.
+const LegacyDumpTimestampFormat = "20060102_150405"
+
+// FilenameData is what a dump filename template is executed with.
+// Timestamp is already formatted; Time allows other layouts, e.g.
+// {{.Time.Format "2006-01-02"}}.
+type FilenameData struct {
+	Database  string
+	Timestamp string
+	JobID     string
+	Time      time.Time
+}
+
+// FilenameTemplate renders dump paths, relative to the dumps directory,
+// from a text/template.
+type FilenameTemplate struct {
+	tmpl *template.Template
+	// pattern is the template as a regular expression over rendered paths
+	// without their .sql, split where the database goes.
+	pattern []string
+}
+
+// ParseFilenameTemplate parses text and renders it once with sample data,
+// so a template that cannot produce a usable path fails at startup rather
+// than on the first export. The importer finds dumps by matching paths
+// against the template, so it must name the database with {{.Database}} and
+// may not use control structures such as {{if}} or {{range}}.
+func ParseFilenameTemplate(text string) (*FilenameTemplate, error) {
+	tmpl, err := template.New("dump").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("DUMP_FILENAME_TEMPLATE: %w", err)
+	}
+	pattern, err := templatePattern(tmpl.Tree.Root)
+	if err != nil {
+		return nil, fmt.Errorf("DUMP_FILENAME_TEMPLATE: %w", err)
+	}
+	f := &FilenameTemplate{tmpl: tmpl, pattern: pattern}
+	now := time.Now()
+	sample := FilenameData{Database: "db", Timestamp: now.UTC().Format(DefaultDumpTimestampFormat), JobID: "job", Time: now}
+	name, err := f.Render(sample)
+	if err != nil {
+		return nil, fmt.Errorf("DUMP_FILENAME_TEMPLATE: %w", err)
+	}
+	if ts, ok := f.Matcher(sample.Database).Match(strings.TrimSuffix(name, ".sql")); !ok || (ts != "" && ts != sample.Timestamp) {
+		return nil, fmt.Errorf("DUMP_FILENAME_TEMPLATE: the importer cannot locate dumps named like %q", name)
+	}
+	return f, nil
+}
+
+// templatePattern turns the nodes of a filename template into a regular
+// expression: literal text matches itself, {{.Database}} the database and
+// {{.Timestamp}} a captured timestamp; other actions match anything.
+func templatePattern(root *parse.ListNode) ([]string, error) {
+	var (
+		pattern      []string
+		b            strings.Builder
+		hasDB, hasTS bool
+	)
+	nodes := root.Nodes
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("is empty")
+	}
+	if last, ok := nodes[len(nodes)-1].(*parse.TextNode); !ok || !strings.HasSuffix(string(last.Text), ".sql") {
+		return nil, fmt.Errorf("must end in literal .sql so the importer can locate dumps")
+	}
+	for i, n := range nodes {
+		switch n := n.(type) {
+		case *parse.TextNode:
+			text := string(n.Text)
+			if i == len(nodes)-1 {
+				text = strings.TrimSuffix(text, ".sql")
+			}
+			b.WriteString(regexp.QuoteMeta(text))
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) > 0 {
+				return nil, fmt.Errorf("variables are not supported: %s", n)
+			}
+			switch templateField(n) {
+			case "Database":
+				pattern = append(pattern, b.String())
+				b.Reset()
+				hasDB = true
+			case "Timestamp":
+				if hasTS {
+					b.WriteString(`[^/]+`)
+				} else {
+					b.WriteString(`([^/]+)`)
+					hasTS = true
+				}
+			case "JobID":
+				b.WriteString(`[^/]+`)
+			default:
+				b.WriteString(`.*?`)
+			}
+		case *parse.CommentNode:
+		default:
+			return nil, fmt.Errorf("%s is not supported: the importer could not locate the dumps", n)
+		}
+	}
+	if !hasDB {
+		return nil, fmt.Errorf("must include {{.Database}} so the importer can tell the dumps of each database apart")
+	}
+	return append(pattern, b.String()), nil
+}
+
+// templateField returns the FilenameData field an action prints verbatim,
+// e.g. "Database" for {{.Database}}, or "" for any other action.
+func templateField(n *parse.ActionNode) string {
+	if len(n.Pipe.Cmds) != 1 || len(n.Pipe.Cmds[0].Args) != 1 {
+		return ""
+	}
+	f, ok := n.Pipe.Cmds[0].Args[0].(*parse.FieldNode)
+	if !ok || len(f.Ident) != 1 {
+		return ""
+	}
+	return f.Ident[0]
+}
+
+// DumpMatcher recognizes the dumps a FilenameTemplate names for one
+// database.
+type DumpMatcher struct {
+	re *regexp.Regexp
+}
+
+// Matcher returns a DumpMatcher for the dumps of database.
+func (f *FilenameTemplate) Matcher(database string) *DumpMatcher {
+	// A "-N" suffix keeps apart dumps that render to the same name.
+	pattern := "^" + strings.Join(f.pattern, regexp.QuoteMeta(database)) + `(?:-[0-9]+)?$`
+	return &DumpMatcher{re: regexp.MustCompile(pattern)}
+}
+
+// Match reports whether base, a dump path relative to the dumps directory
+// without its .sql, .sql.gz or index suffix, is one of the database's dumps.
+// The timestamp is the {{.Timestamp}} part of base, "" if the template has
+// none; it may end in the "-N" suffix, which ParseDumpTimestamp ignores.
+func (m *DumpMatcher) Match(base string) (timestamp string, ok bool) {
+	sub := m.re.FindStringSubmatch(filepath.ToSlash(base))
+	if sub == nil {
+		return "", false
+	}
+	if len(sub) > 1 {
+		timestamp = sub[1]
+	}
+	return timestamp, true
+}
+
+// Render returns the dump path for d. It must be a relative path ending in
+// .sql that stays inside the dumps directory.
+func (f *FilenameTemplate) Render(d FilenameData) (string, error) {
+	var b bytes.Buffer
+	if err := f.tmpl.Execute(&b, d); err != nil {
+		return "", err
+	}
+	name := filepath.Clean(strings.TrimSpace(b.String()))
+	switch {
+	case filepath.IsAbs(name), name == "..", strings.HasPrefix(name, ".."+string(filepath.Separator)):
+		return "", fmt.Errorf("%q is outside the dumps directory", name)
+	case !strings.HasSuffix(name, ".sql") || filepath.Base(name) == ".sql":
+		return "", fmt.Errorf("%q does not end in a .sql file name", name)
+	}
+	return name, nil
+}
+
+// CheckTimestampFormat rejects a dump timestamp layout that cannot be part of
+// a file name or does not keep the time to the second.
+func CheckTimestampFormat(layout string) error {
+	if layout == "" || strings.ContainsAny(layout, `/\ `) {
+		return fmt.Errorf("DUMP_TIMESTAMP_FORMAT %q must be non-empty without slashes or spaces", layout)
+	}
+	t := time.Date(2021, 11, 12, 13, 14, 15, 0, time.UTC)
+	if got, err := time.Parse(layout, t.Format(layout)); err != nil || !got.Equal(t) {
+		return fmt.Errorf("DUMP_TIMESTAMP_FORMAT %q must include the date and the time to the second", layout)
+	}
+	return nil
+}
+
+// ParseDumpTimestamp parses the timestamp of a dump name, as written in UTC
+// with layout or in local time with LegacyDumpTimestampFormat. A "-N" suffix,
+// which keeps apart dumps named in the same second, is ignored.
+func ParseDumpTimestamp(s, layout string) (time.Time, bool) {
+	if t, ok := parseDumpTimestamp(s, layout); ok {
+		return t, true
+	}
+	if i := strings.LastIndexByte(s, '-'); i > 0 && i < len(s)-1 && strings.Trim(s[i+1:], "0123456789") == "" {
+		return parseDumpTimestamp(s[:i], layout)
+	}
+	return time.Time{}, false
+}
+
+func parseDumpTimestamp(s, layout string) (time.Time, bool) {
+	if t, err := time.Parse(layout, s); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation(LegacyDumpTimestampFormat, s, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
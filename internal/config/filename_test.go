@@ -0,0 +1,117 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFilenameTemplate(t *testing.T) {
+	tests := []struct {
+		text    string
+		wantErr string
+	}{
+		{text: DefaultDumpFilename},
+		{text: `{{.Database}}/{{.Time.Format "2006-01-02"}}/full.sql`},
+		{text: `myapp/{{.Database}}/{{.JobID}}-{{.Timestamp}}.sql`},
+		{text: `{{/* a comment */}}{{.Database}}.sql`},
+		{text: `{{.Timestamp}}.sql`, wantErr: "{{.Database}}"},
+		{text: `{{.Database}}_{{.Timestamp}}.dump`, wantErr: ".sql"},
+		{text: `{{.Database}}_{{.Timestamp}}{{".sql"}}`, wantErr: ".sql"},
+		{text: `{{if .JobID}}{{.Database}}{{end}}.sql`, wantErr: "not supported"},
+		{text: `{{$d := .Database}}{{$d}}.sql`, wantErr: "not supported"},
+		{text: `../{{.Database}}.sql`, wantErr: "outside the dumps directory"},
+		{text: `./{{.Database}}.sql`, wantErr: "cannot locate"},
+		{text: `{{.Database}}{{.Nope}}.sql`, wantErr: "Nope"},
+	}
+	for _, tt := range tests {
+		_, err := ParseFilenameTemplate(tt.text)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("ParseFilenameTemplate(%q) = %v", tt.text, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("ParseFilenameTemplate(%q) = %v, want an error about %s", tt.text, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDumpMatcher(t *testing.T) {
+	tests := []struct {
+		template string
+		db       string
+		base     string
+		wantTS   string
+		wantOK   bool
+	}{
+		{DefaultDumpFilename, "dev", "dev_20240102T030405Z", "20240102T030405Z", true},
+		{DefaultDumpFilename, "dev", "dev_20240102T030405Z-2", "20240102T030405Z-2", true},
+		{DefaultDumpFilename, "dev", "dev_20240102_030405", "20240102_030405", true},
+		{DefaultDumpFilename, "dev", "staging_20240102T030405Z", "", false},
+		{DefaultDumpFilename, "dev", "sub/dev_20240102T030405Z", "", false},
+		{`myapp/{{.Database}}/{{.Time.Format "2006-01-02"}}/full.sql`, "production", "myapp/production/2024-01-02/full", "", true},
+		{`myapp/{{.Database}}/{{.Time.Format "2006-01-02"}}/full.sql`, "production", "myapp/production/2024-01-02/full-3", "", true},
+		{`myapp/{{.Database}}/{{.Time.Format "2006-01-02"}}/full.sql`, "dev", "myapp/production/2024-01-02/full", "", false},
+		{`{{.Database}}/{{.Timestamp}}.sql`, "a.b", "a.b/20240102T030405Z", "20240102T030405Z", true},
+		{`{{.Database}}/{{.Timestamp}}.sql`, "a.b", "axb/20240102T030405Z", "", false},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilenameTemplate(tt.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts, ok := f.Matcher(tt.db).Match(tt.base)
+		if ts != tt.wantTS || ok != tt.wantOK {
+			t.Errorf("%q: Matcher(%q).Match(%q) = %q, %t, want %q, %t", tt.template, tt.db, tt.base, ts, ok, tt.wantTS, tt.wantOK)
+		}
+	}
+}
+
+func TestDumpMatcherMatchesRender(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, text := range []string{
+		DefaultDumpFilename,
+		`{{.Database}}/{{.Time.Format "2006/01/02"}}/{{.JobID}}.sql`,
+		`exports/{{.Database}}-{{.Timestamp}}.sql`,
+	} {
+		f, err := ParseFilenameTemplate(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := FilenameData{Database: "staging", Timestamp: now.Format(DefaultDumpTimestampFormat), JobID: "j1", Time: now}
+		name, err := f.Render(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := f.Matcher("staging").Match(strings.TrimSuffix(name, ".sql")); !ok {
+			t.Errorf("%q: rendered %q does not match its own template", text, name)
+		}
+		if _, ok := f.Matcher("dev").Match(strings.TrimSuffix(name, ".sql")); ok {
+			t.Errorf("%q: rendered %q matches another database", text, name)
+		}
+	}
+}
+
+func TestParseDumpTimestamp(t *testing.T) {
+	utc := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	local := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	tests := []struct {
+		in     string
+		want   time.Time
+		wantOK bool
+	}{
+		{"20240102T030405Z", utc, true},
+		{"20240102T030405Z-2", utc, true},
+		{"20240102T030405Z-12", utc, true},
+		{"20240102_030405", local, true},
+		{"20240102_030405-3", local, true},
+		{"20240102T030405Z-", time.Time{}, false},
+		{"20240102T030405Z-x", time.Time{}, false},
+		{"latest", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseDumpTimestamp(tt.in, DefaultDumpTimestampFormat)
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Errorf("ParseDumpTimestamp(%q) = %v, %t, want %v, %t", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maintenanceDB = "postgres"
+
+// DatabaseName returns the Postgres database name the named connection
+// points at.
+func (m *Manager) DatabaseName(name string) (string, error) {
+	cfg, err := m.poolConfig(name)
+	if err != nil {
+		return "", err
+	}
+	return cfg.ConnConfig.Database, nil
+}
+
+// MaintenanceConn opens a single connection to the maintenance database on
+// the same server as the named connection, for database-level DDL such as
+// CREATE DATABASE and ALTER DATABASE ... RENAME.
+func (m *Manager) MaintenanceConn(ctx context.Context, name string) (*pgx.Conn, error) {
+	cfg, err := m.poolConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	cc := cfg.ConnConfig.Copy()
+	cc.Database = maintenanceDB
+	conn, err := pgx.ConnectConfig(ctx, cc)
+	if err != nil {
+		return nil, m.redact(name, err)
+	}
+	return conn, nil
+}
+
+// OpenSiblingPool opens a pool to another database on the same server as the
+// named connection. The caller owns and must close the pool.
+func (m *Manager) OpenSiblingPool(ctx context.Context, name, dbName string) (*pgxpool.Pool, error) {
+	cfg, err := m.poolConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ConnConfig.Database = dbName
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, m.redact(name, err)
+	}
+	if err := pingWithRetry(ctx, pool, m.ping); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("connect to %s: %w", dbName, m.redact(name, err))
+	}
+	return pool, nil
+}
+
+// ResetPool takes the cached pool for name out of use so the next Pool call
+// reconnects. As with Reload, the pool is closed once the connections and
+// leases jobs hold on it are released; a caller that needs its sessions
+// gone sooner terminates them on the server.
+func (m *Manager) ResetPool(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// A pool being connected meanwhile is not stored either.
+	m.gen++
+	if p, ok := m.pools[name]; ok && p != nil {
+		m.retireLocked(p)
+	}
+	delete(m.pools, name)
+}
+
+// EnsureDatabase creates the database the named connection points at if it
+// does not exist yet, and reports whether it did. Only the localhost and dev
+// connections may be created this way.
+func (m *Manager) EnsureDatabase(ctx context.Context, name string) (bool, error) {
+	if name != DBNameLocalhost && name != DBNameDev {
+		return false, fmt.Errorf("refusing to create database for %s", name)
+	}
+	dbName, err := m.DatabaseName(name)
+	if err != nil {
+		return false, err
+	}
+	if dbName == "" || dbName == maintenanceDB {
+		return false, nil
+	}
+	conn, err := m.MaintenanceConn(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+	var exists bool
+	if err := conn.QueryRow(ctx, "select exists(select 1 from pg_database where datname = $1)", dbName).Scan(&exists); err != nil {
+		return false, m.redact(name, err)
+	}
+	if exists {
+		return false, nil
+	}
+	if _, err := conn.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{dbName}.Sanitize()); err != nil {
+		return false, fmt.Errorf("create database %s: %w", dbName, m.redact(name, err))
+	}
+	return true, nil
+}
+
+// SignalJobSessions cancels the running queries of the sessions that
+// TagSession tagged with jobID on the named database, or terminates the
+// sessions when terminate is set. It returns the PIDs it signalled.
+func (m *Manager) SignalJobSessions(ctx context.Context, name, jobID string, terminate bool) ([]int32, error) {
+	pool, err := m.Pool(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	fn := "pg_cancel_backend"
+	if terminate {
+		fn = "pg_terminate_backend"
+	}
+	rows, err := pool.Query(ctx, `
+select pid from (
+  select pid, `+fn+`(pid) as signalled
+  from pg_stat_activity
+  where pid <> pg_backend_pid() and right(application_name, length($1) + 1) = '-' || $1
+) s where signalled`, SessionKey(jobID))
+	if err != nil {
+		return nil, m.redact(name, err)
+	}
+	defer rows.Close()
+	var pids []int32
+	for rows.Next() {
+		var pid int32
+		if err := rows.Scan(&pid); err != nil {
+			return nil, err
+		}
+		pids = append(pids, pid)
+	}
+	return pids, rows.Err()
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DefaultApplicationName is what our sessions report as application_name in
+// pg_stat_activity unless DB_APPLICATION_NAME or the URL sets another.
+const DefaultApplicationName = "multiboard-sync"
+
+func loadApplicationName() string {
+	if v := os.Getenv("DB_APPLICATION_NAME"); v != "" {
+		return v
+	}
+	return DefaultApplicationName
+}
+
+type jobIDKey struct{}
+
+// WithJobID returns a context carrying the job that connections are used
+// for, which TagSession adds to their application_name.
+func WithJobID(ctx context.Context, jobID string) context.Context {
+	return context.WithValue(ctx, jobIDKey{}, jobID)
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// TagSession appends the job's session key, see SessionKey, to the
+// session's application_name, giving <name>-<key>, so DBAs can tell which
+// job a session belongs to and SignalJobSessions can find it. The name is
+// shortened as needed to keep the key within the 63 bytes Postgres keeps of
+// application_name. With local set the change ends with the current
+// transaction, as it must on pooled connections; without it it lasts for
+// the session. Without a job ID it does nothing.
+func TagSession(ctx context.Context, db execer, local bool) error {
+	jobID, _ := ctx.Value(jobIDKey{}).(string)
+	if jobID == "" {
+		return nil
+	}
+	_, err := db.Exec(ctx, `select set_config('application_name',
+  left(current_setting('application_name'), $3::int - 1 - length($1)) || '-' || $1, $2)`,
+		SessionKey(jobID), local, maxApplicationNameLen)
+	return err
+}
+
+// maxApplicationNameLen is the length Postgres truncates application_name
+// to. Non-ASCII characters are replaced with '?', so bytes and characters
+// agree.
+const maxApplicationNameLen = 63
+
+// maxSessionKeyLen fits a UUID job ID unchanged while leaving room for the
+// application name in front of it.
+const maxSessionKeyLen = 36
+
+// SessionKey returns the key TagSession tags jobID's sessions with: the ID
+// itself, or for IDs longer than maxSessionKeyLen, the start of it followed
+// by '~' and a hash of the whole. Job IDs have no '~', so the two forms
+// cannot collide.
+func SessionKey(jobID string) string {
+	if len(jobID) <= maxSessionKeyLen {
+		return jobID
+	}
+	sum := sha256.Sum256([]byte(jobID))
+	hash := hex.EncodeToString(sum[:6])
+	return jobID[:maxSessionKeyLen-1-len(hash)] + "~" + hash
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSessionKey(t *testing.T) {
+	uuid := "0f8fad5b-d9cb-469f-a165-70867728950e"
+	long := strings.Repeat("a", 64)
+	tests := []struct {
+		id, want string
+	}{
+		{"job1", "job1"},
+		{uuid, uuid},
+		{long, "aaaaaaaaaaaaaaaaaaaaaaa~" + SessionKey(long)[24:]},
+	}
+	for _, tt := range tests {
+		if got := SessionKey(tt.id); got != tt.want {
+			t.Errorf("SessionKey(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+	seen := map[string]string{}
+	for _, id := range []string{long, long[:63] + "b", long[:37], long[:40] + "-" + long[:23]} {
+		key := SessionKey(id)
+		if len(key) > maxSessionKeyLen {
+			t.Errorf("SessionKey(%q) = %q, longer than %d", id, key, maxSessionKeyLen)
+		}
+		if other, ok := seen[key]; ok {
+			t.Errorf("SessionKey(%q) = SessionKey(%q) = %q", id, other, key)
+		}
+		seen[key] = id
+	}
+}
+
+// TestSignalJobSessionsFindsLongJobIDs tags a session of a job with a
+// 64-character ID under an application name that already takes up most of
+// what Postgres keeps.
+func TestSignalJobSessionsFindsLongJobIDs(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	m, err := NewManager(ctx, URLs{Localhost: url, ApplicationName: strings.Repeat("n", maxApplicationNameLen-3)}, PingPolicy{Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	conn, err := m.Acquire(ctx, DBNameLocalhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	jobID := strings.Repeat("7", 64)
+	if err := TagSession(WithJobID(ctx, jobID), conn, false); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Exec(ctx, "RESET application_name")
+	var name string
+	if err := conn.QueryRow(ctx, "SELECT current_setting('application_name')").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if len(name) > maxApplicationNameLen || !strings.HasSuffix(name, "-"+SessionKey(jobID)) {
+		t.Errorf("application_name = %q, want at most %d bytes ending in the session key", name, maxApplicationNameLen)
+	}
+	pids, err := m.SignalJobSessions(ctx, DBNameLocalhost, jobID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := conn.Conn.Conn().PgConn().PID(); len(pids) != 1 || pids[0] != int32(want) {
+		t.Errorf("SignalJobSessions = %v, want [%d]", pids, want)
+	}
+}
@@ -9,11 +9,40 @@ const (
 	DBNameLocalhost  = "localhost"
 )
 
+// IsProductionClass reports whether name refers to a shared environment
+// whose data must never be overwritten without explicit confirmation.
+func IsProductionClass(name string) bool {
+	return name == DBNameProduction || name == DBNameStaging
+}
+
 type URLs struct {
 	Production string
 	Staging    string
 	Dev        string
 	Localhost  string
+
+	TLS map[string]TLSSettings
+	// ApplicationName is set as application_name on every connection
+	// whose URL does not set one.
+	ApplicationName string
+	// MaxConns caps the connections in use to each database; zero or
+	// missing means the pool default. It sizes the pool, which bounds every
+	// user of it, and the slots Manager.Acquire and Reserve hand out, which
+	// also hold across Reloads. Exports, post-export hooks and table syncs
+	// take their connections that way; imports, admin calls and the audit
+	// log use the pool directly and are bounded by its size alone.
+	MaxConns map[string]int
+}
+
+type TLSSettings struct {
+	SSLMode    string
+	RootCert   string
+	ClientCert string
+	ClientKey  string
+}
+
+func (t TLSSettings) IsZero() bool {
+	return t.SSLMode == "" && t.RootCert == "" && t.ClientCert == "" && t.ClientKey == ""
 }
 
 func LoadURLs() URLs {
@@ -22,6 +51,28 @@ func LoadURLs() URLs {
 		Staging:    os.Getenv("STAGING_DATABASE_URL"),
 		Dev:        os.Getenv("DEV_DATABASE_URL"),
 		Localhost:  os.Getenv("LOCALHOST_DATABASE_URL"),
+		TLS: map[string]TLSSettings{
+			DBNameProduction: loadTLSSettings("PRODUCTION"),
+			DBNameStaging:    loadTLSSettings("STAGING"),
+			DBNameDev:        loadTLSSettings("DEV"),
+			DBNameLocalhost:  loadTLSSettings("LOCALHOST"),
+		},
+		ApplicationName: loadApplicationName(),
+		MaxConns: map[string]int{
+			DBNameProduction: loadMaxConns("PRODUCTION", DefaultProductionMaxConns),
+			DBNameStaging:    loadMaxConns("STAGING", 0),
+			DBNameDev:        loadMaxConns("DEV", 0),
+			DBNameLocalhost:  loadMaxConns("LOCALHOST", 0),
+		},
+	}
+}
+
+func loadTLSSettings(prefix string) TLSSettings {
+	return TLSSettings{
+		SSLMode:    os.Getenv(prefix + "_DATABASE_SSLMODE"),
+		RootCert:   os.Getenv(prefix + "_DATABASE_SSLROOTCERT"),
+		ClientCert: os.Getenv(prefix + "_DATABASE_SSLCERT"),
+		ClientKey:  os.Getenv(prefix + "_DATABASE_SSLKEY"),
 	}
 }
 
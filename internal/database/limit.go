@@ -0,0 +1,187 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultProductionMaxConns caps production connections when
+// PRODUCTION_DATABASE_MAX_CONNS is unset.
+const DefaultProductionMaxConns = 10
+
+// minMaxConns leaves room for an export's snapshot connection plus at least
+// one table stream, which would otherwise wait on each other forever.
+const minMaxConns = 2
+
+func loadMaxConns(prefix string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(prefix + "_DATABASE_MAX_CONNS"))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// maxConns returns the connection limit for name, or 0 if it has none.
+func (u URLs) maxConns(name string) int {
+	n := u.MaxConns[name]
+	if n <= 0 {
+		return 0
+	}
+	if n < minMaxConns {
+		return minMaxConns
+	}
+	return n
+}
+
+// Conn is a pooled connection taken with Manager.Acquire. Release returns it
+// to the pool and frees its slot under the database's limit.
+type Conn struct {
+	*pgxpool.Conn
+	slot chan struct{}
+}
+
+func (c *Conn) Release() {
+	c.Conn.Release()
+	if c.slot != nil {
+		<-c.slot
+		c.slot = nil
+	}
+}
+
+// Acquire takes a connection to name, first waiting for a free slot when
+// the database has a connection limit. Unlike the pool's own MaxConns, the
+// slots outlive pools replaced by Reload, so the limit holds across them.
+// A caller that needs several connections at once must Reserve them
+// instead: holding one slot while waiting for another deadlocks as soon as
+// enough such callers run together.
+func (m *Manager) Acquire(ctx context.Context, name string) (*Conn, error) {
+	pool, err := m.getOrCreatePool(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var slot chan struct{}
+	if l := m.limit(name); l != nil {
+		slot = l.slots
+	}
+	return m.acquire(ctx, name, pool, slot)
+}
+
+func (m *Manager) acquire(ctx context.Context, name string, pool *pgxpool.Pool, slot chan struct{}) (*Conn, error) {
+	if slot != nil {
+		select {
+		case slot <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c, err := pool.Acquire(ctx)
+	if err != nil {
+		if slot != nil {
+			<-slot
+		}
+		return nil, m.redact(name, err)
+	}
+	return &Conn{Conn: c, slot: slot}, nil
+}
+
+// Reservation holds slots under a database's connection limit for a caller
+// that uses several connections at once, such as a parallel export's
+// snapshot connection and its table streams.
+type Reservation struct {
+	m    *Manager
+	name string
+	// limit is the limit the slots were taken from, nil if the database
+	// has none. free admits the reservation's own connections.
+	limit *limit
+	free  chan struct{}
+}
+
+// Reserve takes up to n slots under name's connection limit, all at once,
+// waiting until they are free. Fewer are taken when the limit is lower, so
+// the caller must cope with as few as minMaxConns. Only one Reserve per
+// database fills at a time; since every other holder needs a single slot,
+// the slots it waits for are always released eventually.
+func (m *Manager) Reserve(ctx context.Context, name string, n int) (*Reservation, error) {
+	r := &Reservation{m: m, name: name}
+	l := m.limit(name)
+	if l == nil {
+		return r, nil
+	}
+	if n > cap(l.slots) {
+		n = cap(l.slots)
+	}
+	if n < 1 {
+		n = 1
+	}
+	select {
+	case l.reserving <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-l.reserving }()
+	r.limit = l
+	r.free = make(chan struct{}, n)
+	for i := 0; i < n; i++ {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			for ; i > 0; i-- {
+				<-l.slots
+			}
+			return nil, ctx.Err()
+		}
+	}
+	return r, nil
+}
+
+// Acquire takes a connection under the reservation, waiting while all of
+// its slots are in use.
+func (r *Reservation) Acquire(ctx context.Context) (*Conn, error) {
+	pool, err := r.m.getOrCreatePool(ctx, r.name)
+	if err != nil {
+		return nil, err
+	}
+	return r.m.acquire(ctx, r.name, pool, r.free)
+}
+
+// Release gives the reserved slots back. Connections taken with Acquire
+// must be released first.
+func (r *Reservation) Release() {
+	if r.limit == nil {
+		return
+	}
+	for i := 0; i < cap(r.free); i++ {
+		<-r.limit.slots
+	}
+	r.limit = nil
+}
+
+// limit is the connection limit of a database. slots counts the
+// connections out under it; reserving admits one Reserve at a time.
+type limit struct {
+	slots     chan struct{}
+	reserving chan struct{}
+}
+
+// limit returns the connection limit of name, or nil if it has none.
+func (m *Manager) limit(name string) *limit {
+	m.mu.RLock()
+	l, ok := m.limits[name]
+	m.mu.RUnlock()
+	if ok {
+		return l
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.limits[name]; ok {
+		return l
+	}
+	if n := m.urls.maxConns(name); n > 0 {
+		l = &limit{slots: make(chan struct{}, n), reserving: make(chan struct{}, 1)}
+	}
+	m.limits[name] = l
+	return l
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newLimitedManager(t *testing.T, maxConns int) *Manager {
+	t.Helper()
+	m, err := NewManager(context.Background(), URLs{
+		Localhost: refusedURL("a"),
+		MaxConns:  map[string]int{DBNameLocalhost: maxConns},
+	}, PingPolicy{Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		maxConns, n, want int
+	}{
+		{maxConns: 4, n: 3, want: 3},
+		{maxConns: 4, n: 9, want: 4},
+		{maxConns: 1, n: 5, want: minMaxConns},
+		{maxConns: 4, n: 0, want: 1},
+		{maxConns: 0, n: 3, want: 0},
+	}
+	for _, tt := range tests {
+		m := newLimitedManager(t, tt.maxConns)
+		r, err := m.Reserve(context.Background(), DBNameLocalhost, tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := m.limit(DBNameLocalhost)
+		if got := cap(r.free); got != tt.want {
+			t.Errorf("limit %d: Reserve(%d) holds %d slots, want %d", tt.maxConns, tt.n, got, tt.want)
+		}
+		if l != nil && len(l.slots) != tt.want {
+			t.Errorf("limit %d: Reserve(%d) took %d slots of the limit, want %d", tt.maxConns, tt.n, len(l.slots), tt.want)
+		}
+		r.Release()
+		if l != nil && len(l.slots) != 0 {
+			t.Errorf("limit %d: %d slots still taken after Release", tt.maxConns, len(l.slots))
+		}
+	}
+}
+
+func TestReserveGivesBackSlotsWhenCancelled(t *testing.T) {
+	m := newLimitedManager(t, 3)
+	l := m.limit(DBNameLocalhost)
+	l.slots <- struct{}{} // a connection taken with Acquire
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := m.Reserve(ctx, DBNameLocalhost, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Reserve beyond the free slots = %v, want context.DeadlineExceeded", err)
+	}
+	if len(l.slots) != 1 {
+		t.Errorf("%d slots taken after a cancelled Reserve, want the 1 held before", len(l.slots))
+	}
+	// The next Reserve is not shut out by the cancelled one.
+	<-l.slots
+	r, err := m.Reserve(context.Background(), DBNameLocalhost, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Release()
+}
+
+// TestConcurrentReservationsDoNotDeadlock runs several exports that each
+// hold a snapshot connection while their table streams take more, the
+// pattern that deadlocked when every connection took its own slot.
+func TestConcurrentReservationsDoNotDeadlock(t *testing.T) {
+	const exports, streams = 6, 4
+	m := newLimitedManager(t, 3)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, exports)
+	for i := 0; i < exports; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := m.Reserve(ctx, DBNameLocalhost, 1+streams)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer r.Release()
+			r.free <- struct{}{} // the snapshot connection
+			defer func() { <-r.free }()
+			var sw sync.WaitGroup
+			for j := 0; j < streams; j++ {
+				sw.Add(1)
+				go func() {
+					defer sw.Done()
+					select {
+					case r.free <- struct{}{}:
+					case <-ctx.Done():
+						errs <- ctx.Err()
+						return
+					}
+					time.Sleep(time.Millisecond)
+					<-r.free
+				}()
+			}
+			sw.Wait()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("export did not get its connections: %v", err)
+	}
+	if l := m.limit(DBNameLocalhost); len(l.slots) != 0 {
+		t.Errorf("%d slots still taken after every export finished", len(l.slots))
+	}
+}
@@ -3,6 +3,9 @@ package database
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -11,90 +14,214 @@ import (
 var ErrDBNotConfigured = errors.New("database not configured")
 
 type Manager struct {
+	// mu guards urls, pools and limits. Lookups take the read lock; pool
+	// creation, reload and close take the write lock.
+	mu    sync.RWMutex
 	urls  URLs
 	pools map[string]*pgxpool.Pool
+	// limits holds the connection limit of each database, nil for those
+	// without one.
+	limits map[string]*limit
+	// leases counts the Lease holders of each pool. A pool Reload replaces
+	// while leased is kept in retired and closed by its last release.
+	leases  map[*pgxpool.Pool]int
+	retired map[*pgxpool.Pool]bool
+	// gen counts Reloads and ResetPools, so a pool connected before one is
+	// not stored after it.
+	gen  int
+	ping PingPolicy
 }
 
-func NewManager(ctx context.Context, urls URLs) (*Manager, error) {
+// NewManager validates the configuration of every configured database.
+// Pools are created lazily on first use; call Warmup to connect eagerly.
+func NewManager(ctx context.Context, urls URLs, ping PingPolicy) (*Manager, error) {
 	m := &Manager{
-		urls:  urls,
-		pools: make(map[string]*pgxpool.Pool, 3),
+		urls:    urls,
+		pools:   make(map[string]*pgxpool.Pool, 3),
+		limits:  make(map[string]*limit, 3),
+		leases:  make(map[*pgxpool.Pool]int),
+		retired: make(map[*pgxpool.Pool]bool),
+		ping:    ping,
 	}
-
 	for _, name := range urls.ListConfigured() {
-		dsn, _ := urls.Get(name)
-		cfg, err := pgxpool.ParseConfig(dsn)
-		if err != nil {
+		if _, err := m.poolConfig(name); err != nil {
 			return nil, err
 		}
-		cfg.MaxConns = 25
-		cfg.ConnConfig.ConnectTimeout = 30 * time.Second
+	}
+	return m, nil
+}
 
-		pool, err := pgxpool.NewWithConfig(ctx, cfg)
-		if err != nil {
-			return nil, err
-		}
-		if err := pingWithRetry(ctx, pool); err != nil {
-			pool.Close()
-			continue
-		}
-		m.pools[name] = pool
+// Warmup connects to every configured database in parallel and returns the
+// outcome per database; a nil error means the pool is ready.
+func (m *Manager) Warmup(ctx context.Context) map[string]error {
+	names := m.ListDatabases()
+	results := make(map[string]error, len(names))
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			err := m.connect(ctx, name)
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(name)
 	}
+	wg.Wait()
+	return results
+}
 
-	return m, nil
+// connect opens and pings a pool for name without holding the lock, then
+// stores it unless another caller got there first or a Reload changed the
+// configuration it was made from meanwhile.
+func (m *Manager) connect(ctx context.Context, name string) error {
+	m.mu.RLock()
+	urls, gen := m.urls, m.gen
+	m.mu.RUnlock()
+	cfg, err := poolConfigFor(urls, name)
+	if err != nil {
+		return err
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return m.redact(name, err)
+	}
+	if err := pingWithRetry(ctx, pool, m.ping); err != nil {
+		pool.Close()
+		return m.redact(name, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.pools[name]; (ok && p != nil) || m.gen != gen {
+		pool.Close()
+		return nil
+	}
+	m.pools[name] = pool
+	return nil
+}
+
+func (m *Manager) poolConfig(name string) (*pgxpool.Config, error) {
+	m.mu.RLock()
+	urls := m.urls
+	m.mu.RUnlock()
+	return poolConfigFor(urls, name)
 }
 
-func pingWithRetry(ctx context.Context, pool *pgxpool.Pool) error {
+func poolConfigFor(urls URLs, name string) (*pgxpool.Config, error) {
+	dsn, ok := urls.Get(name)
+	if !ok {
+		return nil, ErrDBNotConfigured
+	}
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s database URL %s: %w", name, RedactDSN(dsn), redactErr(err, dsn))
+	}
+	cfg.MaxConns = 25
+	if n := urls.maxConns(name); n > 0 {
+		cfg.MaxConns = int32(n)
+	}
+	cfg.ConnConfig.ConnectTimeout = 30 * time.Second
+	if _, ok := cfg.ConnConfig.RuntimeParams["application_name"]; !ok && urls.ApplicationName != "" {
+		cfg.ConnConfig.RuntimeParams["application_name"] = urls.ApplicationName
+	}
+	if err := applyTLS(name, cfg, urls.TLS[name]); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// PingPolicy controls how new pools are checked before use. Attempts are
+// spaced by a jittered, doubling backoff starting at Backoff.
+type PingPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+}
+
+const maxPingTimeout = 30 * time.Second
+
+func pingWithRetry(ctx context.Context, pool *pgxpool.Pool, policy PingPolicy) error {
+	if policy.Attempts < 1 {
+		policy.Attempts = 1
+	}
 	var err error
-	backoff := 500 * time.Millisecond
-	for attempt := 1; attempt <= 3; attempt++ {
-		ctxPing, cancel := context.WithTimeout(ctx, 30*time.Second)
+	backoff := policy.Backoff
+	for attempt := 1; attempt <= policy.Attempts; attempt++ {
+		ctxPing, cancel := context.WithTimeout(ctx, pingTimeout(ctx, policy.Attempts-attempt+1))
 		err = pool.Ping(ctxPing)
 		cancel()
 		if err == nil {
 			return nil
 		}
-		if attempt < 3 {
-			select {
-			case <-time.After(backoff):
-				backoff *= 2
-			case <-ctx.Done():
-				return ctx.Err()
-			}
+		if attempt == policy.Attempts {
+			break
+		}
+		// Jitter within [backoff/2, 3*backoff/2) so pools created together
+		// don't retry in lockstep against a restarting server.
+		sleep := backoff/2 + time.Duration(rand.Int63n(int64(backoff)+1))
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= sleep {
+			return err
+		}
+		select {
+		case <-time.After(sleep):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 	return err
 }
 
+// pingTimeout splits what is left of ctx's deadline over the remaining
+// attempts, capped at maxPingTimeout.
+func pingTimeout(ctx context.Context, remaining int) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return maxPingTimeout
+	}
+	t := time.Until(deadline) / time.Duration(remaining)
+	if t > maxPingTimeout {
+		t = maxPingTimeout
+	}
+	return t
+}
+
 func (m *Manager) ListDatabases() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.urls.ListConfigured()
 }
 
-func (m *Manager) getOrCreatePool(ctx context.Context, name string) (*pgxpool.Pool, error) {
-	if p, ok := m.pools[name]; ok && p != nil {
-		return p, nil
+// RedactedURLs returns the connection string of each configured database
+// with its password masked.
+func (m *Manager) RedactedURLs() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string]string)
+	for _, name := range m.urls.ListConfigured() {
+		dsn, _ := m.urls.Get(name)
+		out[name] = RedactDSN(dsn)
 	}
-	dsn, ok := m.urls.Get(name)
-	if !ok {
-		return nil, ErrDBNotConfigured
-	}
-	cfg, err := pgxpool.ParseConfig(dsn)
-	if err != nil {
-		return nil, err
-	}
-	cfg.MaxConns = 25
-	cfg.ConnConfig.ConnectTimeout = 30 * time.Second
+	return out
+}
 
-	pool, err := pgxpool.NewWithConfig(ctx, cfg)
-	if err != nil {
-		return nil, err
-	}
-	if err := pingWithRetry(ctx, pool); err != nil {
-		pool.Close()
-		return nil, err
+// getOrCreatePool returns name's pool, connecting it first if need be. The
+// connection is made without holding the lock, so a database that is slow
+// or unreachable does not hold up lookups of the others.
+func (m *Manager) getOrCreatePool(ctx context.Context, name string) (*pgxpool.Pool, error) {
+	for {
+		m.mu.RLock()
+		p, ok := m.pools[name]
+		m.mu.RUnlock()
+		if ok && p != nil {
+			return p, nil
+		}
+		if err := m.connect(ctx, name); err != nil {
+			return nil, err
+		}
 	}
-	m.pools[name] = pool
-	return pool, nil
 }
 
 func (m *Manager) TestConnection(ctx context.Context, name string) (bool, string, error) {
@@ -106,19 +233,129 @@ func (m *Manager) TestConnection(ctx context.Context, name string) (bool, string
 	defer cancel()
 	var version string
 	if err := pool.QueryRow(ctxQ, "select version()").Scan(&version); err != nil {
-		return false, "", err
+		return false, "", m.redact(name, err)
 	}
 	return true, version, nil
 }
 
+// Close closes every pool, waiting for the connections still acquired from
+// them. The pools are taken out of the manager under the lock but closed
+// after releasing it, since holders of those connections may need the lock
+// to give them back.
 func (m *Manager) Close() {
-	for _, p := range m.pools {
+	m.mu.Lock()
+	var pools []*pgxpool.Pool
+	for name, p := range m.pools {
 		if p != nil {
-			p.Close()
+			pools = append(pools, p)
 		}
+		delete(m.pools, name)
+	}
+	for p := range m.retired {
+		pools = append(pools, p)
+		delete(m.retired, p)
+	}
+	m.mu.Unlock()
+	for _, p := range pools {
+		p.Close()
 	}
 }
 
+// Pool returns name's pool for immediate use. Work that goes on using the
+// pool, like a job, takes it with Lease instead, so a Reload cannot close
+// it in the meantime.
 func (m *Manager) Pool(ctx context.Context, name string) (*pgxpool.Pool, error) {
 	return m.getOrCreatePool(ctx, name)
 }
+
+// Lease returns name's pool and a func to call once done with it. Until
+// then, a Reload that replaces the pool leaves it open.
+func (m *Manager) Lease(ctx context.Context, name string) (*pgxpool.Pool, func(), error) {
+	for {
+		pool, err := m.getOrCreatePool(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		m.mu.Lock()
+		if m.pools[name] != pool {
+			// Replaced by a Reload since it was looked up.
+			m.mu.Unlock()
+			continue
+		}
+		m.leases[pool]++
+		m.mu.Unlock()
+		var once sync.Once
+		return pool, func() { once.Do(func() { m.unlease(pool) }) }, nil
+	}
+}
+
+func (m *Manager) unlease(pool *pgxpool.Pool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.leases[pool]--; m.leases[pool] > 0 {
+		return
+	}
+	delete(m.leases, pool)
+	if m.retired[pool] {
+		delete(m.retired, pool)
+		go pool.Close()
+	}
+}
+
+// retireLocked closes a pool Reload or ResetPool took out of use, or
+// leaves that to the last release of a lease on it.
+func (m *Manager) retireLocked(pool *pgxpool.Pool) {
+	if m.leases[pool] > 0 {
+		m.retired[pool] = true
+		return
+	}
+	// Close waits for connections still acquired from the pool.
+	go pool.Close()
+}
+
+// Reload replaces the configured URLs. Pools for databases that were removed
+// or whose connection settings changed are closed once the connections and
+// leases jobs hold on them are released, so running jobs finish undisturbed.
+// As in NewManager, pools for new and changed databases are only connected
+// on first use, so a reload does not wait on databases nothing uses yet.
+func (m *Manager) Reload(urls URLs) (added, removed []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.urls
+	m.urls = urls
+	m.gen++
+	for _, name := range old.ListConfigured() {
+		dsn, ok := urls.Get(name)
+		oldDSN, _ := old.Get(name)
+		if urls.maxConns(name) != old.maxConns(name) {
+			// Connections still out hold the old limit's slots and
+			// release into it; new ones wait on the new limit.
+			delete(m.limits, name)
+		}
+		if ok && dsn == oldDSN && urls.TLS[name] == old.TLS[name] && urls.ApplicationName == old.ApplicationName && urls.maxConns(name) == old.maxConns(name) {
+			continue
+		}
+		if !ok {
+			removed = append(removed, name)
+		}
+		if p, ok := m.pools[name]; ok && p != nil {
+			m.retireLocked(p)
+		}
+		delete(m.pools, name)
+	}
+	for _, name := range urls.ListConfigured() {
+		if _, ok := old.Get(name); !ok {
+			added = append(added, name)
+		}
+	}
+	return added, removed
+}
+
+// redact scrubs name's DSN and password from err so it is safe to log or
+// return to API clients.
+func (m *Manager) redact(name string, err error) error {
+	m.mu.RLock()
+	dsn, _ := m.urls.Get(name)
+	m.mu.RUnlock()
+	return redactErr(err, dsn)
+}
@@ -0,0 +1,252 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// refusedURL points at a port nothing listens on, so connecting fails at
+// once rather than after the connect timeout.
+func refusedURL(db string) string {
+	return "postgres://test@127.0.0.1:1/" + db + "?connect_timeout=1"
+}
+
+// newTestManager returns a Manager for localhost at refusedURL("a") with an
+// unconnected pool already in place, as if it had been created earlier.
+func newTestManager(t *testing.T) (*Manager, *pgxpool.Pool) {
+	t.Helper()
+	ctx := context.Background()
+	m, err := NewManager(ctx, URLs{Localhost: refusedURL("a")}, PingPolicy{Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	cfg, err := poolConfigFor(m.urls, DBNameLocalhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NewWithConfig does not connect until the pool is used.
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.pools[DBNameLocalhost] = pool
+	return m, pool
+}
+
+func poolClosed(p *pgxpool.Pool) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	c, err := p.Acquire(ctx)
+	if err == nil {
+		c.Release()
+		return false
+	}
+	return strings.Contains(err.Error(), "closed pool")
+}
+
+func TestReloadClosesLeasedPoolOnRelease(t *testing.T) {
+	m, pool := newTestManager(t)
+	leased, release, err := m.Lease(context.Background(), DBNameLocalhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leased != pool {
+		t.Fatal("Lease returned another pool than the current one")
+	}
+
+	m.Reload(URLs{Localhost: refusedURL("b")})
+	if poolClosed(pool) {
+		t.Fatal("Reload closed a pool that is still leased")
+	}
+	release()
+	release() // a second call is a no-op
+	for deadline := time.Now().Add(5 * time.Second); !poolClosed(pool); {
+		if time.Now().After(deadline) {
+			t.Fatal("replaced pool not closed after its lease was released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReloadClosesUnleasedPool(t *testing.T) {
+	m, pool := newTestManager(t)
+	m.Reload(URLs{Localhost: refusedURL("b")})
+	for deadline := time.Now().Add(5 * time.Second); !poolClosed(pool); {
+		if time.Now().After(deadline) {
+			t.Fatal("replaced pool not closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	m, _ := newTestManager(t)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				switch {
+				case i == 0 && j%20 == 0:
+					m.Reload(URLs{Localhost: refusedURL(fmt.Sprint("db", j))})
+				case i%2 == 0:
+					if _, release, err := m.Lease(ctx, DBNameLocalhost); err == nil {
+						release()
+					}
+				default:
+					m.Pool(ctx, DBNameLocalhost)
+					m.ListDatabases()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestUnreachableDatabaseDoesNotBlockOthers(t *testing.T) {
+	ctx := context.Background()
+	m, err := NewManager(ctx, URLs{Localhost: refusedURL("a"), Dev: refusedURL("b")}, PingPolicy{Attempts: 3, Backoff: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	cfg, err := poolConfigFor(m.urls, DBNameDev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.pools[DBNameDev] = dev
+
+	// Retrying localhost takes at least a second of backoff.
+	go m.Pool(ctx, DBNameLocalhost)
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if p, err := m.Pool(ctx, DBNameDev); err != nil || p != dev {
+		t.Fatalf("Pool(dev) = %v, %v", p, err)
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Errorf("Pool(dev) took %v while localhost was being connected", d)
+	}
+}
+
+func TestResetPoolLeavesLeasedPoolOpen(t *testing.T) {
+	m, pool := newTestManager(t)
+	_, release, err := m.Lease(context.Background(), DBNameLocalhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.ResetPool(DBNameLocalhost)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ResetPool blocked on a leased pool")
+	}
+	m.mu.RLock()
+	_, cached := m.pools[DBNameLocalhost]
+	m.mu.RUnlock()
+	if cached {
+		t.Error("ResetPool left the pool in use")
+	}
+	if poolClosed(pool) {
+		t.Fatal("ResetPool closed a pool that is still leased")
+	}
+	release()
+	for deadline := time.Now().Add(5 * time.Second); !poolClosed(pool); {
+		if time.Now().After(deadline) {
+			t.Fatal("reset pool not closed after its lease was released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestCloseWaitsForConnectionsWithoutTheLock closes the manager while a job
+// holds a connection and its lease, which the job releases lease first.
+func TestCloseWaitsForConnectionsWithoutTheLock(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	m, err := NewManager(ctx, URLs{Localhost: url}, PingPolicy{Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, release, err := m.Lease(ctx, DBNameLocalhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	released := make(chan struct{})
+	go func() {
+		release()
+		close(released)
+	}()
+	select {
+	case <-released:
+	case <-time.After(5 * time.Second):
+		t.Fatal("releasing a lease blocked on Close")
+	}
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a connection was still acquired")
+	default:
+	}
+	conn.Release()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return once the connection was released")
+	}
+}
+
+func TestReloadConnectsLazily(t *testing.T) {
+	m, _ := newTestManager(t)
+	// Dev points at a server that never answers, which Reload must not
+	// wait on.
+	start := time.Now()
+	added, removed := m.Reload(URLs{Localhost: refusedURL("a"), Dev: "postgres://test@10.255.255.1:5432/b?connect_timeout=30"})
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Reload took %v", d)
+	}
+	if len(added) != 1 || added[0] != DBNameDev || len(removed) != 0 {
+		t.Errorf("Reload = added %q, removed %q, want added [dev]", added, removed)
+	}
+	m.mu.RLock()
+	_, devPool := m.pools[DBNameDev]
+	_, localPool := m.pools[DBNameLocalhost]
+	m.mu.RUnlock()
+	if devPool {
+		t.Error("Reload connected the newly added database")
+	}
+	if !localPool {
+		t.Error("Reload dropped the pool of an unchanged database")
+	}
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const redacted = "****"
+
+var kvPasswordRe = regexp.MustCompile(`(?i)(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// RedactDSN returns dsn with its password replaced by ****. Both URL
+// ("postgres://user:pw@host/db") and keyword/value ("password=pw") forms
+// are handled.
+func RedactDSN(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "postgres://" + redacted
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		q := u.Query()
+		if q.Get("password") != "" {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+		return strings.Replace(u.String(), url.QueryEscape(redacted), redacted, -1)
+	}
+	return kvPasswordRe.ReplaceAllString(dsn, "${1}"+redacted)
+}
+
+// dsnPasswords returns the password literals in dsn, in the forms they may
+// appear in error text.
+func dsnPasswords(dsn string) []string {
+	var out []string
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if pw, ok := u.User.Password(); ok && pw != "" {
+			out = append(out, pw, url.UserPassword("", pw).String()[1:])
+		}
+		if pw := u.Query().Get("password"); pw != "" {
+			out = append(out, pw)
+		}
+	}
+	for _, m := range kvPasswordRe.FindAllStringSubmatch(dsn, -1) {
+		out = append(out, strings.Trim(m[2], "'"))
+	}
+	return out
+}
+
+// redactedError hides the DSN's password from the message while keeping
+// the original error available to errors.Is/As.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactErr scrubs any occurrence of dsn or its password from err's message.
+func redactErr(err error, dsn string) error {
+	if err == nil || dsn == "" {
+		return err
+	}
+	msg := strings.ReplaceAll(err.Error(), dsn, RedactDSN(dsn))
+	for _, pw := range dsnPasswords(dsn) {
+		if pw != "" {
+			msg = strings.ReplaceAll(msg, pw, redacted)
+		}
+	}
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func applyTLS(name string, cfg *pgxpool.Config, s TLSSettings) error {
+	if s.IsZero() {
+		return nil
+	}
+	mode := s.SSLMode
+	if mode == "" {
+		mode = "verify-full"
+	}
+	if mode == "require" && s.RootCert != "" {
+		// As in libpq, a root cert makes require check the chain.
+		mode = "verify-ca"
+	}
+
+	var tlsConfig *tls.Config
+	switch mode {
+	case "disable":
+		applyTLSConfig(cfg, nil, false)
+		return nil
+	case "require":
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	case "verify-ca", "verify-full":
+		tlsConfig = &tls.Config{ServerName: cfg.ConnConfig.Host}
+	default:
+		return fmt.Errorf("%s database: unsupported sslmode %q", name, mode)
+	}
+
+	if s.RootCert != "" {
+		pem, err := os.ReadFile(s.RootCert)
+		if err != nil {
+			return fmt.Errorf("%s database: read ssl root cert %q: %w", name, s.RootCert, err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s database: no certificates found in ssl root cert %q", name, s.RootCert)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if mode == "verify-ca" {
+		// verify-ca checks the chain but not the hostname, which crypto/tls
+		// only supports through a custom verifier.
+		roots := tlsConfig.RootCAs
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("server presented no certificate")
+			}
+			certs := make([]*x509.Certificate, len(rawCerts))
+			for i, raw := range rawCerts {
+				c, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs[i] = c
+			}
+			opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+			for _, c := range certs[1:] {
+				opts.Intermediates.AddCert(c)
+			}
+			_, err := certs[0].Verify(opts)
+			return err
+		}
+	}
+
+	if s.ClientCert != "" || s.ClientKey != "" {
+		if s.ClientCert == "" || s.ClientKey == "" {
+			return fmt.Errorf("%s database: both ssl client cert and key must be set", name)
+		}
+		for _, p := range []string{s.ClientCert, s.ClientKey} {
+			if _, err := os.Stat(p); err != nil {
+				return fmt.Errorf("%s database: ssl client file %q: %w", name, p, err)
+			}
+		}
+		cert, err := tls.LoadX509KeyPair(s.ClientCert, s.ClientKey)
+		if err != nil {
+			return fmt.Errorf("%s database: load ssl client cert: %w", name, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	applyTLSConfig(cfg, tlsConfig, mode == "verify-full")
+	return nil
+}
+
+// applyTLSConfig sets tlsConfig on the connection and on each of its
+// fallbacks, naming each host as the server to verify when perHost is set.
+// The fallbacks are the other hosts of a multi-host URL and, for sslmode
+// prefer or allow, the same hosts again without TLS; those become duplicates
+// here and are dropped, so no attempt goes around the configured TLS.
+func applyTLSConfig(cfg *pgxpool.Config, tlsConfig *tls.Config, perHost bool) {
+	forHost := func(host string) *tls.Config {
+		if tlsConfig == nil || !perHost {
+			return tlsConfig
+		}
+		c := tlsConfig.Clone()
+		c.ServerName = host
+		return c
+	}
+	cc := cfg.ConnConfig
+	cc.TLSConfig = forHost(cc.Host)
+	seen := map[string]bool{net.JoinHostPort(cc.Host, strconv.Itoa(int(cc.Port))): true}
+	var fallbacks []*pgconn.FallbackConfig
+	for _, fb := range cc.Fallbacks {
+		addr := net.JoinHostPort(fb.Host, strconv.Itoa(int(fb.Port)))
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		fallbacks = append(fallbacks, &pgconn.FallbackConfig{Host: fb.Host, Port: fb.Port, TLSConfig: forHost(fb.Host)})
+	}
+	cc.Fallbacks = fallbacks
+}
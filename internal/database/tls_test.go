@@ -0,0 +1,102 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// writeRootCert writes a self-signed CA certificate and returns its path.
+func writeRootCert(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "root.crt")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApplyTLS(t *testing.T) {
+	root := writeRootCert(t)
+	tests := []struct {
+		name string
+		s    TLSSettings
+		// wantTLS is false when connections go without TLS, verified is
+		// whether the chain is checked and perHost whether each host's
+		// name is.
+		wantTLS, verified, perHost bool
+	}{
+		{"disable", TLSSettings{SSLMode: "disable"}, false, false, false},
+		{"require", TLSSettings{SSLMode: "require"}, true, false, false},
+		{"require with root cert", TLSSettings{SSLMode: "require", RootCert: root}, true, true, false},
+		{"verify-ca", TLSSettings{SSLMode: "verify-ca", RootCert: root}, true, true, false},
+		{"verify-full", TLSSettings{SSLMode: "verify-full", RootCert: root}, true, true, true},
+		{"default", TLSSettings{RootCert: root}, true, true, true},
+	}
+	for _, tt := range tests {
+		cfg, err := pgxpool.ParseConfig("postgres://u@db1:5432,db2:5433/app?sslmode=prefer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := applyTLS("test", cfg, tt.s); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		cc := cfg.ConnConfig
+		if len(cc.Fallbacks) != 1 || cc.Fallbacks[0].Host != "db2" || cc.Fallbacks[0].Port != 5433 {
+			t.Errorf("%s: fallbacks = %+v, want db2:5433 only", tt.name, cc.Fallbacks)
+			continue
+		}
+		for _, h := range []struct {
+			host string
+			tc   *tls.Config
+		}{{"db1", cc.TLSConfig}, {"db2", cc.Fallbacks[0].TLSConfig}} {
+			host, tc := h.host, h.tc
+			if (tc != nil) != tt.wantTLS {
+				t.Errorf("%s: %s uses TLS %t, want %t", tt.name, host, tc != nil, tt.wantTLS)
+				continue
+			}
+			if tc == nil {
+				continue
+			}
+			// The chain is checked by crypto/tls itself or, when it skips
+			// verification, by a verifier of our own.
+			if verified := !tc.InsecureSkipVerify || tc.VerifyPeerCertificate != nil; verified != tt.verified {
+				t.Errorf("%s: %s checks the certificate chain %t, want %t", tt.name, host, verified, tt.verified)
+			}
+			if tt.verified && tc.RootCAs == nil {
+				t.Errorf("%s: %s ignores the root cert", tt.name, host)
+			}
+			if perHost := !tc.InsecureSkipVerify && tc.ServerName == host; perHost != tt.perHost {
+				t.Errorf("%s: %s checks the hostname %t (server name %q), want %t", tt.name, host, perHost, tc.ServerName, tt.perHost)
+			}
+		}
+	}
+}
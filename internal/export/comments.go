@@ -0,0 +1,43 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// exportComments writes COMMENT ON TABLE/COLUMN statements for the given
+// tables. Generated and dropped columns are skipped along with uncommented
+// objects.
+func exportComments(ctx context.Context, db querier, w io.Writer, schema string, tables []string) error {
+	q := `
+		SELECT c.relname, a.attname, d.description
+		FROM pg_description d
+		JOIN pg_class c ON c.oid = d.objoid AND d.classoid = 'pg_class'::regclass
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = d.objsubid AND d.objsubid > 0
+		WHERE n.nspname = $1 AND c.relname = ANY($2)
+		  AND (d.objsubid = 0 OR (a.attname IS NOT NULL AND NOT a.attisdropped))
+		ORDER BY c.relname, d.objsubid`
+	rows, err := db.Query(ctx, q, schema, tables)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, desc string
+		var col *string
+		if err := rows.Scan(&table, &col, &desc); err != nil {
+			return err
+		}
+		if col == nil {
+			_, err = fmt.Fprintf(w, "COMMENT ON TABLE %s IS %s;\n", quoteIdent(table), sqlString(desc))
+		} else {
+			_, err = fmt.Fprintf(w, "COMMENT ON COLUMN %s.%s IS %s;\n", quoteIdent(table), quoteIdent(*col), sqlString(desc))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
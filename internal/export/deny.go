@@ -0,0 +1,41 @@
+package export
+
+import "log"
+
+// SetDenyTables installs the server-wide deny list: these tables, and the
+// partitions of any that are partitioned, are never exported, whatever a
+// request includes. Call it before the Exporter is used.
+func (e *Exporter) SetDenyTables(tables []string) {
+	e.deny = make(map[string]bool, len(tables))
+	for _, t := range tables {
+		e.deny[t] = true
+	}
+}
+
+// denied reports whether table, or a partitioned table it belongs to, is on
+// the deny list.
+func (e *Exporter) denied(table string, parts partitions) bool {
+	for t, d := table, 0; t != "" && d < 32; t, d = parts[t].Parent, d+1 {
+		if e.deny[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDeny removes denied tables from tables, logging each one a request
+// would otherwise have exported.
+func (e *Exporter) applyDeny(dbName string, tables []string, parts partitions) []string {
+	if len(e.deny) == 0 {
+		return tables
+	}
+	out := tables[:0:0]
+	for _, t := range tables {
+		if e.denied(t, parts) {
+			log.Printf("export of %s: table %s is blocked by EXPORT_DENY_TABLES", dbName, t)
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// exportDomains writes CREATE DOMAIN for the domains of schema that columns
+// of the given tables are typed as, directly or as array elements, along
+// with the domains those are based on, in creation order. CREATE DOMAIN has
+// no IF NOT EXISTS and dropping a domain would cascade to columns outside
+// the dump, so an existing domain is kept as it is.
+func exportDomains(ctx context.Context, db querier, w io.Writer, schema string, tables []string) error {
+	q := `
+		WITH RECURSIVE used(oid) AS (
+		  SELECT t.oid
+		  FROM pg_attribute a
+		  JOIN pg_class c ON c.oid = a.attrelid
+		  JOIN pg_namespace n ON n.oid = c.relnamespace
+		  JOIN pg_type at ON at.oid = a.atttypid
+		  JOIN pg_type t ON t.oid = CASE WHEN at.typtype = 'b' AND at.typcategory = 'A' THEN at.typelem ELSE at.oid END
+		  WHERE n.nspname = $1 AND c.relname = ANY($2) AND a.attnum > 0 AND NOT a.attisdropped
+		    AND t.typtype = 'd'
+		  UNION
+		  SELECT b.oid
+		  FROM used u
+		  JOIN pg_type d ON d.oid = u.oid
+		  JOIN pg_type b ON b.oid = d.typbasetype
+		  WHERE b.typtype = 'd'
+		)
+		SELECT t.typname,
+		       format_type(t.typbasetype, t.typtypmod),
+		       COALESCE(quote_ident(co.collname), ''),
+		       t.typdefault,
+		       t.typnotnull,
+		       COALESCE(ARRAY(
+		         SELECT format('CONSTRAINT %I %s', k.conname, pg_get_constraintdef(k.oid, true))
+		         FROM pg_constraint k
+		         WHERE k.contypid = t.oid AND k.contype = 'c'
+		         ORDER BY k.conname), '{}')
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		JOIN pg_type b ON b.oid = t.typbasetype
+		LEFT JOIN pg_collation co ON co.oid = t.typcollation AND t.typcollation <> b.typcollation
+		WHERE t.oid IN (SELECT oid FROM used) AND n.nspname = $1
+		ORDER BY t.oid`
+	rows, err := db.Query(ctx, q, schema, tables)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			name, base, collation string
+			def                   sql.NullString
+			notNull               bool
+			checks                []string
+		)
+		if err := rows.Scan(&name, &base, &collation, &def, &notNull, &checks); err != nil {
+			return err
+		}
+		stmt := fmt.Sprintf("CREATE DOMAIN %s AS %s", quoteIdent(name), base)
+		if collation != "" {
+			stmt += " COLLATE " + collation
+		}
+		if def.Valid {
+			stmt += " DEFAULT " + def.String
+		}
+		if notNull {
+			stmt += " NOT NULL"
+		}
+		if len(checks) > 0 {
+			stmt += "\n    " + strings.Join(checks, "\n    ")
+		}
+		if _, err := fmt.Fprintf(w, "--\n-- Domain: %s\n--\nDO $$ BEGIN\n  %s;\nEXCEPTION WHEN duplicate_object THEN NULL;\nEND $$;\n\n", quoteIdent(name), stmt); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,54 @@
+package export
+
+import (
+	"context"
+	"fmt"
+)
+
+// Estimate is the planner's idea of how much data an export would read.
+// Rows comes from table statistics and is zero for tables that were never
+// analyzed; Bytes is the on-disk size of the tables, excluding indexes.
+type Estimate struct {
+	Tables int   `json:"tables"`
+	Rows   int64 `json:"rows"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// Estimate sizes the tables Export would read with opts without reading
+// them. SampleRows is not taken into account.
+func (e *Exporter) Estimate(ctx context.Context, dbName string, opts ExportOptions) (*Estimate, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+	pool, release, err := e.mgr.Lease(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	tables, err := listTables(ctx, pool, opts.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("list tables in %s: %w", opts.Schema, err)
+	}
+	parts, err := listPartitions(ctx, pool, opts.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("list partitions in %s: %w", opts.Schema, err)
+	}
+	selected, err := parts.resolve(opts.selectTables(tables), tables)
+	if err != nil {
+		return nil, err
+	}
+	selected = parts.dataTables(e.applyDeny(dbName, selected, parts))
+
+	q := `
+select coalesce(sum(greatest(c.reltuples, 0)), 0)::bigint,
+       coalesce(sum(pg_table_size(c.oid)), 0)::bigint
+from pg_class c
+join pg_namespace n on n.oid = c.relnamespace
+where n.nspname = $1 and c.relname = any($2)`
+	est := &Estimate{Tables: len(selected)}
+	if err := pool.QueryRow(ctx, q, opts.Schema, selected).Scan(&est.Rows, &est.Bytes); err != nil {
+		return nil, err
+	}
+	return est, nil
+}
@@ -3,50 +3,58 @@ package export
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"math"
-	"sort"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/koilabcode/multiboard-sync-service/internal/database"
 )
 
-type ProgressFn func(currentTableIdx, totalTables int, tableName string, rowsExported int64)
+// PhaseData is the Phase reported while table rows are streamed.
+const PhaseData = "data"
+
+// ErrNoTables is returned by Export when the options select no table of
+// the database, rather than writing a dump with nothing in it.
+var ErrNoTables = errors.New("no tables matched the include filter")
+
+// Progress is one progress update from Export. Fields may be added; callers
+// should not rely on the set being fixed.
+type Progress struct {
+	Phase string
+	// TableIndex is the 1-based position of TableName among TotalTables
+	// tables with data. With parallelism it counts finished tables.
+	TableIndex  int
+	TotalTables int
+	TableName   string
+	// RowsExported is the rows of TableName so far, CumulativeRows the rows
+	// of all tables so far.
+	RowsExported   int64
+	CumulativeRows int64
+	// BytesWritten is how much of the dump has been written so far.
+	BytesWritten int64
+}
+
+type ProgressFn func(Progress)
 
 type Exporter struct {
-	mgr *database.Manager
+	mgr  *database.Manager
+	deny map[string]bool
 }
 
 func New(mgr *database.Manager) *Exporter {
 	return &Exporter{mgr: mgr}
 }
-func exportSequences(ctx context.Context, w io.Writer, pool *pgxpool.Pool) error {
-	fmt.Fprintln(w, "-- Sequences")
-	q := `
-		SELECT c.relname AS sequence_name
-		FROM pg_class c
-		JOIN pg_namespace n ON n.oid = c.relnamespace
-		WHERE c.relkind = 'S' AND n.nspname = 'public'
-		ORDER BY c.relname`
-	rows, err := pool.Query(ctx, q)
-	if err != nil {
-		return fmt.Errorf("exportSequences query: %w", err)
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var seq string
-		if err := rows.Scan(&seq); err != nil {
-			continue
-		}
-		fmt.Fprintf(w, "CREATE SEQUENCE IF NOT EXISTS %s;\n", quoteIdent(seq))
-	}
-	return rows.Err()
-}
 
 var includeTables = map[string]bool{
 	"Part":           true,
@@ -60,172 +68,301 @@ var includeTables = map[string]bool{
 	"Option":         true,
 }
 
+// MigrationsTable holds Prisma's migration history. It is excluded unless
+// ExportOptions.IncludeMigrations is set.
+const MigrationsTable = "_prisma_migrations"
+
 var excludeTables = map[string]bool{
-	"Profile":            true,
-	"ProfileMeta":        true,
-	"List":               true,
-	"ListPart":           true,
-	"_prisma_migrations": true,
+	"Profile":       true,
+	"ProfileMeta":   true,
+	"List":          true,
+	"ListPart":      true,
+	MigrationsTable: true,
 }
 
-func (e *Exporter) Export(ctx context.Context, dbName string, w io.Writer, progress ProgressFn) error {
-	pool, err := e.Pool(ctx, dbName)
+func (e *Exporter) Export(ctx context.Context, dbName string, w io.Writer, opts ExportOptions, progress ProgressFn) (*Manifest, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+	// The snapshot connection and every table stream are reserved
+	// together: a parallel export holding its snapshot connection while its
+	// streams wait for slots would deadlock against others doing the same.
+	conns := 1
+	if opts.Parallelism > 1 {
+		conns += opts.Parallelism
+	}
+	res, err := e.mgr.Reserve(ctx, dbName, conns)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("reserve connections: %w", err)
+	}
+	defer res.Release()
+	// Everything is read on one connection inside a single snapshot, so
+	// the dump is consistent even while the source is being written to.
+	db, err := beginReserved(ctx, res)
+	if err != nil {
+		return nil, fmt.Errorf("begin snapshot: %w", err)
 	}
-	bw := bufio.NewWriterSize(w, 1024*256)
+	defer db.Rollback(context.Background())
+	if err := database.TagSession(ctx, db, true); err != nil {
+		return nil, err
+	}
+	hasher := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(w, hasher)}
+	bw := bufio.NewWriterSize(counter, 1024*256)
 	defer bw.Flush()
 
-	fmt.Fprintf(bw, "-- Multiboard SQL export (v2)\n-- Database: %s\n-- Generated: %s\n\n", dbName, time.Now().UTC().Format(time.RFC3339))
+	manifest := &Manifest{
+		Database:          dbName,
+		GeneratedAt:       time.Now().UTC(),
+		SampleRows:        opts.SampleRows,
+		Incremental:       opts.Incremental,
+		Since:             opts.Since,
+		ConcurrentIndexes: opts.ConcurrentIndexes,
+	}
+	fmt.Fprintf(bw, "-- Multiboard SQL export (v2)\n-- Database: %s\n-- Generated: %s\n", dbName, manifest.GeneratedAt.Format(time.RFC3339))
+	if opts.SampleRows > 0 {
+		fmt.Fprintf(bw, "-- Sampled: at most %d rows per table; foreign key integrity is not guaranteed\n", opts.SampleRows)
+	}
+	if opts.Incremental {
+		since := "the beginning"
+		if opts.Since != nil {
+			since = opts.Since.UTC().Format(time.RFC3339Nano)
+		}
+		fmt.Fprintf(bw, "-- Incremental: rows with %s after %s, upserted into existing tables\n", quoteIdent(IncrementalColumn), since)
+	}
+	if opts.ConcurrentIndexes {
+		fmt.Fprintln(bw, "-- Concurrent indexes: CREATE INDEX CONCURRENTLY cannot run in a transaction; import non-transactionally")
+	}
+	if len(opts.Masking) > 0 {
+		manifest.Masked = true
+		fmt.Fprintln(bw, "-- Masked: sensitive column values have been replaced")
+	}
+	fmt.Fprintln(bw)
+	if opts.SingleTransaction {
+		fmt.Fprintln(bw, "BEGIN;")
+		fmt.Fprintln(bw, "SET session_replication_role = replica;")
+		fmt.Fprintln(bw)
+	}
 
-	tables, err := listPublicTables(ctx, pool)
+	tables, err := listTables(ctx, db, opts.Schema)
 	if err != nil {
-		return fmt.Errorf("list public tables: %w", err)
+		return nil, fmt.Errorf("list tables in %s: %w", opts.Schema, err)
 	}
-	filtered := make([]string, 0, len(tables))
-	for _, t := range tables {
-		if excludeTables[t] {
-			continue
+	parts, err := listPartitions(ctx, db, opts.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("list partitions in %s: %w", opts.Schema, err)
+	}
+	filtered, err := parts.resolve(opts.selectTables(tables), tables)
+	if err != nil {
+		return nil, err
+	}
+	filtered = e.applyDeny(dbName, filtered, parts)
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("%w for database %s", ErrNoTables, dbName)
+	}
+	dataTables := parts.dataTables(filtered)
+	total := len(dataTables)
+	report := func(p Progress) {
+		if progress == nil {
+			return
+		}
+		p.Phase = PhaseData
+		p.TotalTables = total
+		// Parallel exports add what their tables have spooled so far.
+		p.BytesWritten += counter.n + int64(bw.Buffered())
+		progress(p)
+	}
+
+	if opts.IncludeExtensions {
+		exts, err := listExtensions(ctx, db, opts.Schema, filtered)
+		if err != nil {
+			return nil, fmt.Errorf("list extensions: %w", err)
 		}
-		if includeTables[t] {
-			filtered = append(filtered, t)
+		if err := exportExtensions(bw, opts.Schema, exts); err != nil {
+			return nil, fmt.Errorf("export extensions: %w", err)
 		}
 	}
-	sort.Strings(filtered)
-	total := len(filtered)
+
+	// Domains go ahead of the tables whose columns use them.
+	if err := exportDomains(ctx, db, bw, opts.Schema, filtered); err != nil {
+		return nil, fmt.Errorf("export domains: %w", err)
+	}
+
+	// Existing tables go before the sequences are created: a sequence an
+	// earlier import's CREATE TABLE came to own would otherwise survive
+	// CREATE SEQUENCE IF NOT EXISTS only to be dropped along with its table.
+	if opts.DropsExisting() {
+		writeDropTables(bw, filtered)
+	}
+
+	// Partitions share their parent's sequences, whose values are taken
+	// from the parent across all partitions.
+	seqRefs, err := listSequenceRefs(ctx, db, opts.Schema, parts.roots(filtered))
+	if err != nil {
+		return nil, fmt.Errorf("list sequences: %w", err)
+	}
+	if err := exportSequences(ctx, bw, db, seqRefs); err != nil {
+		return nil, fmt.Errorf("export sequences: %w", err)
+	}
+	fmt.Fprintln(bw)
 
 	for _, tbl := range filtered {
-		if err := writeCreateTable(ctx, pool, bw, tbl); err != nil {
-			return fmt.Errorf("create table for %s: %w", tbl, err)
+		if err := writeCreateTable(ctx, db, bw, opts.Schema, tbl, parts[tbl], opts.DropsExisting()); err != nil {
+			return nil, fmt.Errorf("create table for %s: %w", tbl, err)
 		}
 	}
 	fmt.Fprintln(bw)
 
-	for i, tbl := range filtered {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+	if opts.IncludeComments {
+		if err := exportComments(ctx, db, bw, opts.Schema, filtered); err != nil {
+			return nil, fmt.Errorf("export comments: %w", err)
 		}
-		rows, err := streamInserts(ctx, pool, bw, tbl, func(rowsExported int64) {
-			if progress != nil {
-				progress(i+1, total, tbl, rowsExported)
-			}
-		})
+		fmt.Fprintln(bw)
+	}
+
+	if opts.Parallelism > 1 {
+		var snapshot string
+		if err := db.QueryRow(ctx, "select pg_export_snapshot()").Scan(&snapshot); err != nil {
+			return nil, fmt.Errorf("export snapshot: %w", err)
+		}
+		begin := func(ctx context.Context) (pgx.Tx, error) { return beginReserved(ctx, res) }
+		manifest.Tables, manifest.Skipped, err = exportDataParallel(ctx, begin, snapshot, bw, dataTables, opts, report)
 		if err != nil {
-			return fmt.Errorf("data for %s: %w", tbl, err)
+			return nil, err
 		}
-		if progress != nil {
-			progress(i+1, total, tbl, rows)
+	} else {
+		var doneRows int64
+		for i, tbl := range dataTables {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+			onBatch := func(rowsExported int64) {
+				report(Progress{TableIndex: i + 1, TableName: tbl, RowsExported: rowsExported, CumulativeRows: doneRows + rowsExported})
+			}
+			if opts.ContinueOnError {
+				rows, tableErr, err := streamIsolated(ctx, db, bw, tbl, opts, onBatch)
+				if err != nil {
+					return nil, fmt.Errorf("data for %s: %w", tbl, err)
+				}
+				if tableErr != nil {
+					manifest.Skipped = append(manifest.Skipped, SkippedTable{Name: tbl, Error: tableErr.Error()})
+					continue
+				}
+				manifest.Tables = append(manifest.Tables, TableManifest{Name: tbl, Rows: rows})
+				doneRows += rows
+				report(Progress{TableIndex: i + 1, TableName: tbl, RowsExported: rows, CumulativeRows: doneRows})
+				continue
+			}
+			rows, err := streamInserts(ctx, db, bw, tbl, opts, onBatch)
+			if err != nil {
+				return nil, fmt.Errorf("data for %s: %w", tbl, err)
+			}
+			manifest.Tables = append(manifest.Tables, TableManifest{Name: tbl, Rows: rows})
+			doneRows += rows
+			report(Progress{TableIndex: i + 1, TableName: tbl, RowsExported: rows, CumulativeRows: doneRows})
 		}
 	}
 	fmt.Fprintln(bw)
 
-	if err := exportSequenceUpdates(ctx, bw, pool, filtered); err != nil {
-		return fmt.Errorf("export sequence updates: %w", err)
+	if opts.Incremental {
+		if err := recordWatermarks(ctx, db, opts.Schema, manifest); err != nil {
+			return nil, fmt.Errorf("incremental watermark: %w", err)
+		}
+	}
+
+	if opts.IncludeLargeObjects {
+		if manifest.LargeObjects, err = exportLargeObjects(ctx, db, bw, opts.Schema, dataTables); err != nil {
+			return nil, fmt.Errorf("export large objects: %w", err)
+		}
+		fmt.Fprintln(bw)
+	}
+
+	if err := exportSequenceUpdates(ctx, bw, db, opts.Schema, seqRefs); err != nil {
+		return nil, fmt.Errorf("export sequence updates: %w", err)
 	}
 	fmt.Fprintln(bw)
 
 	for _, tbl := range filtered {
-		if err := exportIndexes(ctx, pool, tbl, bw); err != nil {
-			return fmt.Errorf("export indexes for %s: %w", tbl, err)
+		if err := exportIndexes(ctx, db, opts.Schema, tbl, opts.DropsExisting(), opts.ConcurrentIndexes, bw); err != nil {
+			return nil, fmt.Errorf("export indexes for %s: %w", tbl, err)
 		}
 	}
 	fmt.Fprintln(bw)
 
+	// Triggers go in after the data so they don't fire during the load.
+	if opts.IncludeRoutines {
+		if err := exportFunctions(ctx, db, bw, opts.Schema); err != nil {
+			return nil, fmt.Errorf("export functions: %w", err)
+		}
+		if err := exportTriggers(ctx, db, bw, opts.Schema, filtered); err != nil {
+			return nil, fmt.Errorf("export triggers: %w", err)
+		}
+		fmt.Fprintln(bw)
+	}
+
 	allowedSet := make(map[string]struct{}, len(filtered))
 	for _, t := range filtered {
 		allowedSet[t] = struct{}{}
 	}
-	for _, tbl := range filtered {
-		if err := exportTableConstraints(ctx, pool, tbl, allowedSet, bw); err != nil {
-			return fmt.Errorf("export constraints for %s: %w", tbl, err)
+	// Check and unique constraints go first: a foreign key may reference a
+	// unique constraint on another table.
+	for _, kinds := range [][]string{{constraintCheck, constraintUnique}, {constraintForeignKey}} {
+		for _, tbl := range filtered {
+			if err := exportTableConstraints(ctx, db, opts.Schema, tbl, allowedSet, kinds, opts.DropsExisting(), bw); err != nil {
+				return nil, fmt.Errorf("export constraints for %s: %w", tbl, err)
+			}
 		}
 	}
+	fmt.Fprintln(bw)
 
-	return bw.Flush()
+	if opts.SingleTransaction {
+		fmt.Fprintln(bw, "RESET session_replication_role;")
+		fmt.Fprintln(bw, "COMMIT;")
+		fmt.Fprintln(bw)
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	manifest.Bytes = counter.n
+	manifest.Checksum = hex.EncodeToString(hasher.Sum(nil))
+	if err := writeManifest(bw, manifest); err != nil {
+		return nil, fmt.Errorf("write manifest: %w", err)
+	}
+	return manifest, bw.Flush()
 }
 func containsAllowed(allowed map[string]struct{}, tbl string) bool {
 	_, ok := allowed[tbl]
 	return ok
 }
 
-func exportSequenceUpdates(ctx context.Context, w io.Writer, pool *pgxpool.Pool, allowedTables []string) error {
-	fmt.Fprintln(w, "-- Sequence ownership and values")
-	q := `
-WITH cols AS (
-	SELECT
-		n.nspname,
-		c.relname AS table_name,
-		a.attname AS column_name,
-		pg_get_expr(ad.adbin, ad.adrelid) AS default_expr
-	FROM pg_attribute a
-	JOIN pg_class c ON c.oid = a.attrelid
-	JOIN pg_namespace n ON n.oid = c.relnamespace
-	LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
-	WHERE n.nspname = 'public' AND a.attnum > 0 AND NOT a.attisdropped
-),
-seqs AS (
-	SELECT
-		substring(default_expr from $$nextval\('([^']+)'::regclass\)$$) AS sequence_name,
-		table_name,
-		column_name
-	FROM cols
-	WHERE default_expr LIKE 'nextval(%'
+// pg_constraint.contype values exported by exportTableConstraints.
+const (
+	constraintCheck      = "c"
+	constraintUnique     = "u"
+	constraintForeignKey = "f"
 )
-SELECT DISTINCT sequence_name, table_name, column_name
-FROM seqs
-WHERE sequence_name IS NOT NULL AND sequence_name <> ''
-ORDER BY sequence_name, table_name, column_name`
-	rows, err := pool.Query(ctx, q)
-	if err != nil {
-		return fmt.Errorf("exportSequenceUpdates query: %w", err)
-	}
-	defer rows.Close()
-	type own struct{ seq, tbl, col string }
-	allowed := make(map[string]struct{}, len(allowedTables))
-	for _, t := range allowedTables {
-		allowed[t] = struct{}{}
-	}
-	var owns []own
-	for rows.Next() {
-		var o own
-		if err := rows.Scan(&o.seq, &o.tbl, &o.col); err == nil {
-			if _, ok := allowed[o.tbl]; ok {
-				owns = append(owns, o)
-			}
-		}
-	}
-	if err := rows.Err(); err != nil {
-		return err
-	}
-	for _, o := range owns {
-		_ = o
-	}
-	for _, o := range owns {
-		sql := fmt.Sprintf(`SELECT COALESCE(MAX(%s), 0) FROM %s`, quoteIdent(o.col), quoteIdent(o.tbl))
-		var maxVal int64
-		if err := pool.QueryRow(ctx, sql).Scan(&maxVal); err != nil {
-			continue
-		}
-		fmt.Fprintf(w, "SELECT setval('%s'::regclass, %d, %t);\n", o.seq, maxVal, maxVal > 0)
-	}
-	return nil
-}
-func exportTableConstraints(ctx context.Context, pool *pgxpool.Pool, table string, allowed map[string]struct{}, w io.Writer) error {
+
+// exportTableConstraints emits the table's constraints of the given kinds.
+// Constraints inherited by a partition from its parent are skipped; the
+// parent's constraint recreates them.
+func exportTableConstraints(ctx context.Context, db querier, schema, table string, allowed map[string]struct{}, kinds []string, dropExisting bool, w io.Writer) error {
 	q := `
 		SELECT c.conname,
 		       pg_get_constraintdef(c.oid, true) AS def,
-		       rt.relname AS ref_table,
-		       rn.nspname AS ref_schema
+		       COALESCE(rt.relname, '') AS ref_table,
+		       COALESCE(rn.nspname, '') AS ref_schema
 		FROM pg_constraint c
 		JOIN pg_class t ON t.oid = c.conrelid
 		JOIN pg_namespace n ON n.oid = t.relnamespace
 		LEFT JOIN pg_class rt ON rt.oid = c.confrelid
 		LEFT JOIN pg_namespace rn ON rn.oid = rt.relnamespace
-		WHERE n.nspname='public' AND t.relname=$1 AND c.contype IN ('f')
+		WHERE n.nspname=$1 AND t.relname=$2 AND c.contype::text = ANY($3)
+		  AND c.conparentid = 0 AND c.conislocal
 		ORDER BY c.conname`
-	rows, err := pool.Query(ctx, q, table)
+	rows, err := db.Query(ctx, q, schema, table, kinds)
 	if err != nil {
 		return err
 	}
@@ -236,29 +373,125 @@ func exportTableConstraints(ctx context.Context, pool *pgxpool.Pool, table strin
 			continue
 		}
 		if refTable != "" {
-			if refSchema != "public" {
+			if refSchema != schema {
 				continue
 			}
 			if _, ok := allowed[refTable]; !ok {
 				continue
 			}
 		}
-		fmt.Fprintf(w, "ALTER TABLE %s ADD CONSTRAINT %s %s;\n", quoteIdent(table), quoteIdent(name), def)
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;", quoteIdent(table), quoteIdent(name), def)
+		if !dropExisting {
+			// ADD CONSTRAINT has no IF NOT EXISTS; tolerate an existing one
+			// so the dump can be merged into a populated schema.
+			stmt = fmt.Sprintf("DO $$ BEGIN\n  %s\nEXCEPTION WHEN duplicate_object OR duplicate_table THEN NULL;\nEND $$;", stmt)
+		}
+		fmt.Fprintln(w, stmt)
 	}
 	return rows.Err()
 }
 
+// indexIfNotExists rewrites a pg_indexes definition ("CREATE [UNIQUE] INDEX
+// name ON ...") to CREATE [UNIQUE] INDEX IF NOT EXISTS.
+func indexIfNotExists(def string) string {
+	for _, prefix := range []string{"CREATE UNIQUE INDEX ", "CREATE INDEX "} {
+		if strings.HasPrefix(def, prefix) {
+			return prefix + "IF NOT EXISTS " + def[len(prefix):]
+		}
+	}
+	return def
+}
+
+// indexConcurrently rewrites CREATE [UNIQUE] INDEX to CREATE [UNIQUE] INDEX
+// CONCURRENTLY.
+func indexConcurrently(def string) string {
+	for _, prefix := range []string{"CREATE UNIQUE INDEX ", "CREATE INDEX "} {
+		if strings.HasPrefix(def, prefix) {
+			return prefix + "CONCURRENTLY " + def[len(prefix):]
+		}
+	}
+	return def
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// querier is the read side shared by *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// beginSnapshot starts the repeatable-read, read-only transaction an
+// export reads through, on a connection taken under the database's
+// connection limit. Ending the transaction gives the connection back.
+func (e *Exporter) beginSnapshot(ctx context.Context, dbName string) (pgx.Tx, error) {
+	conn, err := e.mgr.Acquire(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	return beginReadOnly(ctx, conn)
+}
+
+// beginReserved is beginSnapshot on a connection taken under res.
+func beginReserved(ctx context.Context, res *database.Reservation) (pgx.Tx, error) {
+	conn, err := res.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return beginReadOnly(ctx, conn)
+}
+
+func beginReadOnly(ctx context.Context, conn *database.Conn) (pgx.Tx, error) {
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return &snapshotTx{Tx: tx, conn: conn}, nil
+}
+
+type snapshotTx struct {
+	pgx.Tx
+	conn *database.Conn
+}
+
+func (t *snapshotTx) Commit(ctx context.Context) error {
+	defer t.release()
+	return t.Tx.Commit(ctx)
+}
+
+func (t *snapshotTx) Rollback(ctx context.Context) error {
+	defer t.release()
+	return t.Tx.Rollback(ctx)
+}
+
+func (t *snapshotTx) release() {
+	if t.conn != nil {
+		t.conn.Release()
+		t.conn = nil
+	}
+}
+
 func (e *Exporter) Pool(ctx context.Context, name string) (*pgxpool.Pool, error) {
 	return e.mgr.Pool(ctx, name)
 }
 
-func listPublicTables(ctx context.Context, pool *pgxpool.Pool) ([]string, error) {
+func listTables(ctx context.Context, db querier, schema string) ([]string, error) {
 	sql := `
 select table_name
 from information_schema.tables
-where table_schema = 'public' and table_type='BASE TABLE'
+where table_schema = $1 and table_type='BASE TABLE'
 order by table_name`
-	rows, err := pool.Query(ctx, sql)
+	rows, err := db.Query(ctx, sql, schema)
 	if err != nil {
 		return nil, err
 	}
@@ -274,21 +507,55 @@ order by table_name`
 	return out, rows.Err()
 }
 
+const (
+	identityAlways    = "a"
+	identityByDefault = "d"
+	generatedStored   = "s"
+)
+
 type columnDef struct {
-	Name       string
-	Type       string
-	IsNullable bool
-	Default    sql.NullString
+	Name           string
+	Type           string
+	IsNullable     bool
+	Default        sql.NullString
+	Identity       string
+	Generated      string
+	GenerationExpr sql.NullString
+	IsArray        bool
+}
+
+// writeDropTables drops the tables a dump recreates, with CASCADE for the
+// views and foreign keys of other tables that depend on them.
+func writeDropTables(w io.Writer, tables []string) {
+	fmt.Fprintln(w, "-- Drop existing tables")
+	for _, tbl := range tables {
+		fmt.Fprintf(w, "DROP TABLE IF EXISTS %s CASCADE;\n", quoteIdent(tbl))
+	}
+	fmt.Fprintln(w)
 }
 
-func writeCreateTable(ctx context.Context, pool *pgxpool.Pool, w *bufio.Writer, table string) error {
-	cols, err := getColumns(ctx, pool, table)
+// writeCreateTable creates table; with dropExisting it expects
+// writeDropTables to have run and leaves out IF NOT EXISTS.
+func writeCreateTable(ctx context.Context, db querier, w *bufio.Writer, schema, table string, part partition, dropExisting bool) error {
+	cols, err := getColumns(ctx, db, schema, table)
 	if err != nil {
 		return err
 	}
 	fmt.Fprintf(w, "--\n-- Table: %s\n--\n", quoteIdent(table))
-	fmt.Fprintf(w, "DROP TABLE IF EXISTS %s CASCADE;\n", quoteIdent(table))
-	fmt.Fprintf(w, "CREATE TABLE %s (\n", quoteIdent(table))
+	create := "CREATE TABLE IF NOT EXISTS "
+	if dropExisting {
+		create = "CREATE TABLE "
+	}
+	partitionBy := ""
+	if part.Key != "" {
+		partitionBy = " PARTITION BY " + part.Key
+	}
+	if part.Parent != "" {
+		// Partitions inherit their columns from the parent.
+		fmt.Fprintf(w, "%s%s PARTITION OF %s %s%s;\n", create, quoteIdent(table), quoteIdent(part.Parent), part.Bound, partitionBy)
+		return nil
+	}
+	fmt.Fprintf(w, "%s%s (\n", create, quoteIdent(table))
 	for i, c := range cols {
 		nullStr := "NOT NULL"
 		if c.IsNullable {
@@ -299,16 +566,16 @@ func writeCreateTable(ctx context.Context, pool *pgxpool.Pool, w *bufio.Writer,
 			sep = ""
 		}
 
-		useIdentity := false
-		if (c.Name == "id" || c.Name == "Id" || c.Name == "ID") &&
-			(c.Type == "integer" || c.Type == "bigint" || c.Type == "smallint") &&
-			c.Default.Valid && strings.HasPrefix(c.Default.String, "nextval(") {
-			useIdentity = true
-		}
-
-		if useIdentity {
+		switch {
+		case c.Identity == identityAlways:
+			fmt.Fprintf(w, "  %s %s NOT NULL GENERATED ALWAYS AS IDENTITY%s\n", quoteIdent(c.Name), c.Type, sep)
+			continue
+		case c.Identity == identityByDefault || convertsToIdentity(c.Name, c.Type, c.Default.String):
 			fmt.Fprintf(w, "  %s %s NOT NULL GENERATED BY DEFAULT AS IDENTITY%s\n", quoteIdent(c.Name), c.Type, sep)
 			continue
+		case c.Generated == generatedStored:
+			fmt.Fprintf(w, "  %s %s GENERATED ALWAYS AS (%s) STORED%s\n", quoteIdent(c.Name), c.Type, c.GenerationExpr.String, sep)
+			continue
 		}
 
 		defStr := ""
@@ -317,15 +584,18 @@ func writeCreateTable(ctx context.Context, pool *pgxpool.Pool, w *bufio.Writer,
 		}
 		fmt.Fprintf(w, "  %s %s %s%s%s\n", quoteIdent(c.Name), c.Type, nullStr, defStr, sep)
 	}
-	fmt.Fprintln(w, ");")
+	fmt.Fprintf(w, ")%s;\n", partitionBy)
 	return nil
 }
 
-func getColumns(ctx context.Context, pool *pgxpool.Pool, table string) ([]columnDef, error) {
+func getColumns(ctx context.Context, db querier, schema, table string) ([]columnDef, error) {
 	q := `
 select c.column_name,
        case
+         when c.domain_name is not null and c.domain_schema = c.table_schema then quote_ident(c.domain_name)
+         when c.domain_name is not null then quote_ident(c.domain_schema) || '.' || quote_ident(c.domain_name)
          when c.data_type='USER-DEFINED' then c.udt_name
+         when c.data_type='ARRAY' then format_type(a.atttypid, a.atttypmod)
          when c.data_type='timestamp without time zone' then 'timestamp'
          when c.data_type='timestamp with time zone' then 'timestamptz'
          when c.data_type='double precision' then 'double precision'
@@ -334,11 +604,18 @@ select c.column_name,
          else c.data_type
        end as typ,
        c.is_nullable='YES' as is_nullable,
-       c.column_default
+       c.column_default,
+       a.attidentity::text,
+       a.attgenerated::text,
+       case when a.attgenerated <> '' then pg_get_expr(ad.adbin, ad.adrelid) end as generation_expr,
+       c.data_type='ARRAY' as is_array
 from information_schema.columns c
-where c.table_schema='public' and c.table_name=$1
+join pg_attribute a on a.attrelid = format('%I.%I', c.table_schema, c.table_name)::regclass
+  and a.attname = c.column_name
+left join pg_attrdef ad on ad.adrelid = a.attrelid and ad.adnum = a.attnum
+where c.table_schema=$1 and c.table_name=$2
 order by c.ordinal_position`
-	rows, err := pool.Query(ctx, q, table)
+	rows, err := db.Query(ctx, q, schema, table)
 	if err != nil {
 		return nil, err
 	}
@@ -347,7 +624,7 @@ order by c.ordinal_position`
 	for rows.Next() {
 		var cd columnDef
 		var isNullable bool
-		if err := rows.Scan(&cd.Name, &cd.Type, &isNullable, &cd.Default); err != nil {
+		if err := rows.Scan(&cd.Name, &cd.Type, &isNullable, &cd.Default, &cd.Identity, &cd.Generated, &cd.GenerationExpr, &cd.IsArray); err != nil {
 			return nil, err
 		}
 		cd.IsNullable = isNullable
@@ -356,13 +633,49 @@ order by c.ordinal_position`
 	return out, rows.Err()
 }
 
-func exportIndexes(ctx context.Context, pool *pgxpool.Pool, table string, w io.Writer) error {
+func primaryKeyColumns(ctx context.Context, db querier, schema, table string) ([]string, error) {
+	q := `
+		SELECT a.attname
+		FROM pg_constraint c
+		JOIN pg_class t ON t.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN LATERAL unnest(c.conkey) WITH ORDINALITY AS k(attnum, ord) ON true
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname=$1 AND t.relname=$2 AND c.contype='p'
+		ORDER BY k.ord`
+	rows, err := db.Query(ctx, q, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		out = append(out, col)
+	}
+	return out, rows.Err()
+}
+
+func exportIndexes(ctx context.Context, db querier, schema, table string, dropExisting, concurrently bool, w io.Writer) error {
+	// Indexes attached to an index on a partitioned parent are recreated by
+	// the parent's index, so only top-level ones are exported. Indexes
+	// backing a unique constraint come from the constraint itself.
 	q := `
 		SELECT indexdef
-		FROM pg_indexes
-		WHERE schemaname='public' AND tablename=$1
+		FROM pg_indexes x
+		WHERE schemaname=$1 AND tablename=$2
+		  AND NOT EXISTS (
+			SELECT 1 FROM pg_inherits i
+			WHERE i.inhrelid = format('%I.%I', x.schemaname, x.indexname)::regclass)
+		  AND NOT EXISTS (
+			SELECT 1 FROM pg_constraint k
+			WHERE k.conindid = format('%I.%I', x.schemaname, x.indexname)::regclass
+			  AND k.contype = 'u')
 		ORDER BY indexname`
-	rows, err := pool.Query(ctx, q, table)
+	rows, err := db.Query(ctx, q, schema, table)
 	if err != nil {
 		return err
 	}
@@ -372,85 +685,284 @@ func exportIndexes(ctx context.Context, pool *pgxpool.Pool, table string, w io.W
 		if err := rows.Scan(&def); err != nil {
 			continue
 		}
+		// Indexes on partitioned tables cannot be built concurrently.
+		partitioned := strings.Contains(def, " ON ONLY ")
+		def = recursiveIndexDef(def)
+		if !dropExisting {
+			def = indexIfNotExists(def)
+		}
+		if concurrently && !partitioned {
+			def = indexConcurrently(def)
+		}
 		fmt.Fprintln(w, def+";")
 	}
 	return rows.Err()
 }
 
-func streamInserts(ctx context.Context, pool *pgxpool.Pool, w *bufio.Writer, table string, onBatch func(rowsExported int64)) (int64, error) {
-	cols, err := getColumns(ctx, pool, table)
+// streamInserts writes the INSERTs for table's rows. It reads through a
+// cursor, so db must be a transaction.
+func streamInserts(ctx context.Context, db pgx.Tx, w *bufio.Writer, table string, opts ExportOptions, onBatch func(rowsExported int64)) (int64, error) {
+	cols, err := getColumns(ctx, db, opts.Schema, table)
 	if err != nil {
 		return 0, err
 	}
-	colNames := make([]string, len(cols))
-	for i, c := range cols {
-		colNames[i] = c.Name
+	colNames := make([]string, 0, len(cols))
+	selectCols := make([]string, 0, len(cols))
+	updatable := make([]string, 0, len(cols))
+	overriding := false
+	for _, c := range cols {
+		if c.Generated != "" {
+			continue
+		}
+		if c.Identity == identityAlways {
+			overriding = true
+		} else {
+			updatable = append(updatable, c.Name)
+		}
+		colNames = append(colNames, c.Name)
+		// Arrays are read in their text form ('{a,"b c",NULL}'), which the
+		// INSERT casts back to the column type, so element types, NULLs and
+		// dimensions round-trip without rendering them here.
+		if c.IsArray {
+			selectCols = append(selectCols, quoteIdent(c.Name)+"::text")
+		} else {
+			selectCols = append(selectCols, quoteIdent(c.Name))
+		}
 	}
-	selectSQL := fmt.Sprintf(`select %s from %s`, joinQuoted(colNames), quoteIdent(table))
-	rows, err := pool.Query(ctx, selectSQL)
-	if err != nil {
+	var pk []string
+	if opts.SampleRows > 0 || opts.OrderRows || opts.ConflictStrategy != ConflictNone {
+		if pk, err = primaryKeyColumns(ctx, db, opts.Schema, table); err != nil {
+			return 0, err
+		}
+	}
+	orderBy := pk
+	if byCols, ok := opts.OrderBy[table]; ok {
+		for _, c := range byCols {
+			if !hasColumn(cols, c) {
+				return 0, fmt.Errorf("orderBy: %s has no column %q", table, c)
+			}
+		}
+		orderBy = byCols
+	}
+	conflict := conflictClause(opts.ConflictStrategy, pk, updatable)
+	selectSQL := fmt.Sprintf(`select %s from %s.%s`, strings.Join(selectCols, ", "), quoteIdent(opts.Schema), quoteIdent(table))
+	if opts.Incremental && opts.Since != nil && hasColumn(cols, IncrementalColumn) {
+		selectSQL += fmt.Sprintf(" where %s > %s", quoteIdent(IncrementalColumn), literal(*opts.Since))
+	}
+	if (opts.SampleRows > 0 || opts.OrderRows || len(opts.OrderBy[table]) > 0) && len(orderBy) > 0 {
+		selectSQL += " order by " + joinQuoted(orderBy)
+	}
+	if opts.SampleRows > 0 {
+		selectSQL += fmt.Sprintf(" limit %d", opts.SampleRows)
+	}
+	masks := opts.Masking.columnMasks(table, colNames)
+
+	// Read through a server-side cursor so neither side materializes more
+	// than cursorFetchRows rows of a huge table at once.
+	if _, err := db.Exec(ctx, "declare export_cur no scroll cursor for "+selectSQL); err != nil {
 		return 0, err
 	}
-	defer rows.Close()
+	fetchSQL := fmt.Sprintf("fetch forward %d from export_cur", cursorFetchRows)
 
-	const batchSize = 500
+	batchSize := rowsPerStatement(opts.BatchSize, len(colNames))
 	var (
-		totalRows int64
-		batchCnt  int
-		valBuf    []string
+		totalRows  int64
+		batchBytes int
+		valBuf     []string
 	)
-	scanHolders := make([]any, len(cols))
-	for i := range scanHolders {
-		var anyval any
-		scanHolders[i] = &anyval
-	}
-
-	for rows.Next() {
-		values, err := rows.Values()
-		if err != nil {
-			return totalRows, err
+	flush := func() error {
+		if err := writeInsert(w, table, colNames, valBuf, overriding, conflict); err != nil {
+			return err
 		}
-		valBuf = append(valBuf, tupleToSQL(values))
-		batchCnt++
-		totalRows++
-
-		if batchCnt >= batchSize {
-			if err := writeInsert(w, table, colNames, valBuf); err != nil {
-				return totalRows, err
-			}
-			valBuf = valBuf[:0]
-			batchCnt = 0
-			if onBatch != nil {
-				onBatch(totalRows)
+		valBuf = valBuf[:0]
+		batchBytes = 0
+		if onBatch != nil {
+			onBatch(totalRows)
+		}
+		return w.Flush()
+	}
+	addRow := func(values []any) error {
+		for i, m := range masks {
+			if m != nil {
+				values[i] = applyMask(m, values[i])
 			}
-			if err := w.Flush(); err != nil {
-				return totalRows, err
+		}
+		tuple := tupleToSQL(values, opts.DollarQuoteMin)
+		if len(valBuf) > 0 && batchBytes+len(tuple) > MaxStatementBytes {
+			if err := flush(); err != nil {
+				return err
 			}
 		}
+		valBuf = append(valBuf, tuple)
+		batchBytes += len(tuple)
+		totalRows++
+		if len(valBuf) >= batchSize {
+			return flush()
+		}
+		return nil
 	}
-	if rows.Err() != nil {
-		return totalRows, rows.Err()
+	for {
+		fetched, err := fetchChunk(ctx, db, fetchSQL, addRow)
+		if err != nil {
+			return totalRows, err
+		}
+		if fetched < cursorFetchRows {
+			break
+		}
 	}
-	if batchCnt > 0 {
-		if err := writeInsert(w, table, colNames, valBuf); err != nil {
+	if len(valBuf) > 0 {
+		if err := flush(); err != nil {
 			return totalRows, err
 		}
+	}
+	if totalRows == 0 {
+		// Say so, so an empty table is not mistaken for a missing one.
+		fmt.Fprintf(w, "-- No rows in %s\n", quoteIdent(table))
 		if onBatch != nil {
-			onBatch(totalRows)
+			onBatch(0)
 		}
 	}
+	if _, err := db.Exec(ctx, "close export_cur"); err != nil {
+		return totalRows, err
+	}
 	return totalRows, nil
 }
 
-func writeInsert(w *bufio.Writer, table string, cols []string, tuples []string) error {
+// streamIsolated runs streamInserts into a temporary file under a
+// savepoint and copies the result into w only if it succeeds, so a table
+// that fails leaves neither partial INSERTs nor an aborted transaction
+// behind. A failure of that table is returned as tableErr; err means the
+// export itself cannot continue.
+func streamIsolated(ctx context.Context, db pgx.Tx, w *bufio.Writer, table string, opts ExportOptions, onBatch func(rowsExported int64)) (rows int64, tableErr, err error) {
+	f, err := os.CreateTemp("", "multiboard-export-*.sql")
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	if _, err := db.Exec(ctx, "savepoint export_table"); err != nil {
+		return 0, nil, err
+	}
+	tw := bufio.NewWriterSize(f, 1024*256)
+	rows, tableErr = streamInserts(ctx, db, tw, table, opts, onBatch)
+	if tableErr != nil {
+		if ctx.Err() != nil {
+			return 0, nil, tableErr
+		}
+		if _, err := db.Exec(ctx, "rollback to savepoint export_table"); err != nil {
+			return 0, nil, fmt.Errorf("%v; rollback to savepoint: %w", tableErr, err)
+		}
+		return 0, tableErr, nil
+	}
+	if _, err := db.Exec(ctx, "release savepoint export_table"); err != nil {
+		return 0, nil, err
+	}
+	if err := tw.Flush(); err != nil {
+		return 0, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, nil, err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return 0, nil, err
+	}
+	return rows, nil, nil
+}
+
+// cursorFetchRows is how many rows streamInserts pulls per FETCH.
+const cursorFetchRows = 10000
+
+// fetchChunk runs one FETCH and hands each row to fn, returning how many
+// rows the cursor produced.
+func fetchChunk(ctx context.Context, tx pgx.Tx, fetchSQL string, fn func([]any) error) (int, error) {
+	rows, err := tx.Query(ctx, fetchSQL)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return n, err
+		}
+		n++
+		if err := fn(values); err != nil {
+			return n, err
+		}
+	}
+	return n, rows.Err()
+}
+
+// Limits on a single generated INSERT. MaxBindParams is Postgres's cap on
+// bound parameters per statement; rows*columns is kept under it so batches
+// stay valid if inserts become parameterized. MaxStatementBytes bounds the
+// literal text of one statement, so wide tables or large values produce
+// more, smaller INSERTs instead of one enormous one.
+const (
+	MaxBindParams     = 65535
+	MaxStatementBytes = 16 << 20
+)
+
+// rowsPerStatement caps batchSize so that rows*cols stays within
+// MaxBindParams. At least one row is always allowed.
+func rowsPerStatement(batchSize, cols int) int {
+	if cols > 0 && batchSize*cols > MaxBindParams {
+		batchSize = MaxBindParams / cols
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return batchSize
+}
+
+// conflictClause builds the ON CONFLICT suffix for a strategy. Tables
+// without a primary key fall back to a target-less DO NOTHING, and so does
+// "update" when every non-key column is excluded.
+func conflictClause(strategy string, pk, updatable []string) string {
+	switch strategy {
+	case ConflictIgnore:
+	case ConflictUpdate:
+		if len(pk) == 0 {
+			break
+		}
+		isPK := make(map[string]bool, len(pk))
+		for _, c := range pk {
+			isPK[c] = true
+		}
+		var sets []string
+		for _, c := range updatable {
+			if !isPK[c] {
+				sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", quoteIdent(c), quoteIdent(c)))
+			}
+		}
+		if len(sets) > 0 {
+			return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", joinQuoted(pk), strings.Join(sets, ", "))
+		}
+	default:
+		return ""
+	}
+	if len(pk) == 0 {
+		return " ON CONFLICT DO NOTHING"
+	}
+	return fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", joinQuoted(pk))
+}
+
+func writeInsert(w *bufio.Writer, table string, cols []string, tuples []string, overriding bool, conflict string) error {
 	if len(tuples) == 0 {
 		return nil
 	}
-	fmt.Fprintf(w, "INSERT INTO %s (%s) VALUES\n", quoteIdent(table), joinQuoted(cols))
+	fmt.Fprintf(w, "INSERT INTO %s (%s)", quoteIdent(table), joinQuoted(cols))
+	if overriding {
+		fmt.Fprint(w, " OVERRIDING SYSTEM VALUE")
+	}
+	fmt.Fprintln(w, " VALUES")
 	for i, t := range tuples {
 		sep := ","
 		if i == len(tuples)-1 {
-			sep = ";"
+			sep = conflict + ";"
 		}
 		fmt.Fprintf(w, "  %s%s\n", t, sep)
 	}
@@ -469,14 +981,48 @@ func joinQuoted(names []string) string {
 	return strings.Join(out, ", ")
 }
 
-func tupleToSQL(vals []any) string {
+// tupleToSQL renders one VALUES row. Text values of at least dollarMin bytes
+// are dollar-quoted instead of escaped; zero disables that.
+func tupleToSQL(vals []any, dollarMin int) string {
 	out := make([]string, len(vals))
 	for i, v := range vals {
+		if s, ok := v.(string); ok && dollarMin > 0 && len(s) >= dollarMin {
+			out[i] = dollarQuote(s)
+			continue
+		}
 		out[i] = literal(v)
 	}
 	return "(" + strings.Join(out, ", ") + ")"
 }
 
+// dollarQuote wraps s in $tag$...$tag$ using the first tag whose delimiter
+// does not occur in s, including across the boundary with the closing
+// delimiter (a value ending in "$" cannot use $$).
+func dollarQuote(s string) string {
+	for i := 0; ; i++ {
+		tag := "$$"
+		if i > 0 {
+			tag = fmt.Sprintf("$v%d$", i)
+		}
+		if strings.Index(s+tag, tag) == len(s) {
+			return tag + s + tag
+		}
+	}
+}
+
+// specialFloat returns the literal of a NaN or infinite float, which have
+// no numeric literal form. The float8 cast also fits real columns.
+func specialFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "'NaN'::float8"
+	case f > 0:
+		return "'Infinity'::float8"
+	default:
+		return "'-Infinity'::float8"
+	}
+}
+
 func literal(v any) string {
 	if v == nil {
 		return "NULL"
@@ -497,19 +1043,28 @@ func literal(v any) string {
 		return fmt.Sprintf("%d", t)
 	case float32:
 		if math.IsNaN(float64(t)) || math.IsInf(float64(t), 0) {
-			return "NULL"
+			return specialFloat(float64(t))
 		}
-		return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", t), "0"), ".")
+		return strconv.FormatFloat(float64(t), 'g', -1, 32)
 	case float64:
 		if math.IsNaN(t) || math.IsInf(t, 0) {
-			return "NULL"
+			return specialFloat(t)
 		}
-		return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", t), "0"), ".")
+		// Shortest representation that parses back to the same value;
+		// exponents such as 1e-10 are valid SQL numeric literals.
+		return strconv.FormatFloat(t, 'g', -1, 64)
 	case time.Time:
 		return "'" + t.UTC().Format(time.RFC3339Nano) + "'"
 	case pgtype.Numeric:
-		if t.NaN {
+		switch {
+		case !t.Valid:
 			return "NULL"
+		case t.NaN:
+			return "'NaN'::numeric"
+		case t.InfinityModifier == pgtype.Infinity:
+			return "'Infinity'::numeric"
+		case t.InfinityModifier == pgtype.NegativeInfinity:
+			return "'-Infinity'::numeric"
 		}
 		intStr := t.Int.String()
 		exp := int(t.Exp)
@@ -556,7 +1111,7 @@ func literal(v any) string {
 			if !x.Valid {
 				return "NULL"
 			}
-			return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", x.Float64), "0"), ".")
+			return literal(x.Float64)
 		default:
 			return "'" + strings.ReplaceAll(fmt.Sprintf("%v", t), `'`, `''`) + "'"
 		}
@@ -0,0 +1,782 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/sqlscript"
+)
+
+// testSchema creates a schema of its own in the scratch database that
+// TEST_DATABASE_URL points to, runs ddl in it, and returns an Exporter
+// reading that database as localhost. The schema is dropped when the test
+// ends; without TEST_DATABASE_URL the test is skipped.
+func testSchema(t *testing.T, ddl string) (*Exporter, *pgxpool.Pool, string) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	mgr, err := database.NewManager(ctx, database.URLs{Localhost: url}, database.PingPolicy{Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mgr.Close)
+	pool, err := mgr.Pool(ctx, database.DBNameLocalhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("export_test_%d", time.Now().UnixNano())
+	if _, err := pool.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+	})
+	runScript(t, pool, schema, ddl)
+	return New(mgr), pool, schema
+}
+
+// runScript runs the statements of script with schema first on the
+// search path.
+func runScript(t *testing.T, pool *pgxpool.Pool, schema, script string) {
+	t.Helper()
+	ctx := context.Background()
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SET search_path = "+schema); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Exec(ctx, "RESET search_path")
+	sc := sqlscript.NewScanner(strings.NewReader(script))
+	for sc.Scan() {
+		if _, err := conn.Exec(ctx, sc.Statement()); err != nil {
+			t.Fatalf("%v\nstatement: %s", err, sc.Statement())
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exportSchema(t *testing.T, e *Exporter, schema string, opts ExportOptions) (string, *Manifest) {
+	t.Helper()
+	opts.Schema = schema
+	var buf bytes.Buffer
+	m, err := e.Export(context.Background(), database.DBNameLocalhost, &buf, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), m
+}
+
+func TestExportSequencesOfIncludedTablesOnly(t *testing.T) {
+	e, _, schema := testSchema(t, `
+		CREATE SEQUENCE shared_seq;
+		CREATE TABLE a (n serial, s bigint DEFAULT nextval('shared_seq'));
+		CREATE TABLE b (n serial, s bigint DEFAULT nextval('shared_seq'));
+		CREATE SEQUENCE b_only_seq;
+		CREATE TABLE c (s bigint DEFAULT nextval('b_only_seq'));`)
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"a", "b", "c"}, Exclude: []string{"b", "c"}})
+
+	for _, seq := range []string{"a_n_seq", "shared_seq"} {
+		if n := strings.Count(dump, "CREATE SEQUENCE IF NOT EXISTS "+schema+"."+seq+" "); n != 1 {
+			t.Errorf("CREATE SEQUENCE for %s emitted %d times, want once", seq, n)
+		}
+	}
+	for _, seq := range []string{"b_n_seq", "b_only_seq"} {
+		if strings.Contains(dump, "CREATE SEQUENCE IF NOT EXISTS "+schema+"."+seq) {
+			t.Errorf("dump creates %s, which only excluded tables use", seq)
+		}
+	}
+}
+
+func TestExportSerialAndIdentityRoundTrip(t *testing.T) {
+	e, pool, schema := testSchema(t, `
+		CREATE TABLE t (id serial PRIMARY KEY, n serial, g int GENERATED ALWAYS AS IDENTITY, v text);
+		INSERT INTO t (v) VALUES ('a'), ('b'), ('c');`)
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"t"}})
+
+	// The second import runs over the tables, and the sequences they own,
+	// that the first one left.
+	for i := 0; i < 2; i++ {
+		runScript(t, pool, schema, dump)
+	}
+	runScript(t, pool, schema, "INSERT INTO t (v) VALUES ('d')")
+
+	ctx := context.Background()
+	var id, n, g int
+	if err := pool.QueryRow(ctx, "SELECT id, n, g FROM "+schema+".t WHERE v = 'd'").Scan(&id, &n, &g); err != nil {
+		t.Fatal(err)
+	}
+	if id != 4 || n != 4 || g != 4 {
+		t.Errorf("new row got id=%d n=%d g=%d, want 4 each", id, n, g)
+	}
+	for _, col := range []string{"id", "n", "g"} {
+		var seq *string
+		if err := pool.QueryRow(ctx, "SELECT pg_get_serial_sequence($1, $2)", schema+".t", col).Scan(&seq); err != nil {
+			t.Fatal(err)
+		}
+		if seq == nil {
+			t.Errorf("column %s has no sequence of its own after the import", col)
+		}
+	}
+}
+
+func TestDollarQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain 'text'", "$$plain 'text'$$"},
+		{"has $$ inside", "$v1$has $$ inside$v1$"},
+		{"ends in $", "$v1$ends in $$v1$"},
+		{"$$ and $v1$", "$v2$$$ and $v1$$v2$"},
+	}
+	for _, tt := range tests {
+		got := dollarQuote(tt.in)
+		if got != tt.want {
+			t.Errorf("dollarQuote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		// The importer must read the constant back as a single token.
+		toks := sqlscript.Tokenize("SELECT " + got + ";")
+		if len(toks) != 4 || toks[2].Kind != sqlscript.TokenString || toks[2].Text != got {
+			t.Errorf("dollarQuote(%q) = %q does not tokenize as one string: %q", tt.in, got, toks)
+		}
+	}
+}
+
+func TestExportDollarQuotedTextRoundTrip(t *testing.T) {
+	e, pool, schema := testSchema(t, `CREATE TABLE t (id int PRIMARY KEY, v text)`)
+	values := []string{"a $$ b; DROP TABLE t; $$", "ends with $", strings.Repeat("'", 100)}
+	ctx := context.Background()
+	for i, v := range values {
+		if _, err := pool.Exec(ctx, "INSERT INTO "+schema+".t VALUES ($1, $2)", i, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"t"}, DollarQuoteMin: 1})
+	if !strings.Contains(dump, "$v1$a $$ b; DROP TABLE t; $$$v1$") {
+		t.Errorf("value with $$ was not dollar-quoted with another tag:\n%s", dump)
+	}
+	runScript(t, pool, schema, dump)
+	for i, want := range values {
+		var got string
+		if err := pool.QueryRow(ctx, "SELECT v FROM "+schema+".t WHERE id = $1", i).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("row %d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestReferencingTables(t *testing.T) {
+	_, pool, schema := testSchema(t, `
+		CREATE TABLE parent (id int PRIMARY KEY);
+		CREATE TABLE child (id int PRIMARY KEY, parent_id int REFERENCES parent);
+		CREATE TABLE other (id int PRIMARY KEY, parent_id int REFERENCES parent);
+		CREATE TABLE tree (id int PRIMARY KEY, up int REFERENCES tree);`)
+	tests := []struct {
+		table string
+		want  []string
+	}{
+		{"parent", []string{"child", "other"}},
+		{"child", nil},
+		// TRUNCATE copes with a table referencing itself.
+		{"tree", nil},
+	}
+	for _, tt := range tests {
+		got, err := ReferencingTables(context.Background(), pool, schema, tt.table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReferencingTables(%s) = %q, want %q", tt.table, got, tt.want)
+		}
+	}
+}
+
+func TestRowsPerStatement(t *testing.T) {
+	tests := []struct {
+		batch, cols, want int
+	}{
+		{500, 10, 500},
+		{500, 1000, MaxBindParams / 1000},
+		{10000, 1600, MaxBindParams / 1600},
+		{500, 0, 500},
+		{500, MaxBindParams + 1, 1},
+	}
+	for _, tt := range tests {
+		if got := rowsPerStatement(tt.batch, tt.cols); got != tt.want {
+			t.Errorf("rowsPerStatement(%d, %d) = %d, want %d", tt.batch, tt.cols, got, tt.want)
+		}
+	}
+}
+
+// insertRows returns the number of rows of each INSERT in dump.
+func insertRows(t *testing.T, dump string) []int {
+	t.Helper()
+	var out []int
+	sc := sqlscript.NewScanner(strings.NewReader(dump))
+	for sc.Scan() {
+		if stmt := sc.Statement(); strings.HasPrefix(stmt, "INSERT INTO") {
+			out = append(out, strings.Count(stmt, "\n  ("))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestExportWideTableStaysUnderParameterLimit(t *testing.T) {
+	const cols, rows = 1000, 200
+	var ddl strings.Builder
+	ddl.WriteString("CREATE TABLE wide (")
+	for i := 0; i < cols; i++ {
+		if i > 0 {
+			ddl.WriteString(", ")
+		}
+		fmt.Fprintf(&ddl, "c%d int DEFAULT %d", i, i)
+	}
+	fmt.Fprintf(&ddl, ");\nINSERT INTO wide (c0) SELECT generate_series(1, %d);", rows)
+	e, pool, schema := testSchema(t, ddl.String())
+
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"wide"}, BatchSize: MaxBatchSize})
+	total := 0
+	for _, n := range insertRows(t, dump) {
+		if n*cols > MaxBindParams {
+			t.Errorf("INSERT of %d rows has %d values, over %d", n, n*cols, MaxBindParams)
+		}
+		total += n
+	}
+	if total != rows {
+		t.Errorf("INSERTs hold %d rows, want %d", total, rows)
+	}
+	runScript(t, pool, schema, dump)
+	var n int
+	if err := pool.QueryRow(context.Background(), "SELECT count(*) FROM "+schema+".wide").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != rows {
+		t.Errorf("reimported %d rows, want %d", n, rows)
+	}
+}
+
+func TestExportSplitsLargeStatements(t *testing.T) {
+	e, _, schema := testSchema(t, fmt.Sprintf(
+		"CREATE TABLE big (v text);\nINSERT INTO big SELECT repeat('x', %d) FROM generate_series(1, 3);", MaxStatementBytes*2/5))
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"big"}})
+	// Two values fit in one statement, the third does not.
+	if got := insertRows(t, dump); !reflect.DeepEqual(got, []int{2, 1}) {
+		t.Errorf("rows per INSERT = %v, want [2 1]", got)
+	}
+}
+
+func TestExportMemoryStaysBounded(t *testing.T) {
+	if testing.Short() {
+		t.Skip("exports about 200MB")
+	}
+	const rows, width = 200000, 1000
+	e, _, schema := testSchema(t, fmt.Sprintf(
+		"CREATE TABLE huge (id int PRIMARY KEY, v text);\nINSERT INTO huge SELECT i, repeat('x', %d) FROM generate_series(1, %d) i;", width, rows))
+
+	runtime.GC()
+	var (
+		peak uint64
+		stop = make(chan struct{})
+		done = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		var ms runtime.MemStats
+		for {
+			runtime.ReadMemStats(&ms)
+			if ms.HeapInuse > peak {
+				peak = ms.HeapInuse
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}()
+	n := &countingWriter{w: io.Discard}
+	_, err := e.Export(context.Background(), database.DBNameLocalhost, n, ExportOptions{Schema: schema, Include: []string{"huge"}}, nil)
+	close(stop)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The dump is over 200MB; the heap must not grow with it.
+	const limit = 64 << 20
+	if n.n < rows*width {
+		t.Fatalf("dump is only %d bytes", n.n)
+	}
+	if peak > limit {
+		t.Errorf("heap peaked at %d MB exporting %d MB, want under %d MB", peak>>20, n.n>>20, limit>>20)
+	}
+}
+
+func TestLiteralFloats(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{1e-10, "1e-10"},
+		{1.7976931348623157e308, "1.7976931348623157e+308"},
+		{0.30000000000000004, "0.30000000000000004"},
+		{123456.789012345, "123456.789012345"},
+		{-2.5, "-2.5"},
+		{float64(0), "0"},
+		{float32(1e-10), "1e-10"},
+		{float32(0.1), "0.1"},
+		{math.NaN(), "'NaN'::float8"},
+		{math.Inf(1), "'Infinity'::float8"},
+		{math.Inf(-1), "'-Infinity'::float8"},
+		{float32(math.Inf(-1)), "'-Infinity'::float8"},
+		{sql.NullFloat64{Float64: math.NaN(), Valid: true}, "'NaN'::float8"},
+		{pgtype.Numeric{NaN: true, Valid: true}, "'NaN'::numeric"},
+		{pgtype.Numeric{InfinityModifier: pgtype.Infinity, Valid: true}, "'Infinity'::numeric"},
+		{pgtype.Numeric{InfinityModifier: pgtype.NegativeInfinity, Valid: true}, "'-Infinity'::numeric"},
+		{pgtype.Numeric{}, "NULL"},
+		{sql.NullFloat64{Float64: 1e-10, Valid: true}, "1e-10"},
+		{sql.NullFloat64{Float64: 0.123456789, Valid: true}, "0.123456789"},
+		{sql.NullFloat64{}, "NULL"},
+	}
+	for _, tt := range tests {
+		if got := literal(tt.v); got != tt.want {
+			t.Errorf("literal(%#v) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+	for _, f := range []float64{1e-300, 5e-324, 1e300, math.Pi, 1.0 / 3} {
+		got, err := strconv.ParseFloat(literal(f), 64)
+		if err != nil || got != f {
+			t.Errorf("literal(%v) = %s parses back as %v, %v", f, literal(f), got, err)
+		}
+	}
+}
+
+func TestExportFloatRoundTrip(t *testing.T) {
+	e, pool, schema := testSchema(t, `
+		CREATE TABLE f (id int PRIMARY KEY, d double precision, r real);
+		INSERT INTO f VALUES
+		  (1, 1e-10, 1e-10),
+		  (2, 1.7976931348623157e308, 3.4028235e38),
+		  (3, 0.1 + 0.2, 0.1),
+		  (4, 123456.789012345, 1234.5677),
+		  (5, 5e-324, 1e-45),
+		  (6, NULL, NULL);`)
+	ctx := context.Background()
+	read := func() map[int][2]*float64 {
+		rows, err := pool.Query(ctx, "SELECT id, d, r::float8 FROM "+schema+".f")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		out := map[int][2]*float64{}
+		for rows.Next() {
+			var id int
+			var d, r *float64
+			if err := rows.Scan(&id, &d, &r); err != nil {
+				t.Fatal(err)
+			}
+			out[id] = [2]*float64{d, r}
+		}
+		return out
+	}
+	before := read()
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"f"}})
+	runScript(t, pool, schema, dump)
+	after := read()
+	if !reflect.DeepEqual(before, after) {
+		for id, b := range before {
+			a := after[id]
+			t.Errorf("row %d: before %v %v, after %v %v", id, deref(b[0]), deref(b[1]), deref(a[0]), deref(a[1]))
+		}
+	}
+}
+
+func TestExportSpecialFloatsRoundTrip(t *testing.T) {
+	e, pool, schema := testSchema(t, `
+		CREATE TABLE f (id int PRIMARY KEY, d double precision NOT NULL, r real NOT NULL, n numeric NOT NULL);
+		INSERT INTO f VALUES
+		  (1, 'NaN', 'NaN', 'NaN'),
+		  (2, 'Infinity', 'Infinity', 1),
+		  (3, '-Infinity', '-Infinity', 2);`)
+	ctx := context.Background()
+	read := func() []string {
+		rows, err := pool.Query(ctx, "SELECT row(d, r, n)::text FROM "+schema+".f ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var out []string
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, s)
+		}
+		return out
+	}
+	before := read()
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"f"}})
+	runScript(t, pool, schema, dump)
+	if after := read(); !reflect.DeepEqual(before, after) {
+		t.Errorf("rows after the import = %q, want %q", after, before)
+	}
+}
+
+func deref(f *float64) any {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+func TestExportCheckAndUniqueConstraintsRoundTrip(t *testing.T) {
+	e, pool, schema := testSchema(t, `
+		CREATE TABLE item (
+		  id int PRIMARY KEY,
+		  code text CONSTRAINT item_code_key UNIQUE,
+		  price numeric CONSTRAINT item_price_check CHECK (price > 0));
+		CREATE TABLE line (item_code text REFERENCES item (code));
+		INSERT INTO item VALUES (1, 'a', 10);`)
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"item", "line"}})
+	for _, want := range []string{`ADD CONSTRAINT "item_price_check" CHECK`, `ADD CONSTRAINT "item_code_key" UNIQUE`} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("dump lacks %s", want)
+		}
+	}
+	// The foreign key needs the unique constraint it references.
+	if u, f := strings.Index(dump, `"item_code_key" UNIQUE`), strings.Index(dump, "FOREIGN KEY"); u < 0 || f < 0 || u > f {
+		t.Errorf("unique constraint at %d, foreign key at %d; want the unique constraint first", u, f)
+	}
+
+	runScript(t, pool, schema, dump)
+	ctx := context.Background()
+	for _, stmt := range []string{
+		"INSERT INTO " + schema + ".item VALUES (2, 'b', 0)",
+		"INSERT INTO " + schema + ".item VALUES (3, 'a', 1)",
+	} {
+		if _, err := pool.Exec(ctx, stmt); err == nil {
+			t.Errorf("%s succeeded after the import, want a constraint violation", stmt)
+		}
+	}
+}
+
+func TestExportArrayColumnsRoundTrip(t *testing.T) {
+	e, pool, schema := testSchema(t, `
+		CREATE TABLE arr (
+		  id int PRIMARY KEY,
+		  tags text[],
+		  nums int[],
+		  grid float8[][]);
+		INSERT INTO arr VALUES
+		  (1, ARRAY['a', 'b,c', 'it''s', NULL, '{x}'], ARRAY[1, 2, 3], ARRAY[[1.5, 2], [3, 4]]),
+		  (2, '{}', NULL, NULL);`)
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"arr"}})
+	for _, want := range []string{"text[]", "integer[]", "double precision[]"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("CREATE TABLE lacks a %s column:\n%s", want, dump)
+		}
+	}
+
+	ctx := context.Background()
+	read := func() []string {
+		rows, err := pool.Query(ctx, "SELECT row(tags, nums, grid)::text FROM "+schema+".arr ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var out []string
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, s)
+		}
+		return out
+	}
+	before := read()
+	runScript(t, pool, schema, dump)
+	if after := read(); !reflect.DeepEqual(before, after) {
+		t.Errorf("rows after the import = %q, want %q", after, before)
+	}
+}
+
+func TestExportEmptyTable(t *testing.T) {
+	e, _, schema := testSchema(t, `
+		CREATE TABLE empty (id int PRIMARY KEY);
+		CREATE TABLE full (id int PRIMARY KEY);
+		INSERT INTO full VALUES (1), (2);`)
+	for _, parallelism := range []int{0, 2} {
+		var reports []Progress
+		var buf bytes.Buffer
+		m, err := e.Export(context.Background(), database.DBNameLocalhost, &buf,
+			ExportOptions{Schema: schema, Include: []string{"empty", "full"}, Parallelism: parallelism},
+			func(p Progress) { reports = append(reports, p) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := map[string]int64{}
+		for _, tm := range m.Tables {
+			rows[tm.Name] = tm.Rows
+		}
+		if want := map[string]int64{"empty": 0, "full": 2}; !reflect.DeepEqual(rows, want) {
+			t.Errorf("parallelism %d: manifest rows = %v, want %v", parallelism, rows, want)
+		}
+		n := 0
+		for _, p := range reports {
+			if p.TableName == "empty" {
+				n++
+				if p.RowsExported != 0 {
+					t.Errorf("parallelism %d: progress for empty reports %d rows", parallelism, p.RowsExported)
+				}
+			}
+		}
+		if n == 0 {
+			t.Errorf("parallelism %d: progress never fired for the empty table", parallelism)
+		}
+		if !strings.Contains(buf.String(), `-- No rows in "empty"`) {
+			t.Errorf("parallelism %d: dump does not note the empty table", parallelism)
+		}
+	}
+}
+
+func TestExportDomainColumnsRoundTrip(t *testing.T) {
+	e, pool, schema := testSchema(t, `
+		CREATE DOMAIN positive AS int CHECK (VALUE > 0);
+		CREATE DOMAIN small AS positive DEFAULT 1 CHECK (VALUE < 100);
+		CREATE DOMAIN email AS text NOT NULL CONSTRAINT email_at CHECK (VALUE LIKE '%@%');
+		CREATE DOMAIN unused AS int;
+		CREATE TABLE account (id int PRIMARY KEY, qty small, emails email[], contact email);
+		INSERT INTO account VALUES (1, 5, ARRAY['a@x'], 'b@y');`)
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"account"}})
+	for _, want := range []string{`CREATE DOMAIN "positive"`, `CREATE DOMAIN "small"`, `CREATE DOMAIN "email"`} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("dump lacks %s", want)
+		}
+	}
+	if strings.Contains(dump, `"unused"`) {
+		t.Error("dump creates a domain no exported column uses")
+	}
+	// A domain comes after the one it is based on and before the table.
+	if p, s, c := strings.Index(dump, `DOMAIN "positive"`), strings.Index(dump, `DOMAIN "small"`), strings.Index(dump, "CREATE TABLE"); p > s || s > c {
+		t.Errorf("positive at %d, small at %d, CREATE TABLE at %d; want them in that order", p, s, c)
+	}
+
+	ctx := context.Background()
+	target := schema + "_copy"
+	if _, err := pool.Exec(ctx, "CREATE SCHEMA "+target); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Exec(context.Background(), "DROP SCHEMA "+target+" CASCADE") })
+	runScript(t, pool, target, dump)
+	for stmt, ok := range map[string]bool{
+		"INSERT INTO " + target + ".account (id, contact) VALUES (2, 'c@z')":  true,
+		"INSERT INTO " + target + ".account VALUES (3, 0, NULL, 'c@z')":       false,
+		"INSERT INTO " + target + ".account VALUES (4, 100, NULL, 'c@z')":     false,
+		"INSERT INTO " + target + ".account VALUES (5, 1, ARRAY['x'], 'c@z')": false,
+		"INSERT INTO " + target + ".account (id) VALUES (6)":                  false,
+	} {
+		if _, err := pool.Exec(ctx, stmt); (err == nil) != ok {
+			t.Errorf("%s: err = %v, want success %t", stmt, err, ok)
+		}
+	}
+	var qty int
+	if err := pool.QueryRow(ctx, "SELECT qty FROM "+target+".account WHERE id = 2").Scan(&qty); err != nil || qty != 1 {
+		t.Errorf("qty defaulted to %d (%v), want the domain default 1", qty, err)
+	}
+}
+
+func TestConcurrentParallelExportsUnderConnectionLimit(t *testing.T) {
+	_, _, schema := testSchema(t, `
+		CREATE TABLE a (id int PRIMARY KEY);
+		CREATE TABLE b (id int PRIMARY KEY);
+		CREATE TABLE c (id int PRIMARY KEY);
+		INSERT INTO a SELECT generate_series(1, 1000);
+		INSERT INTO b SELECT generate_series(1, 1000);
+		INSERT INTO c SELECT generate_series(1, 1000);`)
+	mgr, err := database.NewManager(context.Background(), database.URLs{
+		Localhost: os.Getenv("TEST_DATABASE_URL"),
+		MaxConns:  map[string]int{database.DBNameLocalhost: 2},
+	}, database.PingPolicy{Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+	e := New(mgr)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := e.Export(ctx, database.DBNameLocalhost, io.Discard,
+				ExportOptions{Schema: schema, Include: []string{"a", "b", "c"}, Parallelism: 3}, nil)
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExportSequenceDefinitionRoundTrip(t *testing.T) {
+	e, pool, schema := testSchema(t, `
+		CREATE SEQUENCE stepped AS integer INCREMENT BY 5 MINVALUE 10 MAXVALUE 100000 START WITH 20 CACHE 7 CYCLE;
+		CREATE SEQUENCE falling INCREMENT BY -2 CACHE 3;
+		CREATE TABLE t (a int DEFAULT nextval('stepped'), b bigint DEFAULT nextval('falling'));`)
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"t"}})
+	if !strings.Contains(dump, " AS integer INCREMENT BY 5 MINVALUE 10 MAXVALUE 100000 START WITH 20 CACHE 7 CYCLE;") {
+		t.Errorf("dump lacks the definition of stepped:\n%s", dump)
+	}
+
+	ctx := context.Background()
+	type def struct {
+		typ                               string
+		start, min, max, increment, cache int64
+		cycle                             bool
+	}
+	read := func() map[string]def {
+		rows, err := pool.Query(ctx, `
+			SELECT sequencename, data_type::text, start_value, min_value, max_value, increment_by, cache_size, cycle
+			FROM pg_sequences WHERE schemaname = $1`, schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		out := map[string]def{}
+		for rows.Next() {
+			var name string
+			var d def
+			if err := rows.Scan(&name, &d.typ, &d.start, &d.min, &d.max, &d.increment, &d.cache, &d.cycle); err != nil {
+				t.Fatal(err)
+			}
+			out[name] = d
+		}
+		return out
+	}
+	before := read()
+	runScript(t, pool, schema, "DROP TABLE t; DROP SEQUENCE stepped, falling")
+	runScript(t, pool, schema, dump)
+	if after := read(); !reflect.DeepEqual(before, after) {
+		t.Errorf("sequences after the import = %+v, want %+v", after, before)
+	}
+}
+
+func TestExportExtensionDefaultsRoundTrip(t *testing.T) {
+	e, pool, schema := testSchema(t, "")
+	ctx := context.Background()
+	// The extension is installed in a schema of its own unless the scratch
+	// database already has it, so the import only resolves its functions
+	// through the dump's search_path.
+	var extSchema string
+	err := pool.QueryRow(ctx, `
+		SELECT n.nspname FROM pg_extension e JOIN pg_namespace n ON n.oid = e.extnamespace
+		WHERE e.extname = 'uuid-ossp'`).Scan(&extSchema)
+	if err != nil {
+		extSchema = schema + "_ext"
+		if _, err := pool.Exec(ctx, "CREATE SCHEMA "+extSchema); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pool.Exec(context.Background(), "DROP SCHEMA "+extSchema+" CASCADE") })
+		if _, err := pool.Exec(ctx, `CREATE EXTENSION "uuid-ossp" WITH SCHEMA `+extSchema); err != nil {
+			t.Skipf("uuid-ossp is not available: %v", err)
+		}
+	}
+	runScript(t, pool, schema, `CREATE TABLE t (
+		id uuid PRIMARY KEY DEFAULT `+quoteIdent(extSchema)+`.uuid_generate_v4(),
+		token uuid DEFAULT gen_random_uuid(),
+		v text)`)
+
+	dump, _ := exportSchema(t, e, schema, ExportOptions{Include: []string{"t"}})
+	if strings.Contains(dump, "CREATE EXTENSION") {
+		t.Error("dump creates extensions without IncludeExtensions")
+	}
+	dump, _ = exportSchema(t, e, schema, ExportOptions{Include: []string{"t"}, IncludeExtensions: true})
+	want := `CREATE EXTENSION IF NOT EXISTS "uuid-ossp" WITH SCHEMA ` + quoteIdent(extSchema) + ";"
+	ext, path, create := strings.Index(dump, want), strings.Index(dump, "SET search_path"), strings.Index(dump, "CREATE TABLE")
+	if ext < 0 || path < 0 || ext > path || path > create {
+		t.Fatalf("want %s and SET search_path ahead of CREATE TABLE:\n%s", want, dump)
+	}
+
+	runScript(t, pool, schema, "DROP TABLE t")
+	runScript(t, pool, schema, dump)
+	var id, token *string
+	if err := pool.QueryRow(ctx, "INSERT INTO "+schema+".t (v) VALUES ('a') RETURNING id::text, token::text").Scan(&id, &token); err != nil {
+		t.Fatal(err)
+	}
+	if id == nil || token == nil {
+		t.Errorf("defaults after the import gave id=%v token=%v", id, token)
+	}
+}
+
+func TestSelectTables(t *testing.T) {
+	tables := []string{"Part", "Tag", "Profile", "_prisma_migrations", "other"}
+	tests := []struct {
+		name string
+		opts ExportOptions
+		want []string
+	}{
+		{"defaults", ExportOptions{}, []string{"Part", "Tag"}},
+		{"include", ExportOptions{Include: []string{"other", "Tag"}}, []string{"Tag", "other"}},
+		{"exclude", ExportOptions{Exclude: []string{"Tag"}}, []string{"Part"}},
+		{"migrations", ExportOptions{IncludeMigrations: true}, []string{"Part", "Tag", "_prisma_migrations"}},
+		{"excluded by default", ExportOptions{Include: []string{"Profile"}}, nil},
+		{"no match", ExportOptions{Include: []string{"missing"}}, nil},
+		{"all excluded", ExportOptions{Exclude: []string{"Part", "Tag"}}, nil},
+	}
+	for _, tt := range tests {
+		got := tt.opts.selectTables(tables)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: selectTables = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExportFailsWhenNoTableMatches(t *testing.T) {
+	e, _, schema := testSchema(t, `CREATE TABLE t (id int)`)
+	for _, opts := range []ExportOptions{
+		{Schema: schema, Include: []string{"missing"}},
+		{Schema: schema, Include: []string{"t"}, Exclude: []string{"t"}},
+		{Schema: schema},
+	} {
+		var buf bytes.Buffer
+		_, err := e.Export(context.Background(), database.DBNameLocalhost, &buf, opts, nil)
+		if !errors.Is(err, ErrNoTables) {
+			t.Errorf("Export with %+v = %v, want ErrNoTables", opts, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), database.DBNameLocalhost) {
+			t.Errorf("error %q does not name the database", err)
+		}
+	}
+}
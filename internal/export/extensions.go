@@ -0,0 +1,87 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type extension struct {
+	Name, Schema string
+}
+
+// listExtensions returns the installed extensions that the given tables of
+// schema depend on: through column types, defaults, constraints or indexes
+// (e.g. a uuid_generate_v4() default or a gin_trgm_ops index), or through
+// the domains of schema those columns may be typed as.
+func listExtensions(ctx context.Context, db querier, schema string, tables []string) ([]extension, error) {
+	q := `
+		WITH rels AS (
+		  SELECT c.oid
+		  FROM pg_class c
+		  JOIN pg_namespace n ON n.oid = c.relnamespace
+		  WHERE n.nspname = $1 AND c.relname = ANY($2)
+		),
+		objs(classid, objid) AS (
+		  SELECT 'pg_class'::regclass, oid FROM rels
+		  UNION ALL
+		  SELECT 'pg_attrdef'::regclass, ad.oid FROM pg_attrdef ad WHERE ad.adrelid IN (SELECT oid FROM rels)
+		  UNION ALL
+		  SELECT 'pg_constraint'::regclass, k.oid FROM pg_constraint k WHERE k.conrelid IN (SELECT oid FROM rels)
+		  UNION ALL
+		  SELECT 'pg_class'::regclass, i.indexrelid FROM pg_index i WHERE i.indrelid IN (SELECT oid FROM rels)
+		  UNION ALL
+		  SELECT 'pg_type'::regclass, t.oid
+		  FROM pg_type t
+		  JOIN pg_namespace n ON n.oid = t.typnamespace
+		  WHERE n.nspname = $1 AND t.typtype = 'd'
+		)
+		SELECT DISTINCT e.extname, en.nspname
+		FROM objs o
+		JOIN pg_depend d ON d.classid = o.classid AND d.objid = o.objid
+		JOIN pg_depend m ON m.classid = d.refclassid AND m.objid = d.refobjid
+		  AND m.refclassid = 'pg_extension'::regclass AND m.deptype = 'e'
+		JOIN pg_extension e ON e.oid = m.refobjid
+		JOIN pg_namespace en ON en.oid = e.extnamespace
+		ORDER BY e.extname`
+	rows, err := db.Query(ctx, q, schema, tables)
+	if err != nil {
+		return nil, fmt.Errorf("extensions query: %w", err)
+	}
+	defer rows.Close()
+	var out []extension
+	for rows.Next() {
+		var e extension
+		if err := rows.Scan(&e.Name, &e.Schema); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// exportExtensions writes CREATE EXTENSION IF NOT EXISTS for exts, each in
+// the schema it is installed in on the source, followed by a search_path
+// that resolves the dump's unqualified names in schema first and then in
+// the extensions' schemas.
+func exportExtensions(w io.Writer, schema string, exts []extension) error {
+	fmt.Fprintln(w, "-- Extensions")
+	path := []string{quoteIdent(schema)}
+	seen := map[string]bool{schema: true, "pg_catalog": true}
+	if schema != DefaultSchema {
+		fmt.Fprintf(w, "CREATE SCHEMA IF NOT EXISTS %s;\n", quoteIdent(schema))
+	}
+	for _, e := range exts {
+		if !seen[e.Schema] {
+			seen[e.Schema] = true
+			path = append(path, quoteIdent(e.Schema))
+			if e.Schema != DefaultSchema {
+				fmt.Fprintf(w, "CREATE SCHEMA IF NOT EXISTS %s;\n", quoteIdent(e.Schema))
+			}
+		}
+		fmt.Fprintf(w, "CREATE EXTENSION IF NOT EXISTS %s WITH SCHEMA %s;\n", quoteIdent(e.Name), quoteIdent(e.Schema))
+	}
+	_, err := fmt.Fprintf(w, "SET search_path = %s;\n\n", strings.Join(path, ", "))
+	return err
+}
@@ -0,0 +1,62 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func hasColumn(cols []columnDef, name string) bool {
+	for _, c := range cols {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// recordWatermarks sets MaxUpdatedAt on the manifest and on each exported
+// table that has an updatedAt column. It reads in the export's snapshot, so
+// the watermark matches the rows that were exported.
+func recordWatermarks(ctx context.Context, db querier, schema string, m *Manifest) error {
+	names := make([]string, len(m.Tables))
+	for i, t := range m.Tables {
+		names[i] = t.Name
+	}
+	rows, err := db.Query(ctx, `
+select table_name from information_schema.columns
+where table_schema = $1 and column_name = $2 and table_name = any($3)`, schema, IncrementalColumn, names)
+	if err != nil {
+		return err
+	}
+	filtered := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		filtered[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range m.Tables {
+		t := &m.Tables[i]
+		if !filtered[t.Name] {
+			continue
+		}
+		var max *time.Time
+		q := fmt.Sprintf("select max(%s) from %s.%s", quoteIdent(IncrementalColumn), quoteIdent(schema), quoteIdent(t.Name))
+		if err := db.QueryRow(ctx, q).Scan(&max); err != nil {
+			return fmt.Errorf("%s: %w", t.Name, err)
+		}
+		t.MaxUpdatedAt = max
+		if max != nil && (m.MaxUpdatedAt == nil || max.After(*m.MaxUpdatedAt)) {
+			m.MaxUpdatedAt = max
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const dumpHeader = "-- Multiboard SQL export"
+
+// DumpInfo describes a dump file as read back from its header comments and
+// embedded manifest.
+type DumpInfo struct {
+	Header          map[string]string `json:"header"`
+	Manifest        *Manifest         `json:"manifest,omitempty"`
+	Compressed      bool              `json:"compressed"`
+	ChecksumMatches *bool             `json:"checksumMatches,omitempty"`
+}
+
+// OpenDump returns a reader over the plain SQL of a dump, transparently
+// decompressing gzip input.
+func OpenDump(r io.Reader) (io.ReadCloser, bool, error) {
+	br := bufio.NewReaderSize(r, 1024*256)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, true, err
+		}
+		return zr, true, nil
+	}
+	return io.NopCloser(br), false, nil
+}
+
+// InspectDump scans a dump without executing it. Header comments of the form
+// "-- Key: value" before the first statement are collected, the manifest line
+// is decoded, and the manifest checksum is recomputed over the exporter's
+// output so truncated or edited dumps are detected.
+func InspectDump(r io.Reader) (*DumpInfo, error) {
+	rc, compressed, err := OpenDump(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	info := &DumpInfo{Header: make(map[string]string), Compressed: compressed}
+	reader := bufio.NewReaderSize(rc, 1024*256)
+	hasher := sha256.New()
+	var (
+		hashing  bool
+		inHeader = true
+	)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if strings.HasPrefix(line, manifestPrefix) {
+				var m Manifest
+				if jerr := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, manifestPrefix))), &m); jerr != nil {
+					return nil, fmt.Errorf("decode manifest: %w", jerr)
+				}
+				info.Manifest = &m
+				hashing = false
+			}
+			if strings.HasPrefix(line, dumpHeader) {
+				hashing = true
+				hasher.Reset()
+			}
+			if hashing {
+				hasher.Write([]byte(line))
+			}
+			if inHeader {
+				trimmed := strings.TrimSpace(line)
+				switch {
+				case trimmed == "" || trimmed == "--":
+				case strings.HasPrefix(trimmed, "-- "):
+					if k, v, ok := cutHeader(trimmed[3:]); ok {
+						info.Header[k] = v
+					}
+				default:
+					inHeader = false
+				}
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+	}
+	if info.Manifest != nil && info.Manifest.Checksum != "" {
+		ok := hex.EncodeToString(hasher.Sum(nil)) == info.Manifest.Checksum
+		info.ChecksumMatches = &ok
+	}
+	return info, nil
+}
+
+func cutHeader(s string) (string, string, bool) {
+	i := strings.Index(s, ": ")
+	if i <= 0 {
+		return "", "", false
+	}
+	return s[:i], strings.TrimSpace(s[i+2:]), true
+}
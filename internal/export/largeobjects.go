@@ -0,0 +1,115 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// largeObjectChunk is how many bytes of a large object go into one
+// statement.
+const largeObjectChunk = 1 << 20
+
+// largeObjectColumn is a column of type oid, or of a domain over it such as
+// the lo extension's lo, which may reference a large object.
+type largeObjectColumn struct {
+	Table, Column string
+}
+
+func listLargeObjectColumns(ctx context.Context, db querier, schema string, tables []string) ([]largeObjectColumn, error) {
+	q := `
+select c.relname, a.attname
+from pg_attribute a
+join pg_class c on c.oid = a.attrelid
+join pg_namespace n on n.oid = c.relnamespace
+join pg_type t on t.oid = a.atttypid
+where n.nspname = $1 and c.relname = any($2)
+  and a.attnum > 0 and not a.attisdropped
+  and (a.atttypid = 'oid'::regtype or (t.typtype = 'd' and t.typbasetype = 'oid'::regtype))
+order by c.relname, a.attnum`
+	rows, err := db.Query(ctx, q, schema, tables)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []largeObjectColumn
+	for rows.Next() {
+		var c largeObjectColumn
+		if err := rows.Scan(&c.Table, &c.Column); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// referencedLargeObjects returns the OIDs of existing large objects that
+// cols refer to, in ascending order.
+func referencedLargeObjects(ctx context.Context, db querier, schema string, cols []largeObjectColumn) ([]uint32, error) {
+	seen := make(map[uint32]bool)
+	for _, c := range cols {
+		q := fmt.Sprintf(`select distinct m.oid from %s.%s x join pg_largeobject_metadata m on m.oid = x.%s::oid`,
+			quoteIdent(schema), quoteIdent(c.Table), quoteIdent(c.Column))
+		rows, err := db.Query(ctx, q)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", c.Table, c.Column, err)
+		}
+		for rows.Next() {
+			var oid uint32
+			if err := rows.Scan(&oid); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			seen[oid] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]uint32, 0, len(seen))
+	for oid := range seen {
+		out = append(out, oid)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+// exportLargeObjects writes the large objects referenced from the exported
+// tables so they are recreated under the same OIDs, which the exported
+// rows refer to. An object already present under one of those OIDs on the
+// target is replaced. Contents are written in largeObjectChunk pieces with
+// lo_from_bytea and lo_put. It returns the number of objects written.
+func exportLargeObjects(ctx context.Context, db querier, w *bufio.Writer, schema string, tables []string) (int, error) {
+	cols, err := listLargeObjectColumns(ctx, db, schema, tables)
+	if err != nil {
+		return 0, err
+	}
+	if len(cols) == 0 {
+		return 0, nil
+	}
+	oids, err := referencedLargeObjects(ctx, db, schema, cols)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Fprintln(w, "-- Large objects")
+	for _, oid := range oids {
+		fmt.Fprintf(w, "SELECT pg_catalog.lo_unlink(oid) FROM pg_catalog.pg_largeobject_metadata WHERE oid = %d;\n", oid)
+		for off := int64(0); ; off += largeObjectChunk {
+			var chunk []byte
+			if err := db.QueryRow(ctx, "select lo_get($1, $2, $3)", oid, off, largeObjectChunk).Scan(&chunk); err != nil {
+				return 0, fmt.Errorf("read large object %d: %w", oid, err)
+			}
+			if off == 0 {
+				fmt.Fprintf(w, "SELECT pg_catalog.lo_from_bytea(%d, %s);\n", oid, literal(chunk))
+			} else if len(chunk) > 0 {
+				fmt.Fprintf(w, "SELECT pg_catalog.lo_put(%d, %d, %s);\n", oid, off, literal(chunk))
+			}
+			if len(chunk) < largeObjectChunk {
+				break
+			}
+		}
+	}
+	return len(oids), nil
+}
@@ -0,0 +1,94 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const manifestPrefix = "-- Manifest: "
+
+type TableManifest struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+	// MaxUpdatedAt is set by incremental exports for tables filtered on
+	// updatedAt.
+	MaxUpdatedAt *time.Time `json:"maxUpdatedAt,omitempty"`
+}
+
+// SkippedTable is a table whose data was left out of a dump exported with
+// ContinueOnError.
+type SkippedTable struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+type Manifest struct {
+	Database    string          `json:"database"`
+	GeneratedAt time.Time       `json:"generatedAt"`
+	SampleRows  int             `json:"sampleRows,omitempty"`
+	Masked      bool            `json:"masked,omitempty"`
+	Tables      []TableManifest `json:"tables"`
+	Skipped     []SkippedTable  `json:"skipped,omitempty"`
+	// LargeObjects counts the large objects included with
+	// IncludeLargeObjects.
+	LargeObjects int `json:"largeObjects,omitempty"`
+	// ConcurrentIndexes marks a dump that cannot be imported in a
+	// transaction.
+	ConcurrentIndexes bool `json:"concurrentIndexes,omitempty"`
+	// Incremental exports record the Since they were taken with and the
+	// latest updatedAt across their tables, the Since for the next run.
+	Incremental  bool       `json:"incremental,omitempty"`
+	Since        *time.Time `json:"since,omitempty"`
+	MaxUpdatedAt *time.Time `json:"maxUpdatedAt,omitempty"`
+	// Bytes and Checksum are the size and hex SHA-256 of the dump from its
+	// header line up to, but not including, the manifest line.
+	Bytes    int64  `json:"bytes,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+func (m *Manifest) TotalRows() int64 {
+	var n int64
+	for _, t := range m.Tables {
+		n += t.Rows
+	}
+	return n
+}
+
+func writeManifest(w io.Writer, m *Manifest) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", manifestPrefix, b)
+	return err
+}
+
+// maxManifestTail bounds how much of a dump's end ReadManifest scans.
+const maxManifestTail = 1 << 20
+
+// ReadManifest returns the manifest from the last line of an uncompressed
+// dump without reading the whole file. It returns nil when the dump has no
+// manifest.
+func ReadManifest(r io.ReaderAt, size int64) (*Manifest, error) {
+	off := size - maxManifestTail
+	if off < 0 {
+		off = 0
+	}
+	buf := make([]byte, size-off)
+	if _, err := r.ReadAt(buf, off); err != nil && err != io.EOF {
+		return nil, err
+	}
+	i := bytes.LastIndex(buf, []byte("\n"+manifestPrefix))
+	if i < 0 {
+		return nil, nil
+	}
+	line := bytes.TrimSpace(buf[i+1+len(manifestPrefix):])
+	var m Manifest
+	if err := json.Unmarshal(line, &m); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,102 @@
+package export
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	MaskNull       = "null"
+	MaskHash       = "hash"
+	MaskFakerEmail = "faker-email"
+	MaskConstant   = "constant"
+)
+
+type MaskRule struct {
+	Strategy string `json:"strategy"`
+	Value    string `json:"value,omitempty"`
+}
+
+// MaskingRules maps table name to column name to the rule applied to that
+// column's values during export.
+type MaskingRules map[string]map[string]MaskRule
+
+// LoadMaskingRules reads a JSON object keyed by "Table.column", e.g.
+// {"Profile.email": {"strategy": "faker-email"}}.
+func LoadMaskingRules(path string) (MaskingRules, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read masking config: %w", err)
+	}
+	var raw map[string]MaskRule
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parse masking config %s: %w", path, err)
+	}
+	rules := make(MaskingRules)
+	for key, rule := range raw {
+		dot := strings.LastIndex(key, ".")
+		if dot <= 0 || dot == len(key)-1 {
+			return nil, fmt.Errorf("masking config %s: key %q must be Table.column", path, key)
+		}
+		switch rule.Strategy {
+		case MaskNull, MaskHash, MaskFakerEmail, MaskConstant:
+		default:
+			return nil, fmt.Errorf("masking config %s: unknown strategy %q for %s", path, rule.Strategy, key)
+		}
+		tbl, col := key[:dot], key[dot+1:]
+		if rules[tbl] == nil {
+			rules[tbl] = make(map[string]MaskRule)
+		}
+		rules[tbl][col] = rule
+	}
+	return rules, nil
+}
+
+// columnMasks returns a per-column rule slice aligned with cols, or nil when
+// nothing in the table is masked.
+func (r MaskingRules) columnMasks(table string, cols []string) []*MaskRule {
+	tr := r[table]
+	if len(tr) == 0 {
+		return nil
+	}
+	out := make([]*MaskRule, len(cols))
+	found := false
+	for i, c := range cols {
+		if rule, ok := tr[c]; ok {
+			rule := rule
+			out[i] = &rule
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return out
+}
+
+func applyMask(rule *MaskRule, v any) any {
+	if v == nil {
+		return nil
+	}
+	switch rule.Strategy {
+	case MaskNull:
+		return nil
+	case MaskConstant:
+		return rule.Value
+	case MaskHash:
+		return hashValue(v)
+	case MaskFakerEmail:
+		return "user_" + hashValue(v)[:16] + "@example.com"
+	default:
+		return v
+	}
+}
+
+func hashValue(v any) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%v", v)))
+	return hex.EncodeToString(sum[:])
+}
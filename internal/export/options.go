@@ -0,0 +1,285 @@
+package export
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	FormatSQL = "sql"
+
+	DefaultSchema    = "public"
+	DefaultBatchSize = 500
+	MaxBatchSize     = 10000
+
+	ConflictNone   = "none"
+	ConflictIgnore = "ignore"
+	ConflictUpdate = "update"
+
+	// IncrementalColumn is the column incremental exports filter on.
+	IncrementalColumn = "updatedAt"
+)
+
+// ExportOptions carries everything that varies between exports. It is passed
+// by value down the call stack so concurrent exports never share mutable
+// state; the package-level table maps are read-only defaults.
+type ExportOptions struct {
+	// SampleRows limits each table to its first n rows (ordered by primary
+	// key when one exists). Zero exports everything.
+	SampleRows int `json:"sampleRows,omitempty"`
+	// Parallelism is the number of tables whose data is streamed at once.
+	// Values below 2 keep the serial, single-writer path.
+	Parallelism int `json:"parallelism,omitempty"`
+	// Include replaces the default table allow-list when non-empty.
+	Include []string `json:"include,omitempty"`
+	// Exclude is applied on top of the default exclusions.
+	Exclude []string `json:"exclude,omitempty"`
+	// Schema is the source schema to read tables from.
+	Schema string `json:"schema,omitempty"`
+	// Format of the generated dump; only plain SQL is supported.
+	Format string `json:"format,omitempty"`
+	// BatchSize is the number of rows per multi-row INSERT.
+	BatchSize int `json:"batchSize,omitempty"`
+	// OrderRows reads each table's rows ordered by its primary key, or by
+	// the columns OrderBy lists for it, so exports of unchanged data are
+	// byte for byte the same. Tables with neither keep the server's order.
+	OrderRows bool `json:"orderRows,omitempty"`
+	// OrderBy maps tables to the columns their rows are ordered by instead
+	// of the primary key.
+	OrderBy map[string][]string `json:"orderBy,omitempty"`
+	// DollarQuoteMin dollar-quotes text values of at least this many bytes
+	// rather than doubling every embedded quote. Zero disables it.
+	DollarQuoteMin int `json:"dollarQuoteMin,omitempty"`
+	// DropExisting controls whether each CREATE TABLE is preceded by DROP
+	// TABLE IF EXISTS ... CASCADE. When false the dump uses IF NOT EXISTS
+	// everywhere so it can be merged into an existing schema. Defaults to
+	// true.
+	DropExisting *bool `json:"dropExisting,omitempty"`
+	// IncludeComments emits COMMENT ON TABLE/COLUMN after the schema.
+	IncludeComments bool `json:"includeComments,omitempty"`
+	// IncludeMigrations adds the _prisma_migrations table so the target's
+	// migration history matches the source.
+	IncludeMigrations bool `json:"includeMigrations,omitempty"`
+	// IncludeRoutines emits the schema's functions and the triggers on the
+	// exported tables, after the data and before foreign keys.
+	IncludeRoutines bool `json:"includeRoutines,omitempty"`
+	// IncludeExtensions emits CREATE EXTENSION IF NOT EXISTS for the
+	// extensions the exported tables depend on, and a SET search_path, at
+	// the top of the dump.
+	IncludeExtensions bool `json:"includeExtensions,omitempty"`
+	// IncludeLargeObjects also exports the large objects that oid (or lo)
+	// columns of the exported tables refer to, recreated under the same
+	// OIDs. Without it such columns keep dangling OIDs.
+	IncludeLargeObjects bool `json:"includeLargeObjects,omitempty"`
+	// ConflictStrategy adds ON CONFLICT on the primary key to every INSERT:
+	// "ignore" skips existing rows, "update" overwrites them. "none" (the
+	// default) emits plain INSERTs.
+	ConflictStrategy string `json:"conflictStrategy,omitempty"`
+	// ContinueOnError records a table whose data cannot be read in the
+	// manifest's Skipped list and carries on with the rest, instead of
+	// failing the export. The skipped table is still created, empty.
+	ContinueOnError bool `json:"continueOnError,omitempty"`
+	// Incremental exports only the rows of tables with an updatedAt column
+	// changed after Since (every row when Since is unset); other tables are
+	// exported in full. The manifest records the latest updatedAt to pass
+	// as Since next time. Because the dump holds a delta, it defaults to
+	// keeping existing tables and upserting on the primary key.
+	Incremental bool       `json:"incremental,omitempty"`
+	Since       *time.Time `json:"since,omitempty"`
+	// SingleTransaction wraps the dump in BEGIN/COMMIT, like pg_dump
+	// --single-transaction, and sets session_replication_role to replica for
+	// the load so triggers and foreign key checks do not fire, like
+	// --disable-triggers. Replaying it needs superuser rights.
+	SingleTransaction bool `json:"singleTransaction,omitempty"`
+	// ConcurrentIndexes emits CREATE INDEX CONCURRENTLY so index builds do
+	// not block reads of a target in use. Such a dump cannot be imported in
+	// a transaction, so it excludes SingleTransaction and transactional
+	// imports.
+	ConcurrentIndexes bool `json:"concurrentIndexes,omitempty"`
+	// Compress writes the dump gzipped, as .sql.gz, at CompressionLevel.
+	Compress         bool             `json:"compress,omitempty"`
+	CompressionLevel CompressionLevel `json:"compressionLevel,omitempty"`
+	// PartSize, when set, splits the dump into numbered part files of
+	// about this many bytes plus an index. Zero writes a single file.
+	PartSize int64 `json:"partSize,omitempty"`
+	// Fsync flushes the dump to disk before the export is reported done, so
+	// a crash right after cannot lose its tail.
+	Fsync bool `json:"fsync,omitempty"`
+	// AtomicRename writes the dump to a hidden temporary file (TempPath) and
+	// renames it into place only once it is complete, so readers never see
+	// a partial dump.
+	// For multi-part dumps it applies to the index. Defaults to true.
+	AtomicRename *bool `json:"atomicRename,omitempty"`
+
+	// Masking replaces sensitive column values before they are written. It is
+	// server-side configuration and never accepted from a request.
+	Masking MaskingRules `json:"-"`
+}
+
+func (o ExportOptions) Validate() error {
+	if o.SampleRows < 0 {
+		return fmt.Errorf("sampleRows must not be negative")
+	}
+	if o.Parallelism < 0 || o.Parallelism > MaxParallelism {
+		return fmt.Errorf("parallelism must be between 1 and %d", MaxParallelism)
+	}
+	if o.BatchSize < 0 || o.BatchSize > MaxBatchSize {
+		return fmt.Errorf("batchSize must be between 1 and %d", MaxBatchSize)
+	}
+	for table, cols := range o.OrderBy {
+		if len(cols) == 0 {
+			return fmt.Errorf("orderBy for %s must list at least one column", table)
+		}
+	}
+	if o.DollarQuoteMin < 0 {
+		return fmt.Errorf("dollarQuoteMin must not be negative")
+	}
+	switch o.ConflictStrategy {
+	case "", ConflictNone, ConflictIgnore, ConflictUpdate:
+	default:
+		return fmt.Errorf("conflictStrategy must be one of none, ignore, update")
+	}
+	if o.ConcurrentIndexes && o.SingleTransaction {
+		return fmt.Errorf("concurrentIndexes cannot be combined with singleTransaction")
+	}
+	if o.Since != nil && !o.Incremental {
+		return fmt.Errorf("since requires incremental")
+	}
+	if o.Incremental && o.DropExisting != nil && *o.DropExisting {
+		return fmt.Errorf("incremental exports cannot use dropExisting")
+	}
+	if o.Incremental && o.ConflictStrategy == ConflictNone {
+		return fmt.Errorf("incremental exports need conflictStrategy ignore or update")
+	}
+	if o.PartSize != 0 && o.PartSize < MinPartSize {
+		return fmt.Errorf("partSize must be at least %d bytes", MinPartSize)
+	}
+	if o.CompressionLevel != 0 && !o.Compress {
+		return fmt.Errorf("compressionLevel requires compress")
+	}
+	if o.CompressionLevel < 0 || o.CompressionLevel > gzip.BestCompression {
+		return fmt.Errorf("compressionLevel must be between %d and %d", gzip.BestSpeed, gzip.BestCompression)
+	}
+	if o.Compress && o.PartSize != 0 {
+		return fmt.Errorf("compress cannot be combined with partSize")
+	}
+	if o.Format != "" && o.Format != FormatSQL {
+		return fmt.Errorf("unsupported format %q", o.Format)
+	}
+	return nil
+}
+
+func (o ExportOptions) DropsExisting() bool {
+	return o.DropExisting == nil || *o.DropExisting
+}
+
+func (o ExportOptions) RenamesAtomically() bool {
+	return o.AtomicRename == nil || *o.AtomicRename
+}
+
+func (o ExportOptions) withDefaults() ExportOptions {
+	if o.Schema == "" {
+		o.Schema = DefaultSchema
+	}
+	if o.Format == "" {
+		o.Format = FormatSQL
+	}
+	if o.BatchSize == 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	if o.Incremental {
+		if o.DropExisting == nil {
+			keep := false
+			o.DropExisting = &keep
+		}
+		if o.ConflictStrategy == "" {
+			o.ConflictStrategy = ConflictUpdate
+		}
+	}
+	if o.ConflictStrategy == "" {
+		o.ConflictStrategy = ConflictNone
+	}
+	return o
+}
+
+// selectTables applies the include and exclude filters to the tables found
+// in the source schema and returns them sorted.
+func (o ExportOptions) selectTables(tables []string) []string {
+	include := make(map[string]bool, len(includeTables)+1)
+	if len(o.Include) > 0 {
+		for _, t := range o.Include {
+			include[t] = true
+		}
+	} else {
+		for t := range includeTables {
+			include[t] = true
+		}
+	}
+	exclude := make(map[string]bool, len(excludeTables)+len(o.Exclude))
+	for t := range excludeTables {
+		exclude[t] = true
+	}
+	if o.IncludeMigrations {
+		include[MigrationsTable] = true
+		delete(exclude, MigrationsTable)
+	}
+	for _, t := range o.Exclude {
+		exclude[t] = true
+	}
+
+	filtered := make([]string, 0, len(tables))
+	for _, t := range tables {
+		if exclude[t] {
+			continue
+		}
+		if include[t] {
+			filtered = append(filtered, t)
+		}
+	}
+	sort.Strings(filtered)
+	return filtered
+}
+
+// DefaultCompressionLevel balances speed and size when compress is set
+// without a level; it is what gzip itself defaults to.
+const DefaultCompressionLevel CompressionLevel = 6
+
+// CompressionLevel is a gzip level from 1 (fastest) to 9 (smallest), with
+// zero meaning DefaultCompressionLevel. In JSON it may also be given as
+// "fastest", "default" or "best".
+type CompressionLevel int
+
+var compressionLevelNames = map[string]CompressionLevel{
+	"fastest": gzip.BestSpeed,
+	"default": DefaultCompressionLevel,
+	"best":    gzip.BestCompression,
+}
+
+func (l *CompressionLevel) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		level, ok := compressionLevelNames[name]
+		if !ok {
+			return fmt.Errorf("compressionLevel must be 1-9, \"fastest\", \"default\" or \"best\", not %q", name)
+		}
+		*l = level
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("compressionLevel must be 1-9, \"fastest\", \"default\" or \"best\"")
+	}
+	*l = CompressionLevel(n)
+	return nil
+}
+
+// GzipLevel returns the level to pass to gzip.
+func (l CompressionLevel) GzipLevel() int {
+	if l == 0 {
+		return int(DefaultCompressionLevel)
+	}
+	return int(l)
+}
@@ -0,0 +1,149 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+)
+
+// MaxParallelism keeps concurrent table streams well below the pool's
+// MaxConns so other queries from the same export can still get a connection.
+const MaxParallelism = 8
+
+type tableResult struct {
+	file *os.File
+	rows int64
+	err  error
+}
+
+// exportDataParallel streams each table's INSERTs into its own temporary file
+// using a bounded pool of goroutines, then copies the files into w in table
+// order so the output is identical to the serial path. Each goroutine reads
+// in its own transaction on the exported snapshot, so all tables are read
+// at the same point in time. With ContinueOnError a table whose data cannot
+// be read is returned as skipped rather than failing the others.
+func exportDataParallel(ctx context.Context, begin func(context.Context) (pgx.Tx, error), snapshot string, w *bufio.Writer, tables []string, opts ExportOptions, progress ProgressFn) ([]TableManifest, []SkippedTable, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]tableResult, len(tables))
+	defer func() {
+		for _, r := range results {
+			if r.file != nil {
+				r.file.Close()
+				os.Remove(r.file.Name())
+			}
+		}
+	}()
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		finished   int
+		cumulative int64
+		spooled    int64
+	)
+	tableRows := make([]int64, len(tables))
+	tableBytes := make([]int64, len(tables))
+	report := func(i int, rows, bytes int64, done bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			finished++
+		}
+		cumulative += rows - tableRows[i]
+		tableRows[i] = rows
+		spooled += bytes - tableBytes[i]
+		tableBytes[i] = bytes
+		progress(Progress{TableIndex: finished, TableName: tables[i], RowsExported: rows, CumulativeRows: cumulative, BytesWritten: spooled})
+	}
+
+	sem := make(chan struct{}, opts.Parallelism)
+	for i, tbl := range tables {
+		wg.Add(1)
+		go func(i int, tbl string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i].err = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+
+			f, err := os.CreateTemp("", "multiboard-export-*.sql")
+			if err != nil {
+				results[i].err = err
+				cancel()
+				return
+			}
+			results[i].file = f
+			fc := &countingWriter{w: f}
+			tw := bufio.NewWriterSize(fc, 1024*256)
+			rows, err := streamSnapshot(ctx, begin, snapshot, tw, tbl, opts, func(rowsExported int64) {
+				report(i, rowsExported, fc.n+int64(tw.Buffered()), false)
+			})
+			if err == nil {
+				err = tw.Flush()
+			}
+			results[i].rows = rows
+			if err != nil {
+				results[i].err = err
+				if !opts.ContinueOnError || ctx.Err() != nil {
+					cancel()
+				}
+				return
+			}
+			report(i, rows, fc.n, true)
+		}(i, tbl)
+	}
+	wg.Wait()
+
+	out := make([]TableManifest, 0, len(tables))
+	var skipped []SkippedTable
+	for i, tbl := range tables {
+		if err := results[i].err; err != nil {
+			if !opts.ContinueOnError || ctx.Err() != nil || results[i].file == nil {
+				return nil, nil, fmt.Errorf("data for %s: %w", tbl, err)
+			}
+			skipped = append(skipped, SkippedTable{Name: tbl, Error: err.Error()})
+		}
+	}
+	for i, tbl := range tables {
+		if results[i].err != nil {
+			continue
+		}
+		f := results[i].file
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, fmt.Errorf("data for %s: %w", tbl, err)
+		}
+		if _, err := io.Copy(w, f); err != nil {
+			return nil, nil, fmt.Errorf("data for %s: %w", tbl, err)
+		}
+		out = append(out, TableManifest{Name: tbl, Rows: results[i].rows})
+	}
+	return out, skipped, nil
+}
+
+// streamSnapshot runs streamInserts in a new transaction, started with
+// begin, that imports snapshot.
+func streamSnapshot(ctx context.Context, begin func(context.Context) (pgx.Tx, error), snapshot string, w *bufio.Writer, table string, opts ExportOptions, onBatch func(rowsExported int64)) (int64, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+	if _, err := tx.Exec(ctx, "set transaction snapshot "+sqlString(snapshot)); err != nil {
+		return 0, fmt.Errorf("set snapshot: %w", err)
+	}
+	if err := database.TagSession(ctx, tx, true); err != nil {
+		return 0, err
+	}
+	return streamInserts(ctx, tx, w, table, opts, onBatch)
+}
@@ -0,0 +1,132 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// partition describes a table's place in a declarative partitioning tree.
+// Key is the PARTITION BY clause of a partitioned table; Parent and Bound
+// are set for a partition.
+type partition struct {
+	Parent string
+	Bound  string
+	Key    string
+}
+
+type partitions map[string]partition
+
+func listPartitions(ctx context.Context, db querier, schema string) (partitions, error) {
+	q := `
+select c.relname,
+       coalesce(p.relname, ''),
+       coalesce(pn.nspname, ''),
+       coalesce(pg_get_expr(c.relpartbound, c.oid), ''),
+       case when c.relkind = 'p' then pg_get_partkeydef(c.oid) else '' end
+from pg_class c
+join pg_namespace n on n.oid = c.relnamespace
+left join pg_inherits i on i.inhrelid = c.oid and c.relispartition
+left join pg_class p on p.oid = i.inhparent
+left join pg_namespace pn on pn.oid = p.relnamespace
+where n.nspname = $1 and (c.relkind = 'p' or c.relispartition)`
+	rows, err := db.Query(ctx, q, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(partitions)
+	for rows.Next() {
+		var name, parentSchema string
+		var p partition
+		if err := rows.Scan(&name, &p.Parent, &parentSchema, &p.Bound, &p.Key); err != nil {
+			return nil, err
+		}
+		if p.Parent != "" && parentSchema != schema {
+			return nil, fmt.Errorf("partition %s belongs to %s.%s outside schema %s, which is not supported", name, parentSchema, p.Parent, schema)
+		}
+		out[name] = p
+	}
+	return out, rows.Err()
+}
+
+// partitioned reports whether table is a partitioned parent, which holds no
+// rows of its own.
+func (ps partitions) partitioned(table string) bool {
+	return ps[table].Key != ""
+}
+
+// resolve adds the partitions of every selected partitioned table and
+// orders the result so that each parent precedes its partitions. A
+// partition selected without its parent is an error: it cannot be created
+// as a partition, and exporting it as a plain table would silently change
+// the schema.
+func (ps partitions) resolve(selected, all []string) ([]string, error) {
+	if len(ps) == 0 {
+		return selected, nil
+	}
+	in := make(map[string]bool, len(selected))
+	for _, t := range selected {
+		in[t] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, t := range all {
+			if !in[t] && ps[t].Parent != "" && in[ps[t].Parent] {
+				in[t] = true
+				changed = true
+			}
+		}
+	}
+	out := make([]string, 0, len(in))
+	for _, t := range all {
+		if !in[t] {
+			continue
+		}
+		if parent := ps[t].Parent; parent != "" && !in[parent] {
+			return nil, fmt.Errorf("table %s is a partition of %s, which is not part of the export set", t, parent)
+		}
+		out = append(out, t)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return ps.depth(out[i]) < ps.depth(out[j]) })
+	return out, nil
+}
+
+func (ps partitions) depth(table string) int {
+	d := 0
+	for p := ps[table].Parent; p != "" && d < 32; p = ps[p].Parent {
+		d++
+	}
+	return d
+}
+
+// dataTables drops partitioned parents: their rows are exported through
+// the partitions that store them.
+func (ps partitions) dataTables(tables []string) []string {
+	out := make([]string, 0, len(tables))
+	for _, t := range tables {
+		if !ps.partitioned(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// roots drops partitions, keeping plain and top-level partitioned tables.
+func (ps partitions) roots(tables []string) []string {
+	out := make([]string, 0, len(tables))
+	for _, t := range tables {
+		if ps[t].Parent == "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// recursiveIndexDef makes an index on a partitioned table cascade to its
+// partitions. pg_get_indexdef reports such indexes as ON ONLY, which would
+// leave them invalid until every partition index is attached.
+func recursiveIndexDef(def string) string {
+	return strings.Replace(def, " ON ONLY ", " ON ", 1)
+}
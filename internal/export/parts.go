@@ -0,0 +1,296 @@
+package export
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// MinPartSize is the smallest allowed ExportOptions.PartSize.
+const MinPartSize = 1 << 20
+
+// IndexSuffix ends the name of a multi-part dump's index file.
+const IndexSuffix = ".index.json"
+
+// TempPath is where a dump file is written before it is renamed to path:
+// a hidden .tmp file beside it, which neither the dump listing nor the
+// import's glob for the newest dump will pick up.
+func TempPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+}
+
+var partFileRe = regexp.MustCompile(`\.part\d{3,}\.sql$`)
+
+// IsPartFile reports whether name is one part of a multi-part dump, which
+// is only meaningful together with its index.
+func IsPartFile(name string) bool { return partFileRe.MatchString(name) }
+
+// PartIndex lists the files of a multi-part dump in order. The dump is the
+// concatenation of the parts.
+type PartIndex struct {
+	Database string     `json:"database"`
+	Parts    []PartInfo `json:"parts"`
+}
+
+type PartInfo struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func (x *PartIndex) TotalSize() int64 {
+	var n int64
+	for _, p := range x.Parts {
+		n += p.Size
+	}
+	return n
+}
+
+// PartWriter writes a dump as numbered part files next to base
+// (base.part001.sql, base.part002.sql, ...). A part is closed at the first
+// line break after it reaches the size limit, so parts stay readable; they
+// are not independently executable. Close writes the index.
+type PartWriter struct {
+	// Fsync flushes each part and the index to disk as they are closed.
+	Fsync bool
+	// AtomicIndex writes the index under a .tmp name and renames it into
+	// place, so the dump only appears once every part is complete.
+	AtomicIndex bool
+
+	base  string
+	limit int64
+	index PartIndex
+
+	f    *os.File
+	h    hash.Hash
+	size int64
+}
+
+func NewPartWriter(base, database string, limit int64) *PartWriter {
+	return &PartWriter{base: base, limit: limit, index: PartIndex{Database: database}}
+}
+
+// IndexPath is where Close writes the index.
+func (w *PartWriter) IndexPath() string { return w.base + IndexSuffix }
+
+// Count returns the number of parts started so far.
+func (w *PartWriter) Count() int { return len(w.index.Parts) }
+
+func (w *PartWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.f == nil {
+			if err := w.next(); err != nil {
+				return written, err
+			}
+		}
+		chunk := p
+		rotate := false
+		if w.size >= w.limit {
+			if i := bytes.IndexByte(p, '\n'); i >= 0 {
+				chunk, rotate = p[:i+1], true
+			}
+		} else if room := w.limit - w.size; int64(len(chunk)) > room {
+			chunk = p[:room]
+		}
+		n, err := w.write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		if rotate {
+			if err := w.finish(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *PartWriter) write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.h.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *PartWriter) next() error {
+	name := fmt.Sprintf("%s.part%03d.sql", filepath.Base(w.base), len(w.index.Parts)+1)
+	f, err := os.Create(filepath.Join(filepath.Dir(w.base), name))
+	if err != nil {
+		return err
+	}
+	w.f, w.h, w.size = f, sha256.New(), 0
+	w.index.Parts = append(w.index.Parts, PartInfo{Name: name})
+	return nil
+}
+
+func (w *PartWriter) finish() error {
+	part := &w.index.Parts[len(w.index.Parts)-1]
+	part.Size = w.size
+	part.SHA256 = hex.EncodeToString(w.h.Sum(nil))
+	var err error
+	if w.Fsync {
+		err = w.f.Sync()
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	w.f = nil
+	return err
+}
+
+// Close finishes the last part and writes the index.
+func (w *PartWriter) Close() error {
+	if w.f != nil {
+		if err := w.finish(); err != nil {
+			return err
+		}
+	}
+	b, err := json.MarshalIndent(w.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := w.IndexPath()
+	if w.AtomicIndex {
+		path = TempPath(path)
+	}
+	if err := writeFile(path, append(b, '\n'), w.Fsync); err != nil {
+		return err
+	}
+	if w.AtomicIndex {
+		if err := os.Rename(path, w.IndexPath()); err != nil {
+			os.Remove(path)
+			return err
+		}
+	}
+	if w.Fsync {
+		return SyncDir(filepath.Dir(w.base))
+	}
+	return nil
+}
+
+// writeFile is os.WriteFile with an optional fsync before the close.
+func writeFile(path string, b []byte, fsync bool) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil && fsync {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// SyncDir flushes dir's entries to disk, making files created or renamed
+// in it durable.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Remove deletes every part written so far, e.g. after a failed export.
+func (w *PartWriter) Remove() {
+	if w.f != nil {
+		w.f.Close()
+		w.f = nil
+	}
+	dir := filepath.Dir(w.base)
+	for _, p := range w.index.Parts {
+		os.Remove(filepath.Join(dir, p.Name))
+	}
+	os.Remove(w.IndexPath())
+	os.Remove(TempPath(w.IndexPath()))
+}
+
+func ReadPartIndex(path string) (*PartIndex, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var x PartIndex
+	if err := json.Unmarshal(b, &x); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if len(x.Parts) == 0 {
+		return nil, fmt.Errorf("%s lists no parts", path)
+	}
+	for _, p := range x.Parts {
+		if p.Name != filepath.Base(p.Name) {
+			return nil, fmt.Errorf("%s: invalid part name %q", path, p.Name)
+		}
+	}
+	return &x, nil
+}
+
+// OpenParts returns a reader over the concatenated parts of the multi-part
+// dump described by the index at path, along with the index. Parts are
+// opened one at a time as reading reaches them, and each must still have
+// the size the index records.
+func OpenParts(path string) (io.ReadCloser, *PartIndex, error) {
+	x, err := ReadPartIndex(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &partsReader{dir: filepath.Dir(path), parts: x.Parts}, x, nil
+}
+
+type partsReader struct {
+	dir   string
+	parts []PartInfo
+	f     *os.File
+	n     int64
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.f == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(filepath.Join(r.dir, r.parts[0].Name))
+			if err != nil {
+				return 0, err
+			}
+			r.f, r.n = f, 0
+		}
+		n, err := r.f.Read(p)
+		r.n += int64(n)
+		if err == io.EOF {
+			part := r.parts[0]
+			r.f.Close()
+			r.f = nil
+			r.parts = r.parts[1:]
+			if r.n != part.Size {
+				return n, fmt.Errorf("part %s is %d bytes, index says %d", part.Name, r.n, part.Size)
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (r *partsReader) Close() error {
+	if r.f != nil {
+		return r.f.Close()
+	}
+	return nil
+}
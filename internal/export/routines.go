@@ -0,0 +1,68 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// exportFunctions writes the user-defined functions and procedures of schema,
+// skipping those that belong to extensions. They are emitted in creation
+// order, which keeps functions ahead of the ones that call them in the
+// common case.
+func exportFunctions(ctx context.Context, db querier, w io.Writer, schema string) error {
+	q := `
+		SELECT pg_get_functiondef(p.oid)
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = $1
+		  AND p.prokind IN ('f', 'p')
+		  AND NOT EXISTS (
+		    SELECT 1 FROM pg_depend d
+		    WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e')
+		ORDER BY p.oid`
+	rows, err := db.Query(ctx, q, schema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var def string
+		if err := rows.Scan(&def); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s;\n\n", def); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exportTriggers writes the user triggers on the given tables. Each is
+// preceded by DROP TRIGGER IF EXISTS so the dump also applies on top of an
+// existing schema.
+func exportTriggers(ctx context.Context, db querier, w io.Writer, schema string, tables []string) error {
+	q := `
+		SELECT c.relname, t.tgname, pg_get_triggerdef(t.oid, true)
+		FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = ANY($2) AND NOT t.tgisinternal
+		  AND t.tgparentid = 0 -- clones on partitions come from the parent's trigger
+		ORDER BY c.relname, t.tgname`
+	rows, err := db.Query(ctx, q, schema, tables)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, name, def string
+		if err := rows.Scan(&table, &name, &def); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "DROP TRIGGER IF EXISTS %s ON %s;\n%s;\n", quoteIdent(name), quoteIdent(table), def); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,165 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sequenceRef is a column whose default is nextval() of a sequence. Seq is
+// the regclass text exactly as it appears in the default expression (which is
+// also what information_schema reports as column_default), so it is already
+// quoted the way the CREATE TABLE default will reference it. Owned is set
+// when the sequence is owned by the column, as with serial columns.
+type sequenceRef struct {
+	Seq, Table, Column, Type string
+	Owned                    bool
+	// Identity marks a column that is already an identity column on the
+	// source; its sequence is implicit and recreated by CREATE TABLE.
+	Identity bool
+}
+
+func (r sequenceRef) identity() bool {
+	return r.Identity || convertsToIdentity(r.Column, r.Type, "nextval(")
+}
+
+// convertsToIdentity reports whether writeCreateTable replaces a serial "id"
+// column with an identity column, in which case Postgres owns the sequence
+// and no standalone CREATE SEQUENCE is needed.
+func convertsToIdentity(name, typ, def string) bool {
+	return (name == "id" || name == "Id" || name == "ID") &&
+		(typ == "integer" || typ == "bigint" || typ == "smallint") &&
+		strings.HasPrefix(def, "nextval(")
+}
+
+func listSequenceRefs(ctx context.Context, db querier, schema string, tables []string) ([]sequenceRef, error) {
+	q := `
+WITH cols AS (
+	SELECT
+		c.relname AS table_name,
+		a.attname AS column_name,
+		format_type(a.atttypid, a.atttypmod) AS column_type,
+		pg_get_expr(ad.adbin, ad.adrelid) AS default_expr,
+		pg_get_serial_sequence(quote_ident(n.nspname) || '.' || quote_ident(c.relname), a.attname) AS owned_seq,
+		a.attidentity <> '' AS is_identity
+	FROM pg_attribute a
+	JOIN pg_class c ON c.oid = a.attrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+	WHERE n.nspname = $1 AND a.attnum > 0 AND NOT a.attisdropped
+		AND c.relname = ANY($2)
+),
+seqs AS (
+	SELECT
+		substring(default_expr from $$nextval\('([^']+)'::regclass\)$$) AS sequence_name,
+		table_name,
+		column_name,
+		column_type,
+		owned_seq IS NOT NULL AS owned,
+		false AS is_identity
+	FROM cols
+	WHERE default_expr LIKE 'nextval(%'
+	UNION
+	SELECT owned_seq, table_name, column_name, column_type, true, true
+	FROM cols
+	WHERE is_identity
+)
+SELECT DISTINCT sequence_name, table_name, column_name, column_type, owned, is_identity
+FROM seqs
+WHERE sequence_name IS NOT NULL AND sequence_name <> ''
+ORDER BY sequence_name, table_name, column_name`
+	rows, err := db.Query(ctx, q, schema, tables)
+	if err != nil {
+		return nil, fmt.Errorf("sequence refs query: %w", err)
+	}
+	defer rows.Close()
+	var out []sequenceRef
+	for rows.Next() {
+		var r sequenceRef
+		if err := rows.Scan(&r.Seq, &r.Table, &r.Column, &r.Type, &r.Owned, &r.Identity); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// exportSequences creates only the sequences that the included tables'
+// defaults reference, so sequences belonging to excluded tables are not
+// recreated as orphans on the target. Each keeps its source definition:
+// type, increment, bounds, start, cache and cycling.
+func exportSequences(ctx context.Context, w io.Writer, db querier, refs []sequenceRef) error {
+	fmt.Fprintln(w, "-- Sequences")
+	seen := make(map[string]bool, len(refs))
+	for _, r := range refs {
+		if seen[r.Seq] || r.identity() {
+			continue
+		}
+		seen[r.Seq] = true
+		def, err := sequenceDefinition(ctx, db, r.Seq)
+		if err != nil {
+			return fmt.Errorf("sequence %s: %w", r.Seq, err)
+		}
+		if _, err := fmt.Fprintf(w, "CREATE SEQUENCE IF NOT EXISTS %s%s;\n", r.Seq, def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sequenceDefinition returns the options of the CREATE SEQUENCE for seq, a
+// regclass name as it appears in a nextval() default.
+func sequenceDefinition(ctx context.Context, db querier, seq string) (string, error) {
+	var (
+		typ                                     string
+		increment, minVal, maxVal, start, cache int64
+		cycle                                   bool
+	)
+	err := db.QueryRow(ctx, `
+		SELECT format_type(seqtypid, NULL), seqincrement, seqmin, seqmax, seqstart, seqcache, seqcycle
+		FROM pg_sequence
+		WHERE seqrelid = $1::regclass`, seq).Scan(&typ, &increment, &minVal, &maxVal, &start, &cache, &cycle)
+	if err != nil {
+		return "", err
+	}
+	def := fmt.Sprintf(" AS %s INCREMENT BY %d MINVALUE %d MAXVALUE %d START WITH %d CACHE %d", typ, increment, minVal, maxVal, start, cache)
+	if cycle {
+		def += " CYCLE"
+	}
+	return def, nil
+}
+
+// exportSequenceUpdates restores serial ownership and advances each sequence
+// past the exported data. Identity columns get a new sequence from CREATE
+// TABLE whose name may differ from the source, so they are addressed through
+// pg_get_serial_sequence rather than by name.
+func exportSequenceUpdates(ctx context.Context, w io.Writer, db querier, schema string, refs []sequenceRef) error {
+	fmt.Fprintln(w, "-- Sequence ownership and values")
+	for _, r := range refs {
+		if r.Owned && !r.identity() {
+			fmt.Fprintf(w, "ALTER SEQUENCE %s OWNED BY %s.%s;\n", r.Seq, quoteIdent(r.Table), quoteIdent(r.Column))
+		}
+	}
+	for _, r := range refs {
+		sql := fmt.Sprintf(`SELECT COALESCE(MAX(%s), 0) FROM %s.%s`, quoteIdent(r.Column), quoteIdent(schema), quoteIdent(r.Table))
+		var maxVal int64
+		if err := db.QueryRow(ctx, sql).Scan(&maxVal); err != nil {
+			continue
+		}
+		if maxVal <= 0 {
+			// An empty table leaves the freshly created sequence at its start value.
+			continue
+		}
+		seq := sqlString(r.Seq) + "::regclass"
+		if r.identity() {
+			seq = fmt.Sprintf("pg_get_serial_sequence(%s, %s)", sqlString(quoteIdent(r.Table)), sqlString(r.Column))
+		}
+		fmt.Fprintf(w, "SELECT setval(%s, %d, true);\n", seq, maxVal)
+	}
+	return nil
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,95 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+)
+
+// Allows reports whether table passes the include/exclude filters and would
+// be part of a full export with these options.
+func (o ExportOptions) Allows(table string) bool {
+	return len(o.selectTables([]string{table})) == 1
+}
+
+// ReferencingTables returns the other tables of schema with foreign keys to
+// table. The TRUNCATE that ExportTableData starts with fails on a target
+// where there are any, and emptying the table by DELETE would either fail
+// the same way or cascade into them.
+func ReferencingTables(ctx context.Context, db querier, schema, table string) ([]string, error) {
+	rows, err := db.Query(ctx, `
+		SELECT DISTINCT c.relname
+		FROM pg_constraint k
+		JOIN pg_class c ON c.oid = k.conrelid
+		WHERE k.contype = 'f' AND k.confrelid = to_regclass($1) AND k.conrelid <> k.confrelid
+		ORDER BY 1`, pgx.Identifier{schema, table}.Sanitize())
+	if err != nil {
+		return nil, fmt.Errorf("foreign keys to %s: %w", table, err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
+
+// ExportTableData writes a data-only script for a single table: TRUNCATE,
+// the INSERT batches and the sequence updates for its columns. It assumes
+// the target already has the table and is meant to run in one transaction.
+func (e *Exporter) ExportTableData(ctx context.Context, dbName, table string, w io.Writer, opts ExportOptions, onBatch func(rowsExported int64)) (int64, error) {
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+	opts = opts.withDefaults()
+	if !opts.Allows(table) {
+		return 0, fmt.Errorf("table %q is not part of the export set", table)
+	}
+	pool, release, err := e.mgr.Lease(ctx, dbName)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	parts, err := listPartitions(ctx, pool, opts.Schema)
+	if err != nil {
+		return 0, fmt.Errorf("list partitions in %s: %w", opts.Schema, err)
+	}
+	if e.denied(table, parts) {
+		log.Printf("export of %s: table %s is blocked by EXPORT_DENY_TABLES", dbName, table)
+		return 0, fmt.Errorf("table %q is not part of the export set", table)
+	}
+	// Rows and sequence values are read in one snapshot so they agree.
+	db, err := e.beginSnapshot(ctx, dbName)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Rollback(context.Background())
+	if err := database.TagSession(ctx, db, true); err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriterSize(w, 1024*256)
+	defer bw.Flush()
+
+	fmt.Fprintf(bw, "TRUNCATE TABLE %s;\n", quoteIdent(table))
+	rows, err := streamInserts(ctx, db, bw, table, opts, onBatch)
+	if err != nil {
+		return 0, fmt.Errorf("data for %s: %w", table, err)
+	}
+	refs, err := listSequenceRefs(ctx, db, opts.Schema, []string{table})
+	if err != nil {
+		return 0, fmt.Errorf("list sequences: %w", err)
+	}
+	if err := exportSequenceUpdates(ctx, bw, db, opts.Schema, refs); err != nil {
+		return 0, fmt.Errorf("export sequence updates: %w", err)
+	}
+	return rows, bw.Flush()
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+	"github.com/koilabcode/multiboard-sync-service/internal/queue"
+)
+
+type AdminHandler struct {
+	Manager *database.Manager
+	// LoadURLs re-reads the database configuration, e.g. from the
+	// environment after reloading .env.
+	LoadURLs  func() database.URLs
+	Inspector *asynq.Inspector
+	Jobs      *models.JobStore
+}
+
+type reloadResp struct {
+	Databases []string `json:"databases"`
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+}
+
+func (h *AdminHandler) Reload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		MethodNotAllowed(w, r)
+		return
+	}
+	added, removed := h.Manager.Reload(h.LoadURLs())
+	if added == nil {
+		added = []string{}
+	}
+	if removed == nil {
+		removed = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(reloadResp{
+		Databases: h.Manager.ListDatabases(),
+		Added:     added,
+		Removed:   removed,
+	})
+}
+
+type purgeReq struct {
+	Type string `json:"type"`
+}
+
+type purgeResp struct {
+	Purged int      `json:"purged"`
+	JobIDs []string `json:"jobIds"`
+}
+
+// PurgeQueue handles POST /api/admin/queue/purge: it deletes pending tasks,
+// optionally only those of one type, and cancels their jobs. Running tasks
+// are not affected.
+func (h *AdminHandler) PurgeQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		MethodNotAllowed(w, r)
+		return
+	}
+	var req purgeReq
+	if r.ContentLength != 0 {
+		if err := decodeJSON(w, r, &req); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+			return
+		}
+	}
+	if req.Type != "" && !queue.ValidTaskType(req.Type) {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid type; expected one of export:run, import:run, import:bundle, sync:table, sync:verify", CodeInvalidRequest)
+		return
+	}
+	ids, err := queue.PurgePending(h.Inspector, req.Type)
+	now := time.Now()
+	for _, id := range ids {
+		h.Jobs.Update(id, func(j *models.Job) {
+			if j.Status == models.StatusPending {
+				j.Cancel(now, "purged from queue")
+			}
+		})
+	}
+	log.Printf("WARNING: purged %d pending tasks (type %q)", len(ids), req.Type)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, fmt.Sprintf("purge failed after %d tasks: %v", len(ids), err), CodeInternal)
+		return
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(purgeResp{Purged: len(ids), JobIDs: ids})
+}
+
+type terminateDBReq struct {
+	// Terminate ends the job's sessions instead of only cancelling their
+	// current queries.
+	Terminate bool `json:"terminate"`
+}
+
+type terminateDBResp struct {
+	JobID    string  `json:"jobId"`
+	Database string  `json:"database"`
+	PIDs     []int32 `json:"pids"`
+}
+
+// TerminateJobQueries handles POST /api/jobs/{id}/terminate-db: it cancels
+// the Postgres queries a running job has in flight on its database, found
+// by the job ID in their application_name. The job itself carries on and
+// typically fails on the cancelled query.
+func (h *AdminHandler) TerminateJobQueries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		MethodNotAllowed(w, r)
+		return
+	}
+	id := jobIDFromPath(r.URL.Path, "/terminate-db")
+	if id == "" {
+		writeJSONError(w, r, http.StatusBadRequest, "missing id", CodeInvalidRequest)
+		return
+	}
+	var req terminateDBReq
+	if r.ContentLength != 0 {
+		if err := decodeJSON(w, r, &req); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+			return
+		}
+	}
+	job, ok := h.Jobs.Snapshot(id)
+	if !ok {
+		NotFound(w, r)
+		return
+	}
+	if job.Status != models.StatusRunning {
+		writeJSONError(w, r, http.StatusConflict, "job is "+string(job.Status)+", not running", CodeJobNotRunning)
+		return
+	}
+	pids, err := h.Manager.SignalJobSessions(r.Context(), job.Database, id, req.Terminate)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, err.Error(), CodeInternal)
+		return
+	}
+	log.Printf("WARNING: signalled %d %s sessions of job %s (terminate=%t): %v", len(pids), job.Database, id, req.Terminate, pids)
+	if pids == nil {
+		pids = []int32{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(terminateDBResp{JobID: id, Database: job.Database, PIDs: pids})
+}
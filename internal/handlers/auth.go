@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RequireAPIKey guards next with a shared key sent as X-API-Key or as an
+// Authorization bearer token. An empty key disables the endpoint entirely
+// rather than leaving it open.
+func RequireAPIKey(key string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if key == "" {
+			writeJSONError(w, r, http.StatusForbidden, "admin API is disabled; set ADMIN_API_KEY to enable", CodeForbidden)
+			return
+		}
+		got := r.Header.Get("X-API-Key")
+		if got == "" {
+			if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				got = strings.TrimPrefix(auth, "Bearer ")
+			}
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(key)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, r, http.StatusUnauthorized, "missing or invalid API key", CodeUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+const maxPrincipalLen = 128
+
+// principal identifies who asked for a job, for the audit log: the
+// X-Requested-By header when the client sets one, otherwise the remote
+// address. It is informational, not authenticated.
+func principal(r *http.Request) string {
+	if p := strings.TrimSpace(r.Header.Get("X-Requested-By")); p != "" {
+		if len(p) > maxPrincipalLen {
+			p = p[:maxPrincipalLen]
+		}
+		return p
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+	"github.com/koilabcode/multiboard-sync-service/internal/queue"
+)
+
+// maxBundleFiles caps the dumps one bundle import may name.
+const maxBundleFiles = 200
+
+type bundleReq struct {
+	JobID    string `json:"jobId"`
+	Target   string `json:"target"`
+	Priority string `json:"priority"`
+	// Files are dump paths relative to the dumps directory, imported in the
+	// order given; Dir instead imports every dump directly in a directory
+	// there, in name order.
+	Files []string `json:"files"`
+	Dir   string   `json:"dir"`
+
+	Transactional     bool              `json:"transactional"`
+	Parallel          bool              `json:"parallel"`
+	RebuildIndexes    bool              `json:"rebuildIndexes"`
+	SkipAnalyze       bool              `json:"skipAnalyze"`
+	ConfirmProduction bool              `json:"confirmProduction"`
+	Labels            map[string]string `json:"labels"`
+	Force             bool              `json:"force"`
+}
+
+// StartBundle handles POST /api/sync/import/bundle: it imports several dumps
+// into the target one after another under a single job. Dumps do not record
+// the foreign keys between them, so the order is the caller's to get right,
+// e.g. referenced tables first; each dump is imported, and transactional
+// applies, on its own.
+func (h *ImportHandler) StartBundle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		MethodNotAllowed(w, r)
+		return
+	}
+	var req bundleReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return
+	}
+	req.Target = strings.ToLower(strings.TrimSpace(req.Target))
+	ireq := importReq{
+		JobID:             req.JobID,
+		Target:            req.Target,
+		Priority:          req.Priority,
+		Transactional:     req.Transactional,
+		Parallel:          req.Parallel,
+		RebuildIndexes:    req.RebuildIndexes,
+		SkipAnalyze:       req.SkipAnalyze,
+		ConfirmProduction: req.ConfirmProduction,
+		Labels:            req.Labels,
+		Force:             req.Force,
+	}
+	if !h.validateTarget(w, r, ireq) {
+		return
+	}
+	paths, err := bundlePaths(req.Files, req.Dir)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return
+	}
+
+	files := make([]queue.BundleFile, 0, len(paths))
+	for _, p := range paths {
+		if h.dumpOf(p, req.Target) {
+			writeJSONError(w, r, http.StatusBadRequest, fmt.Sprintf("%s is a dump of %s itself", p, req.Target), CodeInvalidDatabase)
+			return
+		}
+		st, err := os.Stat(p)
+		if err != nil || st.IsDir() {
+			writeJSONError(w, r, http.StatusBadRequest, "dump "+p+" not found", CodeNoExport)
+			return
+		}
+		size, err := importSize(p, st)
+		if err != nil {
+			writeJSONError(w, r, http.StatusUnprocessableEntity, "failed to read dump index of "+p+": "+err.Error(), CodeInvalidDump)
+			return
+		}
+		if req.Transactional && createsIndexesConcurrently(p, size) {
+			writeJSONError(w, r, http.StatusBadRequest, p+" creates indexes concurrently, which cannot run in a transaction; import it with transactional: false", CodeInvalidRequest)
+			return
+		}
+		files = append(files, queue.BundleFile{Path: p, Size: size})
+	}
+
+	id, err := createJob(h.Jobs, req.JobID, &models.Job{
+		Database:    req.Target,
+		Trigger:     models.TriggerAPI,
+		RequestedBy: principal(r),
+		Labels:      req.Labels,
+		Status:      models.StatusPending,
+	})
+	if !jobCreated(w, r, h.Jobs, id, err) {
+		return
+	}
+
+	typ, payload, err := queue.NewImportBundleTask(queue.ImportBundleTaskPayload{
+		ImportTaskPayload: queue.ImportTaskPayload{
+			Target:         req.Target,
+			JobID:          id,
+			Transactional:  req.Transactional,
+			Parallel:       req.Parallel,
+			RebuildIndexes: req.RebuildIndexes,
+			SkipAnalyze:    req.SkipAnalyze,
+			Labels:         req.Labels,
+			Force:          req.Force,
+		},
+		Files: files,
+	})
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to create task", CodeInternal)
+		return
+	}
+	if err := enqueueJob(h.Jobs, h.Client, h.JobTimeout, id, typ, payload, req.Priority); err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "enqueue failed", CodeEnqueueFailed)
+		return
+	}
+
+	writeJobAccepted(w, id)
+}
+
+// bundlePaths resolves the dumps a bundle request names to paths under the
+// dumps directory, in import order.
+func bundlePaths(files []string, dir string) ([]string, error) {
+	if (len(files) == 0) == (dir == "") {
+		return nil, fmt.Errorf("exactly one of files and dir is required")
+	}
+	if dir != "" {
+		d, err := dumpsPath(dir)
+		if err != nil {
+			return nil, err
+		}
+		// ReadDir returns the entries sorted by name.
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			return nil, fmt.Errorf("dir %q not found", dir)
+		}
+		for _, e := range entries {
+			if !e.IsDir() && validDumpName(e.Name()) && !export.IsPartFile(e.Name()) {
+				files = append(files, filepath.Join(dir, e.Name()))
+			}
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no dumps in dir %q", dir)
+		}
+	}
+	if len(files) > maxBundleFiles {
+		return nil, fmt.Errorf("a bundle can import at most %d dumps", maxBundleFiles)
+	}
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		p, err := dumpsPath(f)
+		if err != nil {
+			return nil, err
+		}
+		if name := filepath.Base(p); !validDumpName(name) || export.IsPartFile(name) {
+			return nil, fmt.Errorf("%q is not an importable dump", f)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// dumpsPath joins rel to the dumps directory, refusing paths that would
+// leave it.
+func dumpsPath(rel string) (string, error) {
+	clean := filepath.Clean(rel)
+	if rel == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is not a path inside the dumps directory", rel)
+	}
+	return filepath.Join("dumps", clean), nil
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/config"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/queue"
+)
+
+// ConfigHandler reports the settings the service is actually running with,
+// for checking that an environment change took effect.
+type ConfigHandler struct {
+	Config   config.Config
+	Manager  *database.Manager
+	DumpsDir string
+}
+
+type configResp struct {
+	Config            config.Redacted   `json:"config"`
+	Databases         map[string]string `json:"databases"`
+	DumpsDir          string            `json:"dumpsDir"`
+	WorkerConcurrency int               `json:"workerConcurrency"`
+}
+
+func (h *ConfigHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		MethodNotAllowed(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(configResp{
+		Config:            h.Config.Redacted(),
+		Databases:         h.Manager.RedactedURLs(),
+		DumpsDir:          h.DumpsDir,
+		WorkerConcurrency: queue.WorkerConcurrency,
+	})
+}
@@ -29,7 +29,7 @@ type testResp struct {
 
 func (h DatabasesHandler) List(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		MethodNotAllowed(w, r)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -38,13 +38,16 @@ func (h DatabasesHandler) List(w http.ResponseWriter, r *http.Request) {
 
 func (h DatabasesHandler) Test(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		MethodNotAllowed(w, r)
 		return
 	}
 	var req testReq
-	dec := json.NewDecoder(r.Body)
-	if err := dec.Decode(&req); err != nil || req.Database == "" {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return
+	}
+	if req.Database == "" {
+		writeJSONError(w, r, http.StatusBadRequest, "database is required", CodeInvalidRequest)
 		return
 	}
 	connected, version, err := h.Manager.TestConnection(r.Context(), req.Database)
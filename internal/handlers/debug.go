@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+var startTime = time.Now()
+
+type debugVarsResp struct {
+	Goroutines int              `json:"goroutines"`
+	NumCPU     int              `json:"numCpu"`
+	GoVersion  string           `json:"goVersion"`
+	Uptime     string           `json:"uptime"`
+	MemStats   runtime.MemStats `json:"memstats"`
+}
+
+// DebugVars handles GET /debug/vars with the goroutine count and memory
+// statistics of the running process.
+func DebugVars(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		MethodNotAllowed(w, r)
+		return
+	}
+	resp := debugVarsResp{
+		Goroutines: runtime.NumGoroutine(),
+		NumCPU:     runtime.NumCPU(),
+		GoVersion:  runtime.Version(),
+		Uptime:     time.Since(startTime).Round(time.Second).String(),
+	}
+	runtime.ReadMemStats(&resp.MemStats)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RegisterDebug mounts the net/http/pprof handlers under /debug/pprof/ and
+// DebugVars at /debug/vars, each wrapped by guard.
+func RegisterDebug(mux *http.ServeMux, guard func(http.HandlerFunc) http.HandlerFunc) {
+	mux.HandleFunc("/debug/pprof/", guard(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", guard(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", guard(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", guard(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", guard(pprof.Trace))
+	mux.HandleFunc("/debug/vars", guard(DebugVars))
+}
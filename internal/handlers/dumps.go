@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+)
+
+type DumpsHandler struct {
+	Dir string
+}
+
+func validDumpName(name string) bool {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return false
+	}
+	return strings.HasSuffix(name, ".sql") || strings.HasSuffix(name, ".sql.gz") ||
+		strings.HasSuffix(name, export.IndexSuffix)
+}
+
+type dumpEntry struct {
+	Name       string    `json:"name"`
+	Database   string    `json:"database"`
+	Timestamp  string    `json:"timestamp"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+}
+
+// List handles GET /api/dumps, newest first. ?database= narrows it to one
+// database; the timestamps are what POST /api/sync/restore accepts.
+func (h *DumpsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		MethodNotAllowed(w, r)
+		return
+	}
+	want := r.URL.Query().Get("database")
+	entries, err := os.ReadDir(h.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to list dumps", CodeInternal)
+		return
+	}
+	out := make([]dumpEntry, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !validDumpName(name) || export.IsPartFile(name) {
+			continue
+		}
+		i := strings.Index(name, "_")
+		if i <= 0 || (want != "" && name[:i] != want) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		size := info.Size()
+		if strings.HasSuffix(name, export.IndexSuffix) {
+			if x, err := export.ReadPartIndex(filepath.Join(h.Dir, name)); err == nil {
+				size = x.TotalSize()
+			}
+		}
+		out = append(out, dumpEntry{
+			Name:       name,
+			Database:   name[:i],
+			Timestamp:  dumpTimestamp(name, name[:i]),
+			Size:       size,
+			ModifiedAt: info.ModTime().UTC(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ModifiedAt.After(out[j].ModifiedAt) })
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// Download handles GET /api/dumps/{name}. Uncompressed dumps carry their
+// manifest checksum as a strong ETag; http.ServeContent takes care of
+// Last-Modified, conditional requests and ranges.
+func (h *DumpsHandler) Download(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		MethodNotAllowed(w, r)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/api/dumps/")
+	if !validDumpName(name) {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid dump name", CodeInvalidRequest)
+		return
+	}
+	f, err := os.Open(filepath.Join(h.Dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			NotFound(w, r)
+			return
+		}
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to open dump", CodeInternal)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil || st.IsDir() {
+		NotFound(w, r)
+		return
+	}
+	contentType := "application/sql"
+	if strings.HasSuffix(name, ".gz") {
+		contentType = "application/gzip"
+	} else if strings.HasSuffix(name, export.IndexSuffix) {
+		contentType = "application/json"
+	} else if m, err := export.ReadManifest(f, st.Size()); err == nil && m != nil && m.Checksum != "" {
+		w.Header().Set("ETag", `"`+m.Checksum+`"`)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeContent(w, r, name, st.ModTime(), f)
+}
+
+// Info handles GET /api/dumps/{name}/info. For a multi-part dump's index the
+// parts are inspected together as one dump.
+func (h *DumpsHandler) Info(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		MethodNotAllowed(w, r)
+		return
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/dumps/"), "/info")
+	if !validDumpName(name) {
+		writeJSONError(w, r, http.StatusBadRequest, "invalid dump name", CodeInvalidRequest)
+		return
+	}
+	f, err := os.Open(filepath.Join(h.Dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			NotFound(w, r)
+			return
+		}
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to open dump", CodeInternal)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil || st.IsDir() {
+		NotFound(w, r)
+		return
+	}
+	var dump io.Reader = f
+	size := st.Size()
+	if strings.HasSuffix(name, export.IndexSuffix) {
+		parts, x, err := export.OpenParts(filepath.Join(h.Dir, name))
+		if err != nil {
+			writeJSONError(w, r, http.StatusUnprocessableEntity, "failed to read dump index: "+err.Error(), CodeInvalidDump)
+			return
+		}
+		defer parts.Close()
+		dump, size = parts, x.TotalSize()
+	}
+	info, err := export.InspectDump(dump)
+	if err != nil {
+		writeJSONError(w, r, http.StatusUnprocessableEntity, "failed to read dump: "+err.Error(), CodeInvalidDump)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"name":       name,
+		"size":       size,
+		"modifiedAt": st.ModTime().UTC(),
+		"info":       info,
+	})
+}
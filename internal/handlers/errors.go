@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeInvalidDatabase      = "invalid_database"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeNoExport             = "no_export"
+	CodeEnqueueFailed        = "enqueue_failed"
+	CodeInternal             = "internal_error"
+	CodeInvalidDump          = "invalid_dump"
+	CodeConfirmationRequired = "confirmation_required"
+	CodeTooLarge             = "too_large"
+	CodeJobNotRunning        = "job_not_running"
+	CodeJobNotRetryable      = "job_not_retryable"
+	CodeMaintenance          = "maintenance"
+	CodeNoTables             = "no_tables"
+)
+
+type errorResp struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// writeJSONError writes {"error":...,"code":...} with the given status.
+// Clients that explicitly ask for text/plain (and not JSON) keep getting the
+// plain http.Error body they used to.
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, message, code string) {
+	if wantsPlainText(r) {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResp{Error: message, Code: code})
+}
+
+func wantsPlainText(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json")
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, r, http.StatusMethodNotAllowed, "method not allowed", CodeMethodNotAllowed)
+}
+
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, r, http.StatusNotFound, "not found", CodeNotFound)
+}
+
+func InternalError(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, r, http.StatusInternalServerError, "internal error", CodeInternal)
+}
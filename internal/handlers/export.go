@@ -2,28 +2,41 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
 	"github.com/koilabcode/multiboard-sync-service/internal/models"
 	"github.com/koilabcode/multiboard-sync-service/internal/queue"
 )
 
 type ExportHandler struct {
-	Jobs   *models.JobStore
-	Client *asynq.Client
+	Jobs       *models.JobStore
+	Client     *asynq.Client
+	JobTimeout time.Duration
 }
 
 type exportReq struct {
-	Database string `json:"database"`
+	JobID    string            `json:"jobId"`
+	Database string            `json:"database"`
+	Priority string            `json:"priority"`
+	Labels   map[string]string `json:"labels"`
+	export.ExportOptions
 }
 
 func (h *ExportHandler) StartExport(w http.ResponseWriter, r *http.Request) {
 	var req exportReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Database == "" {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return
+	}
+	if req.Database == "" {
+		writeJSONError(w, r, http.StatusBadRequest, "database is required", CodeInvalidRequest)
 		return
 	}
 	validDBs := map[string]bool{
@@ -33,28 +46,144 @@ func (h *ExportHandler) StartExport(w http.ResponseWriter, r *http.Request) {
 		"production": true,
 	}
 	if !validDBs[req.Database] {
-		http.Error(w, "Invalid database name", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid database name", CodeInvalidDatabase)
+		return
+	}
+	if !queue.ValidPriority(req.Priority) {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid priority; expected 'high', 'default' or 'low'", CodeInvalidRequest)
+		return
+	}
+	if err := req.ExportOptions.Validate(); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return
+	}
+	if err := validateJobID(req.JobID); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
 		return
 	}
-	id := uuid.New().String()
-	h.Jobs.Create(&models.Job{
-		ID:       id,
-		Database: req.Database,
-		Status:   models.StatusPending,
-		Progress: 0,
+	id, err := createJob(h.Jobs, req.JobID, &models.Job{
+		Database:    req.Database,
+		Trigger:     models.TriggerAPI,
+		RequestedBy: principal(r),
+		Labels:      req.Labels,
+		Status:      models.StatusPending,
 	})
-	typ, payload, err := queue.NewExportTask(req.Database, id)
+	if !jobCreated(w, r, h.Jobs, id, err) {
+		return
+	}
+	typ, payload, err := queue.NewExportTask(req.Database, id, req.ExportOptions, req.Labels)
 	if err != nil {
-		http.Error(w, "failed to create task", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to create task", CodeInternal)
 		return
 	}
-	task := asynq.NewTask(typ, payload)
-	if _, err := h.Client.Enqueue(task, asynq.Queue("default")); err != nil {
+	if err := enqueueJob(h.Jobs, h.Client, h.JobTimeout, id, typ, payload, req.Priority); err != nil {
 		log.Printf("enqueue error: %v", err)
-		http.Error(w, "enqueue failed", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "enqueue failed", CodeEnqueueFailed)
 		return
 	}
+	writeJobAccepted(w, id)
+}
+
+// ListJobs handles GET /api/jobs. Each ?label=key:value narrows the list to
+// jobs carrying that label; the summary counts the jobs listed by status.
+func (h *ExportHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	want := make(map[string]string)
+	for _, l := range r.URL.Query()["label"] {
+		i := strings.Index(l, ":")
+		if i <= 0 {
+			writeJSONError(w, r, http.StatusBadRequest, "label filter must be key:value", CodeInvalidRequest)
+			return
+		}
+		want[l[:i]] = l[i+1:]
+	}
+	jobs := h.Jobs.List()
+	if len(want) > 0 {
+		filtered := jobs[:0]
+		for _, j := range jobs {
+			if j.HasLabels(want) {
+				filtered = append(filtered, j)
+			}
+		}
+		jobs = filtered
+	}
 	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(jobListResp{
+		Jobs:    jobs,
+		Summary: models.Summarize(jobs),
+		Total:   len(jobs),
+	})
+}
+
+type jobListResp struct {
+	Jobs    []models.Job   `json:"jobs"`
+	Summary models.Summary `json:"summary"`
+	Total   int            `json:"total"`
+}
+
+// createJob stores job under id, or under a fresh random ID when id is
+// empty, and returns the ID. An existing job is never overwritten: a
+// client-supplied id that is taken fails with models.ErrJobExists, while a
+// generated one is replaced by another.
+func createJob(jobs *models.JobStore, id string, job *models.Job) (string, error) {
+	if id != "" {
+		job.ID = id
+		return id, jobs.Create(job)
+	}
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		job.ID = uuid.New().String()
+		if err = jobs.Create(job); !errors.Is(err, models.ErrJobExists) {
+			break
+		}
+	}
+	return job.ID, err
+}
+
+// jobCreated reports whether createJob created the job id. Otherwise it
+// writes the response: for an id taken by an earlier request with the same
+// client-supplied ID, 200 with that job's status, so retried requests are
+// idempotent.
+func jobCreated(w http.ResponseWriter, r *http.Request, jobs *models.JobStore, id string, err error) bool {
+	if errors.Is(err, models.ErrJobExists) {
+		j, ok := jobs.Snapshot(id)
+		if !ok {
+			writeJSONError(w, r, http.StatusInternalServerError, "failed to create job", CodeInternal)
+			return false
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/jobs/"+id)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"jobId":  id,
+			"status": string(j.Status),
+		})
+		return false
+	}
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to create job", CodeInternal)
+		return false
+	}
+	return true
+}
+
+// enqueueJob enqueues the task of job id, recording it on the job first so
+// the job can be retried with the same parameters.
+func enqueueJob(jobs *models.JobStore, client *asynq.Client, jobTimeout time.Duration, id, typ string, payload []byte, priority string) error {
+	jobs.Update(id, func(j *models.Job) {
+		j.Request = &models.JobRequest{Type: typ, Payload: payload, Priority: priority}
+	})
+	_, err := client.Enqueue(asynq.NewTask(typ, payload), queue.TaskOptions(jobTimeout, priority)...)
+	return err
+}
+
+// writeJobAccepted answers a request that queued a job: 202 with the job's
+// URL in Location, so clients can follow it to poll status.
+func writeJobAccepted(w http.ResponseWriter, id string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+id)
 	w.WriteHeader(http.StatusAccepted)
 	_ = json.NewEncoder(w).Encode(map[string]string{
 		"jobId":  id,
@@ -62,30 +191,46 @@ func (h *ExportHandler) StartExport(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *ExportHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
-	jobs := h.Jobs.List()
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(jobs)
-}
-
-func (h *ExportHandler) GetJob(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
+func jobIDFromPath(path, suffix string) string {
+	path = strings.TrimSuffix(path, suffix)
 	i := len(path) - 1
 	for i >= 0 && path[i] != '/' {
 		i--
 	}
-	id := ""
 	if i >= 0 && i < len(path)-1 {
-		id = path[i+1:]
+		return path[i+1:]
 	}
+	return ""
+}
+
+func (h *ExportHandler) GetJobLogs(w http.ResponseWriter, r *http.Request) {
+	id := jobIDFromPath(r.URL.Path, "/logs")
+	if id == "" {
+		writeJSONError(w, r, http.StatusBadRequest, "missing id", CodeInvalidRequest)
+		return
+	}
+	lines, ok := h.Jobs.Logs(id)
+	if !ok {
+		NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"jobId": id,
+		"logs":  lines,
+	})
+}
+
+func (h *ExportHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	id := jobIDFromPath(r.URL.Path, "")
 	if id == "" {
-		http.Error(w, "missing id", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "missing id", CodeInvalidRequest)
 		return
 	}
-	if job, ok := h.Jobs.Get(id); ok {
+	if job, ok := h.Jobs.Snapshot(id); ok {
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(job)
 		return
 	}
-	http.NotFound(w, r)
+	NotFound(w, r)
 }
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+)
+
+func TestCreateJob(t *testing.T) {
+	jobs := models.NewJobStore()
+	id, err := createJob(jobs, "client-1", &models.Job{Database: "dev"})
+	if err != nil || id != "client-1" {
+		t.Fatalf("createJob with a client ID = %q, %v", id, err)
+	}
+	// A repeated client-supplied ID is reported, not overwritten.
+	if _, err := createJob(jobs, "client-1", &models.Job{Database: "staging"}); !errors.Is(err, models.ErrJobExists) {
+		t.Errorf("createJob with a taken client ID = %v, want ErrJobExists", err)
+	}
+	if j, _ := jobs.Snapshot("client-1"); j.Database != "dev" {
+		t.Errorf("job client-1 is for %q after a duplicate request, want dev", j.Database)
+	}
+
+	seen := map[string]bool{"client-1": true}
+	for i := 0; i < 100; i++ {
+		id, err := createJob(jobs, "", &models.Job{Database: "dev"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[id] {
+			t.Fatalf("createJob reused ID %s", id)
+		}
+		seen[id] = true
+	}
+	if n := len(jobs.List()); n != len(seen) {
+		t.Errorf("store holds %d jobs, want %d", n, len(seen))
+	}
+}
@@ -3,17 +3,49 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 )
 
+type HealthHandler struct {
+	Maintenance *Maintenance
+	// WorkerHeartbeat returns when the queue worker was last seen alive.
+	// The service is unhealthy once it is older than HeartbeatTimeout.
+	WorkerHeartbeat  func() time.Time
+	HeartbeatTimeout time.Duration
+}
+
 type healthResp struct {
-	Status string `json:"status"`
+	Status      string           `json:"status"`
+	Maintenance MaintenanceState `json:"maintenance"`
+	Worker      *workerHealth    `json:"worker,omitempty"`
 }
 
-func Health(w http.ResponseWriter, r *http.Request) {
+type workerHealth struct {
+	Healthy       bool      `json:"healthy"`
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+}
+
+// Health reports the service as up, along with the maintenance mode. It stays
+// "ok" in maintenance mode since reads and running jobs are still served, but
+// answers 503 when the worker's heartbeat is stale so the process gets
+// restarted.
+func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		MethodNotAllowed(w, r)
 		return
 	}
+	resp := healthResp{Status: "ok", Maintenance: h.Maintenance.State()}
+	code := http.StatusOK
+	if h.WorkerHeartbeat != nil {
+		beat := h.WorkerHeartbeat()
+		resp.Worker = &workerHealth{Healthy: true, LastHeartbeat: beat.UTC()}
+		if h.HeartbeatTimeout > 0 && time.Since(beat) > h.HeartbeatTimeout {
+			resp.Status = "unhealthy"
+			resp.Worker.Healthy = false
+			code = http.StatusServiceUnavailable
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(healthResp{Status: "ok"})
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
 }
@@ -1,101 +1,417 @@
 package handlers
 
 import (
-	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/config"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
 	"github.com/koilabcode/multiboard-sync-service/internal/models"
 	"github.com/koilabcode/multiboard-sync-service/internal/queue"
+	"github.com/koilabcode/multiboard-sync-service/internal/sqlscript"
 )
 
 type ImportHandler struct {
-	Jobs   *models.JobStore
-	Client *asynq.Client
+	Jobs            *models.JobStore
+	Client          *asynq.Client
+	JobTimeout      time.Duration
+	AllowSwapImport bool
+	// TimestampFormat is the UTC layout of the timestamps in dump names.
+	TimestampFormat string
+	// DumpFilename is the template exports name their dumps with; nil means
+	// config.DefaultDumpFilename.
+	DumpFilename *config.FilenameTemplate
 }
 
 type importReq struct {
-	Source string `json:"source"`
-	Target string `json:"target"`
+	JobID    string `json:"jobId"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Strategy string `json:"strategy"`
+	Priority string `json:"priority"`
+
+	Transactional     bool              `json:"transactional"`
+	Parallel          bool              `json:"parallel"`
+	RebuildIndexes    bool              `json:"rebuildIndexes"`
+	SkipAnalyze       bool              `json:"skipAnalyze"`
+	ConfirmProduction bool              `json:"confirmProduction"`
+	Labels            map[string]string `json:"labels"`
+
+	// TargetSchema and TablePrefix load the dump beside the existing tables
+	// instead of over them.
+	TargetSchema string `json:"targetSchema"`
+	TablePrefix  string `json:"tablePrefix"`
+
+	// Force imports even when the dump's tables differ from the target's.
+	Force bool `json:"force"`
+}
+
+var remapNameRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// validateRemap restricts remap names to plain lower-case identifiers, so
+// they need no quoting in follow-up queries against the loaded tables.
+func validateRemap(schema, prefix string) error {
+	if schema != "" && (len(schema) > 63 || !remapNameRe.MatchString(schema)) {
+		return fmt.Errorf("invalid targetSchema %q: must be a lower-case identifier of at most 63 characters", schema)
+	}
+	if prefix != "" && (len(prefix) > 32 || !remapNameRe.MatchString(prefix)) {
+		return fmt.Errorf("invalid tablePrefix %q: must be a lower-case identifier of at most 32 characters", prefix)
+	}
+	return nil
+}
+
+// importTargets is the allow-list of import targets. Production-class
+// targets additionally require confirmProduction in the request.
+var importTargets = map[string]bool{
+	database.DBNameLocalhost: true,
 }
 
 func (h *ImportHandler) StartImport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		MethodNotAllowed(w, r)
 		return
 	}
 	var req importReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
 		return
 	}
 	req.Source = strings.ToLower(strings.TrimSpace(req.Source))
 	req.Target = strings.ToLower(strings.TrimSpace(req.Target))
-
-	validSrc := map[string]bool{"dev": true, "staging": true, "production": true, "localhost": true}
-	if !validSrc[req.Source] {
-		http.Error(w, "Invalid source", http.StatusBadRequest)
+	if !h.validate(w, r, req) {
 		return
 	}
-	if req.Target != "localhost" {
-		http.Error(w, "Invalid target; only 'localhost' is allowed", http.StatusBadRequest)
+
+	matches := h.dumpFiles(req.Source)
+	if len(matches) == 0 {
+		writeJSONError(w, r, http.StatusBadRequest, "No export found, please export first", CodeNoExport)
 		return
 	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ModTime.After(matches[j].ModTime) })
+	h.enqueue(w, r, req, matches[0].Path)
+}
 
-	pattern := filepath.Join("dumps", req.Source+"_*.sql")
-	matches, _ := filepath.Glob(pattern)
-	if len(matches) == 0 {
-		http.Error(w, "No export found, please export first", http.StatusBadRequest)
+type restoreReq struct {
+	Database  string `json:"database"`
+	Timestamp string `json:"timestamp"`
+	Priority  string `json:"priority"`
+
+	Transactional  bool              `json:"transactional"`
+	Parallel       bool              `json:"parallel"`
+	RebuildIndexes bool              `json:"rebuildIndexes"`
+	SkipAnalyze    bool              `json:"skipAnalyze"`
+	Labels         map[string]string `json:"labels"`
+}
+
+// Restore handles POST /api/sync/restore: it imports the dump of database
+// taken at timestamp into localhost. The timestamp is the one in the dump's
+// file name, in TimestampFormat or in the legacy local time format, or an
+// RFC 3339 time.
+func (h *ImportHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		MethodNotAllowed(w, r)
+		return
+	}
+	var req restoreReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
 		return
 	}
-	sort.Slice(matches, func(i, j int) bool {
-		fi, _ := os.Stat(matches[i])
-		fj, _ := os.Stat(matches[j])
-		var ti, tj time.Time
-		if fi != nil {
-			ti = fi.ModTime()
+	ts := strings.TrimSpace(req.Timestamp)
+	layout := timestampFormat(h.TimestampFormat)
+	want, ok := config.ParseDumpTimestamp(ts, layout)
+	if !ok {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "timestamp must be "+layout+" or RFC 3339", CodeInvalidRequest)
+			return
+		}
+		want = t
+	}
+	ir := importReq{
+		Source:         strings.ToLower(strings.TrimSpace(req.Database)),
+		Target:         database.DBNameLocalhost,
+		Priority:       req.Priority,
+		Transactional:  req.Transactional,
+		Parallel:       req.Parallel,
+		RebuildIndexes: req.RebuildIndexes,
+		SkipAnalyze:    req.SkipAnalyze,
+		Labels:         req.Labels,
+	}
+	if !h.validate(w, r, ir) {
+		return
+	}
+	for _, m := range h.dumpFiles(ir.Source) {
+		if t, ok := config.ParseDumpTimestamp(m.Timestamp, layout); ok && t.Equal(want) {
+			h.enqueue(w, r, ir, m.Path)
+			return
+		}
+	}
+	writeJSONError(w, r, http.StatusNotFound, fmt.Sprintf("no dump of %s taken at %s", ir.Source, ts), CodeNoExport)
+}
+
+// createsIndexesConcurrently reports whether the manifest of the dump at
+// path says it was exported with concurrentIndexes. Only plain dumps are
+// checked here; the worker refuses the statements in a transaction anyway.
+func createsIndexesConcurrently(path string, size int64) bool {
+	if !strings.HasSuffix(path, ".sql") {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	m, err := export.ReadManifest(f, size)
+	return err == nil && m != nil && m.ConcurrentIndexes
+}
+
+func timestampFormat(layout string) string {
+	if layout == "" {
+		return config.DefaultDumpTimestampFormat
+	}
+	return layout
+}
+
+// dumpTimestamp extracts the timestamp from a dump file name of the form
+// <database>_<timestamp><suffix>.
+func dumpTimestamp(name, db string) string {
+	name = strings.TrimPrefix(name, db+"_")
+	for _, suffix := range []string{".sql.gz", ".sql", export.IndexSuffix} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return ""
+}
+
+// dumpFile is an importable dump found under the dumps directory.
+type dumpFile struct {
+	Path string
+	// Timestamp is the {{.Timestamp}} part of the dump's name, "" if its
+	// name has none.
+	Timestamp string
+	ModTime   time.Time
+}
+
+// dumpFiles lists the importable dumps of source: single-file dumps and
+// multi-part indexes, but not the individual parts. Dumps are found
+// anywhere under the dumps directory by matching their paths against the
+// filename template, and against the default one so dumps exported before
+// the template was changed are still found.
+func (h *ImportHandler) dumpFiles(source string) []dumpFile {
+	matchers := []*config.DumpMatcher{defaultDumpFilename.Matcher(source)}
+	if h.DumpFilename != nil {
+		matchers = append([]*config.DumpMatcher{h.DumpFilename.Matcher(source)}, matchers...)
+	}
+	var out []dumpFile
+	filepath.WalkDir("dumps", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			// Hidden directories hold nothing importable.
+			if path != "dumps" && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !validDumpName(d.Name()) || export.IsPartFile(d.Name()) {
+			return nil
 		}
-		if fj != nil {
-			tj = fj.ModTime()
+		rel, err := filepath.Rel("dumps", path)
+		if err != nil {
+			return nil
 		}
-		return ti.After(tj)
+		base := trimDumpSuffix(rel)
+		for _, m := range matchers {
+			if ts, ok := m.Match(base); ok {
+				f := dumpFile{Path: path, Timestamp: ts}
+				if info, err := d.Info(); err == nil {
+					f.ModTime = info.ModTime()
+				}
+				out = append(out, f)
+				break
+			}
+		}
+		return nil
 	})
-	dumpPath := matches[0]
+	return out
+}
+
+// dumpOf reports whether path, under the dumps directory, is a dump of db.
+func (h *ImportHandler) dumpOf(path, db string) bool {
+	rel, err := filepath.Rel("dumps", path)
+	if err != nil {
+		return false
+	}
+	base := trimDumpSuffix(rel)
+	if _, ok := defaultDumpFilename.Matcher(db).Match(base); ok {
+		return true
+	}
+	if h.DumpFilename == nil {
+		return false
+	}
+	_, ok := h.DumpFilename.Matcher(db).Match(base)
+	return ok
+}
+
+// defaultDumpFilename is config.DefaultDumpFilename parsed.
+var defaultDumpFilename = func() *config.FilenameTemplate {
+	f, err := config.ParseFilenameTemplate(config.DefaultDumpFilename)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}()
+
+// trimDumpSuffix strips the .sql, .sql.gz or index suffix from a dump name.
+func trimDumpSuffix(name string) string {
+	for _, suffix := range []string{".sql.gz", ".sql", export.IndexSuffix} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// validate checks an import request, writing the error response and
+// returning false if it is not acceptable.
+func (h *ImportHandler) validate(w http.ResponseWriter, r *http.Request, req importReq) bool {
+	validSrc := map[string]bool{"dev": true, "staging": true, "production": true, "localhost": true}
+	if !validSrc[req.Source] {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid source", CodeInvalidDatabase)
+		return false
+	}
+	if req.Source == req.Target {
+		log.Printf("WARNING: rejected import with source and target both %q", req.Source)
+		writeJSONError(w, r, http.StatusBadRequest, "source and target must differ", CodeInvalidDatabase)
+		return false
+	}
+	return h.validateTarget(w, r, req)
+}
+
+// validateTarget checks everything about an import request but its source.
+func (h *ImportHandler) validateTarget(w http.ResponseWriter, r *http.Request, req importReq) bool {
+	if database.IsProductionClass(req.Target) {
+		log.Printf("WARNING: import into production-class database %q requested (source %q, confirmed=%t)", req.Target, req.Source, req.ConfirmProduction)
+		if !req.ConfirmProduction {
+			writeJSONError(w, r, http.StatusBadRequest, "importing into "+req.Target+" requires confirmProduction: true", CodeConfirmationRequired)
+			return false
+		}
+	}
+	if !importTargets[req.Target] {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid target; only 'localhost' is allowed", CodeInvalidDatabase)
+		return false
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return false
+	}
+	if err := validateJobID(req.JobID); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return false
+	}
+	if err := validateRemap(req.TargetSchema, req.TablePrefix); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return false
+	}
+	if req.Parallel && req.Transactional {
+		writeJSONError(w, r, http.StatusBadRequest, "parallel imports cannot be transactional", CodeInvalidRequest)
+		return false
+	}
+	if !queue.ValidPriority(req.Priority) {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid priority; expected 'high', 'default' or 'low'", CodeInvalidRequest)
+		return false
+	}
+	switch req.Strategy {
+	case "", queue.ImportStrategyDirect:
+	case queue.ImportStrategySwap:
+		if !h.AllowSwapImport {
+			writeJSONError(w, r, http.StatusForbidden, "swap imports are disabled; set ALLOW_SWAP_IMPORT=true to enable", CodeForbidden)
+			return false
+		}
+	default:
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid strategy; expected 'direct' or 'swap'", CodeInvalidRequest)
+		return false
+	}
+	return true
+}
+
+// importSize returns the size the worker measures an import's progress
+// against: the file's, or the total of the parts for a multi-part index.
+func importSize(path string, st os.FileInfo) (int64, error) {
+	if !strings.HasSuffix(path, export.IndexSuffix) {
+		return st.Size(), nil
+	}
+	x, err := export.ReadPartIndex(path)
+	if err != nil {
+		return 0, err
+	}
+	return x.TotalSize(), nil
+}
+
+// enqueue creates the job and queues the import of dumpPath.
+func (h *ImportHandler) enqueue(w http.ResponseWriter, r *http.Request, req importReq, dumpPath string) {
 	st, err := os.Stat(dumpPath)
 	if err != nil || st.IsDir() {
-		http.Error(w, "No export found, please export first", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "No export found, please export first", CodeNoExport)
+		return
+	}
+	dumpSize, err := importSize(dumpPath, st)
+	if err != nil {
+		writeJSONError(w, r, http.StatusUnprocessableEntity, "failed to read dump index: "+err.Error(), CodeInvalidDump)
+		return
+	}
+	if req.Transactional && createsIndexesConcurrently(dumpPath, dumpSize) {
+		writeJSONError(w, r, http.StatusBadRequest, "the dump creates indexes concurrently, which cannot run in a transaction; import it with transactional: false", CodeInvalidRequest)
 		return
 	}
 
-	id := uuid.New().String()
-	h.Jobs.Create(&models.Job{
-		ID:       id,
-		Database: req.Target,
-		Status:   models.StatusPending,
-		Progress: 0,
+	id, err := createJob(h.Jobs, req.JobID, &models.Job{
+		Database:    req.Target,
+		Trigger:     models.TriggerAPI,
+		RequestedBy: principal(r),
+		Labels:      req.Labels,
+		Status:      models.StatusPending,
 	})
+	if !jobCreated(w, r, h.Jobs, id, err) {
+		return
+	}
 
-	typ, payload, err := queue.NewImportTask(req.Source, req.Target, dumpPath, id, st.Size())
+	typ, payload, err := queue.NewImportTask(queue.ImportTaskPayload{
+		Source:         req.Source,
+		Target:         req.Target,
+		DumpPath:       dumpPath,
+		JobID:          id,
+		DumpSize:       dumpSize,
+		Strategy:       req.Strategy,
+		Transactional:  req.Transactional,
+		Parallel:       req.Parallel,
+		RebuildIndexes: req.RebuildIndexes,
+		SkipAnalyze:    req.SkipAnalyze,
+		Labels:         req.Labels,
+		Remap:          sqlscript.Remap{Schema: req.TargetSchema, Prefix: req.TablePrefix},
+		Force:          req.Force,
+	})
 	if err != nil {
-		http.Error(w, "failed to create task", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to create task", CodeInternal)
 		return
 	}
-	task := asynq.NewTask(typ, payload)
-	if _, err := h.Client.Enqueue(task, asynq.Queue("default")); err != nil {
-		http.Error(w, "enqueue failed", http.StatusInternalServerError)
+	if err := enqueueJob(h.Jobs, h.Client, h.JobTimeout, id, typ, payload, req.Priority); err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "enqueue failed", CodeEnqueueFailed)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
-	_ = json.NewEncoder(w).Encode(map[string]string{
-		"jobId":  id,
-		"status": "queued",
-	})
+	writeJobAccepted(w, id)
 }
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/config"
+)
+
+// inTempDir runs the test from an empty directory, where handlers look
+// for the dumps directory.
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func writeDumps(t *testing.T, names ...string) {
+	t.Helper()
+	for _, n := range names {
+		p := filepath.Join("dumps", n)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("SELECT 1;\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDumpFilesFollowsTemplate(t *testing.T) {
+	inTempDir(t)
+	writeDumps(t,
+		"production_20240101T000000Z.sql",
+		"production_20240101T000000Z.part001.sql",
+		"myapp/production/2024-01-02/full.sql",
+		"myapp/production/2024-01-02/full-2.sql.gz",
+		"myapp/production/2024-01-03/.full.sql.tmp",
+		"myapp/production/2024-01-03/notes.txt",
+		"myapp/staging/2024-01-02/full.sql",
+		".hidden/production/2024-01-02/full.sql",
+	)
+	tmpl, err := config.ParseFilenameTemplate(`myapp/{{.Database}}/{{.Time.Format "2006-01-02"}}/full.sql`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := func(h *ImportHandler) []string {
+		var out []string
+		for _, f := range h.dumpFiles("production") {
+			out = append(out, filepath.ToSlash(f.Path))
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	got := paths(&ImportHandler{DumpFilename: tmpl})
+	want := []string{
+		"dumps/myapp/production/2024-01-02/full-2.sql.gz",
+		"dumps/myapp/production/2024-01-02/full.sql",
+		"dumps/production_20240101T000000Z.sql",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dumpFiles with a template = %q, want %q", got, want)
+	}
+	// Without the template only the default naming is found.
+	got = paths(&ImportHandler{})
+	if want := []string{"dumps/production_20240101T000000Z.sql"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dumpFiles without a template = %q, want %q", got, want)
+	}
+
+	h := &ImportHandler{DumpFilename: tmpl}
+	if !h.dumpOf(filepath.Join("dumps", "myapp", "staging", "2024-01-02", "full.sql"), "staging") {
+		t.Error("dumpOf does not recognize a templated dump of staging")
+	}
+	if h.dumpOf(filepath.Join("dumps", "myapp", "staging", "2024-01-02", "full.sql"), "production") {
+		t.Error("dumpOf takes a dump of staging for one of production")
+	}
+}
+
+func TestDumpFilesTimestamp(t *testing.T) {
+	inTempDir(t)
+	writeDumps(t, "exports/dev/20240102T030405Z.sql", "exports/dev/20240102T030405Z-2.sql")
+	tmpl, err := config.ParseFilenameTemplate(`exports/{{.Database}}/{{.Timestamp}}.sql`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range (&ImportHandler{DumpFilename: tmpl}).dumpFiles("dev") {
+		got = append(got, f.Timestamp)
+	}
+	sort.Strings(got)
+	if want := []string{"20240102T030405Z", "20240102T030405Z-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("timestamps = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Maintenance is the service's maintenance mode. While it is on, requests
+// that would start a job are refused with 503; jobs already queued or
+// running carry on and read-only endpoints keep working.
+type Maintenance struct {
+	mu    sync.RWMutex
+	state MaintenanceState
+}
+
+type MaintenanceState struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+func NewMaintenance(enabled bool) *Maintenance {
+	m := &Maintenance{}
+	if enabled {
+		m.Set(true, "enabled at startup")
+	}
+	return m
+}
+
+func (m *Maintenance) Set(enabled bool, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !enabled {
+		m.state = MaintenanceState{}
+		return
+	}
+	now := time.Now().UTC()
+	m.state = MaintenanceState{Enabled: true, Reason: reason, Since: &now}
+}
+
+func (m *Maintenance) State() MaintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Guard refuses requests with 503 while maintenance mode is on.
+func (m *Maintenance) Guard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if st := m.State(); st.Enabled {
+			msg := "service is in maintenance mode; new jobs are not accepted"
+			if st.Reason != "" {
+				msg += ": " + st.Reason
+			}
+			w.Header().Set("Retry-After", "300")
+			writeJSONError(w, r, http.StatusServiceUnavailable, msg, CodeMaintenance)
+			return
+		}
+		next(w, r)
+	}
+}
+
+type maintenanceReq struct {
+	Enabled *bool  `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// Toggle handles /api/admin/maintenance: GET returns the current mode and
+// POST {"enabled": bool, "reason": "..."} switches it.
+func (m *Maintenance) Toggle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req maintenanceReq
+		if err := decodeJSON(w, r, &req); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+			return
+		}
+		if req.Enabled == nil {
+			writeJSONError(w, r, http.StatusBadRequest, "enabled is required", CodeInvalidRequest)
+			return
+		}
+		m.Set(*req.Enabled, req.Reason)
+		log.Printf("WARNING: maintenance mode set to %t by %s (reason %q)", *req.Enabled, principal(r), req.Reason)
+	default:
+		MethodNotAllowed(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m.State())
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// openAPISpec describes every route registered in cmd/server. It is kept by
+// hand: add new endpoints and request fields to it along with the handlers.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// ValidateOpenAPI checks that the embedded spec is an OpenAPI 3 document
+// whose local $refs all resolve. The server refuses to start otherwise, so
+// a broken edit cannot ship.
+func ValidateOpenAPI() error {
+	var doc map[string]any
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		return fmt.Errorf("openapi.json: %w", err)
+	}
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		return fmt.Errorf("openapi.json: unsupported openapi version %q", v)
+	}
+	if paths, _ := doc["paths"].(map[string]any); len(paths) == 0 {
+		return fmt.Errorf("openapi.json: no paths")
+	}
+	return checkRefs(doc, doc)
+}
+
+func checkRefs(doc map[string]any, v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			if !strings.HasPrefix(ref, "#/") {
+				return fmt.Errorf("openapi.json: non-local $ref %q", ref)
+			}
+			var node any = doc
+			for _, key := range strings.Split(ref[2:], "/") {
+				m, _ := node.(map[string]any)
+				if node = m[key]; node == nil {
+					return fmt.Errorf("openapi.json: unresolved $ref %q", ref)
+				}
+			}
+		}
+		for _, child := range v {
+			if err := checkRefs(doc, child); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if err := checkRefs(doc, child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// OpenAPI handles GET /api/openapi.json.
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		MethodNotAllowed(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+	"github.com/koilabcode/multiboard-sync-service/internal/queue"
+)
+
+func TestValidateOpenAPI(t *testing.T) {
+	if err := ValidateOpenAPI(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateOpenAPIRejectsBrokenSpecs(t *testing.T) {
+	tests := []struct {
+		name, spec, wantErr string
+	}{
+		{"invalid json", `{"openapi": "3.0.3",`, "openapi.json"},
+		{"swagger 2", `{"openapi": "2.0", "paths": {"/a": {}}}`, "unsupported openapi version"},
+		{"no paths", `{"openapi": "3.0.3", "paths": {}}`, "no paths"},
+		{"unresolved ref", `{"openapi": "3.0.3", "paths": {"/a": {"$ref": "#/components/schemas/Nope"}}}`, "unresolved $ref"},
+		{"remote ref", `{"openapi": "3.0.3", "paths": {"/a": {"$ref": "other.json#/A"}}}`, "non-local $ref"},
+	}
+	saved := openAPISpec
+	defer func() { openAPISpec = saved }()
+	for _, tt := range tests {
+		openAPISpec = []byte(tt.spec)
+		if err := ValidateOpenAPI(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: ValidateOpenAPI() = %v, want an error about %s", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// jsonFields returns the JSON names of the fields of the struct type t,
+// including those of embedded structs.
+func jsonFields(t reflect.Type) []string {
+	var out []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		switch {
+		case name == "-":
+		case f.Anonymous && name == "":
+			out = append(out, jsonFields(f.Type)...)
+		case f.IsExported():
+			if name == "" {
+				name = f.Name
+			}
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+type openAPISchema struct {
+	Ref        string                     `json:"$ref"`
+	Properties map[string]json.RawMessage `json:"properties"`
+	AllOf      []openAPISchema            `json:"allOf"`
+}
+
+// TestOpenAPIMatchesTypes checks that the spec's schemas list exactly the
+// fields the handlers decode and encode.
+func TestOpenAPIMatchesTypes(t *testing.T) {
+	var doc struct {
+		Components struct {
+			Schemas map[string]openAPISchema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatal(err)
+	}
+	// properties collects the properties of a schema and of those it
+	// combines with allOf.
+	var properties func(s openAPISchema) []string
+	properties = func(s openAPISchema) []string {
+		var out []string
+		for p := range s.Properties {
+			out = append(out, p)
+		}
+		for _, sub := range s.AllOf {
+			if sub.Ref != "" {
+				sub = doc.Components.Schemas[strings.TrimPrefix(sub.Ref, "#/components/schemas/")]
+			}
+			out = append(out, properties(sub)...)
+		}
+		return out
+	}
+	for schema, v := range map[string]any{
+		"ExportRequest":       exportReq{},
+		"ImportRequest":       importReq{},
+		"ImportBundleRequest": bundleReq{},
+		"RestoreRequest":      restoreReq{},
+		"TableSyncRequest":    tableSyncReq{},
+		"VerifyRequest":       verifyReq{},
+		"Job":                 models.Job{},
+		"JobSummary":          models.Summary{},
+		"Dump":                dumpEntry{},
+	} {
+		s, ok := doc.Components.Schemas[schema]
+		if !ok {
+			t.Errorf("schema %s missing", schema)
+			continue
+		}
+		props := properties(s)
+		fields := jsonFields(reflect.TypeOf(v))
+		sort.Strings(props)
+		sort.Strings(fields)
+		if !reflect.DeepEqual(props, fields) {
+			t.Errorf("schema %s has properties %q, but %T has fields %q", schema, props, v, fields)
+		}
+	}
+}
+
+func TestOpenAPITaskTypes(t *testing.T) {
+	spec := string(openAPISpec)
+	for _, typ := range []string{queue.TypeExport, queue.TypeImport, queue.TypeImportBundle, queue.TypeTableSync, queue.TypeVerify} {
+		if !strings.Contains(spec, `"`+typ+`"`) {
+			t.Errorf("openapi.json does not list task type %s", typ)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const maxBodyBytes = 1 << 20
+
+// decodeJSON decodes a single JSON object from the request body into dst.
+// Bodies over maxBodyBytes, unknown fields and trailing data are rejected
+// with a message suitable for a 400 response.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return describeDecodeError(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("request body must contain a single JSON object")
+	}
+	return nil
+}
+
+func describeDecodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("malformed JSON at offset %d", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("malformed JSON: unexpected end of body")
+	case errors.Is(err, io.EOF):
+		return errors.New("request body is empty")
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("invalid value for field %q: expected %s", typeErr.Field, typeErr.Type)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return fmt.Errorf("unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	case err.Error() == "http: request body too large":
+		return fmt.Errorf("request body exceeds %d bytes", maxBodyBytes)
+	}
+	return err
+}
+
+const (
+	maxLabels      = 20
+	maxLabelKeyLen = 64
+	maxLabelValLen = 256
+)
+
+var jobIDRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// maxJobIDLen leaves room for the ID in dump file names. Session tags do
+// not limit it: database.SessionKey shortens IDs too long for
+// application_name.
+const maxJobIDLen = 64
+
+// validateJobID accepts an empty ID (one is generated) or a UUID-like token
+// of letters, digits, '-' and '_', since IDs end up in URLs and file names.
+func validateJobID(id string) error {
+	if id != "" && (len(id) > maxJobIDLen || !jobIDRe.MatchString(id)) {
+		return fmt.Errorf("invalid jobId %q: must be 1-%d letters, digits, '-' or '_', starting with a letter or digit", id, maxJobIDLen)
+	}
+	return nil
+}
+
+func validateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return fmt.Errorf("at most %d labels are allowed", maxLabels)
+	}
+	for k, v := range labels {
+		if k == "" || len(k) > maxLabelKeyLen || strings.Contains(k, ":") {
+			return fmt.Errorf("invalid label key %q: must be 1-%d characters without ':'", k, maxLabelKeyLen)
+		}
+		if len(v) > maxLabelValLen {
+			return fmt.Errorf("label %q value exceeds %d characters", k, maxLabelValLen)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+)
+
+func TestValidateJobID(t *testing.T) {
+	tests := []struct {
+		id     string
+		wantOK bool
+	}{
+		{"", true},
+		{"job-1_a", true},
+		{"0f8fad5b-d9cb-469f-a165-70867728950e", true},
+		{strings.Repeat("a", maxJobIDLen), true},
+		{strings.Repeat("a", maxJobIDLen+1), false},
+		{"-job", false},
+		{"job/1", false},
+		{"job~1", false},
+		{"job 1", false},
+	}
+	for _, tt := range tests {
+		if err := validateJobID(tt.id); (err == nil) != tt.wantOK {
+			t.Errorf("validateJobID(%q) = %v, want ok %t", tt.id, err, tt.wantOK)
+		}
+	}
+}
+
+// TestLongestJobIDsKeepDistinctSessionKeys checks that IDs of the maximum
+// length, which do not fit application_name whole, still tag their
+// sessions apart.
+func TestLongestJobIDsKeepDistinctSessionKeys(t *testing.T) {
+	a := strings.Repeat("a", maxJobIDLen)
+	b := a[:maxJobIDLen-1] + "b"
+	ka, kb := database.SessionKey(a), database.SessionKey(b)
+	if ka == kb {
+		t.Errorf("%q and %q share the session key %q", a, b, ka)
+	}
+	if len(ka) >= len(a) {
+		t.Errorf("session key %q of a %d-character ID is not shortened", ka, len(a))
+	}
+}
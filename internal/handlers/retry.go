@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+	"github.com/koilabcode/multiboard-sync-service/internal/queue"
+)
+
+type RetryHandler struct {
+	Jobs       *models.JobStore
+	Client     *asynq.Client
+	JobTimeout time.Duration
+}
+
+// Retry handles POST /api/jobs/{id}/retry: it re-runs a failed or cancelled
+// job as a new job, with the task type, payload and priority the original
+// was enqueued with.
+func (h *RetryHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		MethodNotAllowed(w, r)
+		return
+	}
+	id := jobIDFromPath(r.URL.Path, "/retry")
+	if id == "" {
+		writeJSONError(w, r, http.StatusBadRequest, "missing id", CodeInvalidRequest)
+		return
+	}
+	job, ok := h.Jobs.Snapshot(id)
+	if !ok {
+		NotFound(w, r)
+		return
+	}
+	if job.Status != models.StatusFailed && job.Status != models.StatusCancelled {
+		writeJSONError(w, r, http.StatusConflict, "job is "+string(job.Status)+"; only failed or cancelled jobs can be retried", CodeJobNotRetryable)
+		return
+	}
+	if job.Request == nil {
+		writeJSONError(w, r, http.StatusConflict, "job has no recorded request to retry", CodeJobNotRetryable)
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(job.Request.Payload, &fields); err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "stored request is unreadable: "+err.Error(), CodeInternal)
+		return
+	}
+	retry := &models.Job{
+		Database:    job.Database,
+		Trigger:     models.TriggerAPI,
+		RequestedBy: principal(r),
+		Labels:      job.Labels,
+		RetryOf:     id,
+		Status:      models.StatusPending,
+	}
+	if job.Request.Type == queue.TypeTableSync {
+		retry.CurrentTable = job.CurrentTable
+	}
+	newID, err := createJob(h.Jobs, "", retry)
+	if !jobCreated(w, r, h.Jobs, newID, err) {
+		return
+	}
+	fields["jobId"], _ = json.Marshal(newID)
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to create task", CodeInternal)
+		return
+	}
+	if err := enqueueJob(h.Jobs, h.Client, h.JobTimeout, newID, job.Request.Type, payload, job.Request.Priority); err != nil {
+		log.Printf("enqueue error: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "enqueue failed", CodeEnqueueFailed)
+		return
+	}
+	log.Printf("job %s retried as %s", id, newID)
+	writeJobAccepted(w, newID)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/queue"
+)
+
+type SchedulesHandler struct {
+	Scheduler *queue.Scheduler
+}
+
+func (h *SchedulesHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		MethodNotAllowed(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"schedules": h.Scheduler.List(),
+	})
+}
+
+// Toggle handles POST /api/schedules/{id}/enable and /disable.
+func (h *SchedulesHandler) Toggle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		MethodNotAllowed(w, r)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/api/schedules/")
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || parts[0] == "" {
+		NotFound(w, r)
+		return
+	}
+	var enabled bool
+	switch parts[1] {
+	case "enable":
+		enabled = true
+	case "disable":
+		enabled = false
+	default:
+		NotFound(w, r)
+		return
+	}
+	sc, err := h.Scheduler.SetEnabled(parts[0], enabled)
+	if err != nil {
+		if errors.Is(err, queue.ErrScheduleNotFound) {
+			NotFound(w, r)
+			return
+		}
+		writeJSONError(w, r, http.StatusInternalServerError, err.Error(), CodeInternal)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(sc)
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// StaticFiles serves dir like http.FileServer, adding a weak ETag derived
+// from each file's size and modification time. Together with the
+// Last-Modified header that FileServer already sends, browsers revalidate
+// with conditional requests and get 304s for unchanged assets.
+func StaticFiles(dir string) http.Handler {
+	fs := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+		st, err := os.Stat(p)
+		if err == nil && st.IsDir() {
+			st, err = os.Stat(filepath.Join(p, "index.html"))
+		}
+		if err == nil {
+			w.Header().Set("ETag", fmt.Sprintf(`W/"%x-%x"`, st.ModTime().UnixNano(), st.Size()))
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		fs.ServeHTTP(w, r)
+	})
+}
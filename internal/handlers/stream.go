@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+)
+
+// StreamExportHandler runs an export synchronously and writes it straight
+// to the response, for databases small enough not to need a job. Production
+// is never streamed, since the estimate comes from planner statistics that
+// can badly undercount tables never analyzed; other exports estimated above
+// MaxRows or MaxBytes are refused before anything is read.
+type StreamExportHandler struct {
+	Exporter *export.Exporter
+	Masking  export.MaskingRules
+	Timeout  time.Duration
+	MaxRows  int64
+	MaxBytes int64
+	// TimestampFormat is the UTC layout of the timestamp in the suggested
+	// file name.
+	TimestampFormat string
+}
+
+// Export handles GET /api/databases/{name}/export.sql.
+func (h *StreamExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		MethodNotAllowed(w, r)
+		return
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/databases/"), "/export.sql")
+	if name == "" || strings.Contains(name, "/") {
+		NotFound(w, r)
+		return
+	}
+	if name == database.DBNameProduction {
+		writeJSONError(w, r, http.StatusForbidden, "production cannot be streamed; use POST /api/sync/export", CodeForbidden)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+	defer cancel()
+
+	opts := export.ExportOptions{Masking: h.Masking}
+	est, err := h.Exporter.Estimate(ctx, name, opts)
+	if err != nil {
+		if errors.Is(err, database.ErrDBNotConfigured) {
+			writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidDatabase)
+			return
+		}
+		writeJSONError(w, r, http.StatusInternalServerError, err.Error(), CodeInternal)
+		return
+	}
+	if est.Tables == 0 {
+		writeJSONError(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("%s for database %s", export.ErrNoTables, name), CodeNoTables)
+		return
+	}
+	if est.Rows > h.MaxRows || est.Bytes > h.MaxBytes {
+		msg := fmt.Sprintf("%s is too large to stream (about %d rows, %d bytes; limits %d rows, %d bytes); use POST /api/sync/export", name, est.Rows, est.Bytes, h.MaxRows, h.MaxBytes)
+		writeJSONError(w, r, http.StatusRequestEntityTooLarge, msg, CodeTooLarge)
+		return
+	}
+
+	now := time.Now()
+	filename := fmt.Sprintf("%s_%s.sql", name, now.UTC().Format(timestampFormat(h.TimestampFormat)))
+	w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	fmt.Fprintf(w, "-- Export started at %s\n\n", now.UTC().Format(time.RFC3339))
+	if _, err := h.Exporter.Export(ctx, name, w, opts, nil); err != nil {
+		// The status line is long gone; end the file with the error so it
+		// cannot pass for a complete dump (it also has no manifest).
+		log.Printf("streamed export of %s failed: %v", name, err)
+		fmt.Fprintf(w, "\n-- ERROR: export failed: %s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamExportRefusesProduction(t *testing.T) {
+	// The refusals come before the exporter is used, so none is needed.
+	h := RequireAPIKey("secret", (&StreamExportHandler{}).Export)
+	tests := []struct {
+		name, path, key string
+		want            int
+	}{
+		{"no key", "/api/databases/dev/export.sql", "", http.StatusUnauthorized},
+		{"wrong key", "/api/databases/dev/export.sql", "nope", http.StatusUnauthorized},
+		{"production", "/api/databases/production/export.sql", "secret", http.StatusForbidden},
+		{"production without a key", "/api/databases/production/export.sql", "", http.StatusUnauthorized},
+		{"nested name", "/api/databases/a/b/export.sql", "secret", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.key != "" {
+			r.Header.Set("X-API-Key", tt.key)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: GET %s = %d, want %d", tt.name, tt.path, w.Code, tt.want)
+		}
+	}
+}
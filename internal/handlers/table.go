@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+	"github.com/koilabcode/multiboard-sync-service/internal/queue"
+)
+
+type TableSyncHandler struct {
+	Jobs       *models.JobStore
+	Client     *asynq.Client
+	JobTimeout time.Duration
+	// Manager, when set, is used to refuse tables the target cannot
+	// truncate up front; the worker checks again either way.
+	Manager *database.Manager
+}
+
+type tableSyncReq struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Table    string `json:"table"`
+	Priority string `json:"priority"`
+}
+
+func (h *TableSyncHandler) StartTableSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		MethodNotAllowed(w, r)
+		return
+	}
+	var req tableSyncReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return
+	}
+	req.Source = strings.ToLower(strings.TrimSpace(req.Source))
+	req.Target = strings.ToLower(strings.TrimSpace(req.Target))
+
+	validSrc := map[string]bool{"dev": true, "staging": true, "production": true, "localhost": true}
+	if !validSrc[req.Source] {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid source", CodeInvalidDatabase)
+		return
+	}
+	if req.Target != "localhost" {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid target; only 'localhost' is allowed", CodeInvalidDatabase)
+		return
+	}
+	if req.Source == req.Target {
+		writeJSONError(w, r, http.StatusBadRequest, "source and target must differ", CodeInvalidDatabase)
+		return
+	}
+	if req.Table == "" || !(export.ExportOptions{}).Allows(req.Table) {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid table; it must be in the export include set", CodeInvalidRequest)
+		return
+	}
+	if !queue.ValidPriority(req.Priority) {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid priority; expected 'high', 'default' or 'low'", CodeInvalidRequest)
+		return
+	}
+	if h.Manager != nil {
+		refs, err := h.referencingTables(r.Context(), req.Target, req.Table)
+		if err != nil {
+			log.Printf("table sync: checking foreign keys to %s on %s: %v", req.Table, req.Target, err)
+		} else if len(refs) > 0 {
+			writeJSONError(w, r, http.StatusBadRequest, fmt.Sprintf("%s cannot be synced on its own: %s have foreign keys to it on %s; import a full dump instead", req.Table, strings.Join(refs, ", "), req.Target), CodeInvalidRequest)
+			return
+		}
+	}
+
+	id, err := createJob(h.Jobs, "", &models.Job{
+		Database:     req.Target,
+		Trigger:      models.TriggerAPI,
+		RequestedBy:  principal(r),
+		Status:       models.StatusPending,
+		CurrentTable: req.Table,
+	})
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to create job", CodeInternal)
+		return
+	}
+
+	typ, payload, err := queue.NewTableSyncTask(req.Source, req.Target, req.Table, id)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to create task", CodeInternal)
+		return
+	}
+	if err := enqueueJob(h.Jobs, h.Client, h.JobTimeout, id, typ, payload, req.Priority); err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "enqueue failed", CodeEnqueueFailed)
+		return
+	}
+
+	writeJobAccepted(w, id)
+}
+
+func (h *TableSyncHandler) referencingTables(ctx context.Context, target, table string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	pool, err := h.Manager.Pool(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return export.ReferencingTables(ctx, pool, export.DefaultSchema, table)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+	"github.com/koilabcode/multiboard-sync-service/internal/queue"
+)
+
+type VerifyHandler struct {
+	Jobs       *models.JobStore
+	Client     *asynq.Client
+	JobTimeout time.Duration
+}
+
+type verifyReq struct {
+	Source   string `json:"source"`
+	Priority string `json:"priority"`
+	export.ExportOptions
+}
+
+// StartVerify handles POST /api/sync/verify: export source, reimport it into
+// a scratch database on the localhost server and compare row counts.
+func (h *VerifyHandler) StartVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		MethodNotAllowed(w, r)
+		return
+	}
+	var req verifyReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return
+	}
+	req.Source = strings.ToLower(strings.TrimSpace(req.Source))
+
+	validSrc := map[string]bool{"dev": true, "staging": true, "production": true, "localhost": true}
+	if !validSrc[req.Source] {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid source", CodeInvalidDatabase)
+		return
+	}
+	if !queue.ValidPriority(req.Priority) {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid priority; expected 'high', 'default' or 'low'", CodeInvalidRequest)
+		return
+	}
+	if err := req.ExportOptions.Validate(); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error(), CodeInvalidRequest)
+		return
+	}
+
+	id, err := createJob(h.Jobs, "", &models.Job{
+		Database:    req.Source,
+		Trigger:     models.TriggerAPI,
+		RequestedBy: principal(r),
+		Status:      models.StatusPending,
+	})
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to create job", CodeInternal)
+		return
+	}
+
+	typ, payload, err := queue.NewVerifyTask(req.Source, id, req.ExportOptions)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "failed to create task", CodeInternal)
+		return
+	}
+	if err := enqueueJob(h.Jobs, h.Client, h.JobTimeout, id, typ, payload, req.Priority); err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "enqueue failed", CodeEnqueueFailed)
+		return
+	}
+
+	writeJobAccepted(w, id)
+}
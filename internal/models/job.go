@@ -1,6 +1,10 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"sync"
 	"time"
 )
@@ -11,57 +15,284 @@ const (
 	StatusPending   JobStatus = "pending"
 	StatusRunning   JobStatus = "running"
 	StatusCompleted JobStatus = "completed"
-	StatusFailed    JobStatus = "failed"
+	// StatusCompletedWithWarnings is a completed job that left something
+	// out, listed in its Warnings.
+	StatusCompletedWithWarnings JobStatus = "completed_with_warnings"
+	StatusFailed                JobStatus = "failed"
+	StatusCancelled             JobStatus = "cancelled"
+)
+
+const (
+	ErrCodeTimeout = "timeout"
+	// ErrCodeStalled marks a job failed because its progress stopped
+	// advancing.
+	ErrCodeStalled = "stalled"
+	// ErrCodeNoTables marks an export whose filters selected no tables.
+	ErrCodeNoTables = "no_tables"
+)
+
+const (
+	TriggerAPI      = "api"
+	TriggerSchedule = "schedule"
 )
 
 type Job struct {
-	ID           string     `json:"id"`
-	Database     string     `json:"database"`
-	Status       JobStatus  `json:"status"`
-	Progress     int        `json:"progress"`
-	StartedAt    *time.Time `json:"startedAt,omitempty"`
-	CompletedAt  *time.Time `json:"completedAt,omitempty"`
-	Error        string     `json:"error,omitempty"`
-	CurrentTable string     `json:"currentTable,omitempty"`
-	RowsExported int64      `json:"rowsExported,omitempty"`
+	ID           string            `json:"id"`
+	Database     string            `json:"database"`
+	Trigger      string            `json:"trigger,omitempty"`
+	RequestedBy  string            `json:"requestedBy,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Status       JobStatus         `json:"status"`
+	Progress     float64           `json:"progress"`
+	ProgressInt  int               `json:"progressInt"`
+	Phase        string            `json:"phase,omitempty"`
+	StartedAt    *time.Time        `json:"startedAt,omitempty"`
+	CompletedAt  *time.Time        `json:"completedAt,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	ErrorCode    string            `json:"errorCode,omitempty"`
+	CurrentTable string            `json:"currentTable,omitempty"`
+	RowsExported int64             `json:"rowsExported,omitempty"`
+	BytesWritten int64             `json:"bytesWritten,omitempty"`
+	Warnings     []string          `json:"warnings,omitempty"`
+	// LastProgressAt is when the job's progress last advanced.
+	LastProgressAt *time.Time `json:"lastProgressAt,omitempty"`
+	// RetryOf is the job this one re-runs.
+	RetryOf string `json:"retryOf,omitempty"`
+	// Request is the task the job was enqueued with, kept for retries and
+	// to show what the job was asked to do.
+	Request *JobRequest `json:"request,omitempty"`
+
+	// Set when the job completes.
+	DurationMs int64   `json:"durationMs,omitempty"`
+	RowsPerSec float64 `json:"rowsPerSec,omitempty"`
+	Throughput float64 `json:"throughputBytesPerSec,omitempty"`
+}
+
+// JobRequest is a queued task as enqueued: its type, payload and priority.
+// Task payloads name databases and dump files but never carry connection
+// URLs or credentials, so they are safe to return to clients.
+type JobRequest struct {
+	Type     string          `json:"type"`
+	Payload  json.RawMessage `json:"params"`
+	Priority string          `json:"priority,omitempty"`
+}
+
+// HasLabels reports whether every key/value in want is set on the job.
+func (j *Job) HasLabels(want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := j.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// SetProgress sets Progress, the percentage done rounded to one decimal, and
+// ProgressInt, the same truncated to a whole number as it was once reported.
+func (j *Job) SetProgress(pct float64) {
+	j.Progress = math.Round(pct*10) / 10
+	j.ProgressInt = int(j.Progress)
+}
+
+// Complete marks the job completed at t, or completed with warnings if it
+// has any, and derives its duration and throughput from StartedAt,
+// RowsExported and BytesWritten.
+func (j *Job) Complete(t time.Time) {
+	j.Status = StatusCompleted
+	if len(j.Warnings) > 0 {
+		j.Status = StatusCompletedWithWarnings
+	}
+	j.CompletedAt = &t
+	j.SetProgress(100)
+	j.Phase = ""
+	if j.StartedAt == nil {
+		return
+	}
+	d := t.Sub(*j.StartedAt)
+	j.DurationMs = d.Milliseconds()
+	if secs := d.Seconds(); secs > 0 {
+		j.RowsPerSec = float64(j.RowsExported) / secs
+		j.Throughput = float64(j.BytesWritten) / secs
+	}
+}
+
+// Cancel marks the job cancelled at t with reason as its error.
+func (j *Job) Cancel(t time.Time, reason string) {
+	j.Status = StatusCancelled
+	j.CompletedAt = &t
+	j.Error = reason
+	j.Phase = ""
+}
+
+// Summary counts jobs by status.
+type Summary struct {
+	Pending               int `json:"pending"`
+	Running               int `json:"running"`
+	Completed             int `json:"completed"`
+	CompletedWithWarnings int `json:"completedWithWarnings"`
+	Failed                int `json:"failed"`
+	Cancelled             int `json:"cancelled"`
 }
 
+func Summarize(jobs []Job) Summary {
+	var s Summary
+	for _, j := range jobs {
+		switch j.Status {
+		case StatusPending:
+			s.Pending++
+		case StatusRunning:
+			s.Running++
+		case StatusCompleted:
+			s.Completed++
+		case StatusCompletedWithWarnings:
+			s.CompletedWithWarnings++
+		case StatusFailed:
+			s.Failed++
+		case StatusCancelled:
+			s.Cancelled++
+		}
+	}
+	return s
+}
+
+// MaxJobLogLines bounds the per-job log buffer; older lines are dropped.
+const MaxJobLogLines = 500
+
+type LogLine struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// TransitionFunc is told about a job whose status changed, with a copy of
+// the job and its previous status ("" when it was just created).
+type TransitionFunc func(j Job, from JobStatus)
+
 type JobStore struct {
 	mu   sync.RWMutex
 	jobs map[string]*Job
+	logs map[string][]LogLine
+
+	onTransition []TransitionFunc
 }
 
 func NewJobStore() *JobStore {
-	return &JobStore{jobs: make(map[string]*Job)}
+	return &JobStore{
+		jobs: make(map[string]*Job),
+		logs: make(map[string][]LogLine),
+	}
 }
 
-func (s *JobStore) Create(job *Job) {
+func (s *JobStore) AppendLog(id, msg string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; !ok {
+		return
+	}
+	lines := append(s.logs[id], LogLine{Time: time.Now().UTC(), Message: msg})
+	if len(lines) > MaxJobLogLines {
+		lines = append(lines[:0], lines[len(lines)-MaxJobLogLines:]...)
+	}
+	s.logs[id] = lines
+}
+
+// AddWarning records a non-fatal issue on the job, which then completes as
+// completed_with_warnings.
+func (s *JobStore) AddWarning(id, msg string) {
+	s.Update(id, func(j *Job) {
+		j.Warnings = append(j.Warnings, msg)
+	})
+}
+
+func (s *JobStore) Logs(id string) ([]LogLine, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.jobs[id]; !ok {
+		return nil, false
+	}
+	out := make([]LogLine, len(s.logs[id]))
+	copy(out, s.logs[id])
+	return out, true
+}
+
+// OnTransition registers fn to be called after every status change,
+// outside the store's lock. Register before the store is shared.
+func (s *JobStore) OnTransition(fn TransitionFunc) {
+	s.onTransition = append(s.onTransition, fn)
+}
+
+// ErrJobExists is returned by Create for an ID already in the store.
+var ErrJobExists = errors.New("job already exists")
+
+// Create adds job to the store. It never replaces a job with the same ID.
+func (s *JobStore) Create(job *Job) error {
+	s.mu.Lock()
+	if _, ok := s.jobs[job.ID]; ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrJobExists, job.ID)
+	}
 	s.jobs[job.ID] = job
+	snapshot := job.clone()
+	s.mu.Unlock()
+	s.transitioned(snapshot, "")
+	return nil
 }
 
 func (s *JobStore) Update(id string, fn func(*Job)) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	if j, ok := s.jobs[id]; ok {
-		fn(j)
+	j, ok := s.jobs[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	from := j.Status
+	fn(j)
+	snapshot := j.clone()
+	s.mu.Unlock()
+	if snapshot.Status != from {
+		s.transitioned(snapshot, from)
+	}
+}
+
+func (s *JobStore) transitioned(j Job, from JobStatus) {
+	for _, fn := range s.onTransition {
+		fn(j, from)
 	}
 }
 
-func (s *JobStore) Get(id string) (*Job, bool) {
+// Snapshot returns a copy of the job taken under the store's lock. The
+// store's jobs are updated in place, so they are only handed out as copies.
+func (s *JobStore) Snapshot(id string) (Job, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	j, ok := s.jobs[id]
-	return j, ok
+	if !ok {
+		return Job{}, false
+	}
+	return j.clone(), true
 }
 
-func (s *JobStore) List() []*Job {
+// List returns copies of all jobs, taken under the store's lock.
+func (s *JobStore) List() []Job {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	out := make([]*Job, 0, len(s.jobs))
+	out := make([]Job, 0, len(s.jobs))
 	for _, j := range s.jobs {
-		out = append(out, j)
+		out = append(out, j.clone())
 	}
 	return out
 }
+
+// clone copies j along with the slice and map it shares otherwise.
+func (j *Job) clone() Job {
+	c := *j
+	if j.Warnings != nil {
+		c.Warnings = append([]string(nil), j.Warnings...)
+	}
+	if j.Labels != nil {
+		c.Labels = make(map[string]string, len(j.Labels))
+		for k, v := range j.Labels {
+			c.Labels[k] = v
+		}
+	}
+	return c
+}
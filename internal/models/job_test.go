@@ -0,0 +1,99 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestJobStoreCopiesAreRaceFree is meant for go test -race: it encodes the
+// jobs List and Snapshot return while they are being updated.
+func TestJobStoreCopiesAreRaceFree(t *testing.T) {
+	s := NewJobStore()
+	s.OnTransition(func(j Job, from JobStatus) {
+		json.Marshal(j)
+	})
+	for i := 0; i < 4; i++ {
+		if err := s.Create(&Job{ID: fmt.Sprint("j", i), Labels: map[string]string{"k": "v"}, Status: StatusPending}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s.AddWarning(id, "w")
+				s.Update(id, func(j *Job) {
+					now := time.Now()
+					j.Status = StatusRunning
+					j.SetProgress(float64(n % 100))
+					j.LastProgressAt = &now
+					j.Labels["n"] = fmt.Sprint(n)
+					if n%50 == 0 {
+						j.Warnings = j.Warnings[:0]
+						j.Status = StatusPending
+					}
+				})
+			}
+		}(fmt.Sprint("j", i))
+	}
+	for i := 0; i < 200; i++ {
+		jobs := s.List()
+		if len(jobs) != 4 {
+			t.Fatalf("List returned %d jobs, want 4", len(jobs))
+		}
+		if _, err := json.Marshal(jobs); err != nil {
+			t.Fatal(err)
+		}
+		j, ok := s.Snapshot("j0")
+		if !ok {
+			t.Fatal("Snapshot did not find j0")
+		}
+		if _, err := json.Marshal(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestJobStoreCreateNeverOverwrites(t *testing.T) {
+	s := NewJobStore()
+	var created []string
+	s.OnTransition(func(j Job, from JobStatus) {
+		if from == "" {
+			created = append(created, j.Database)
+		}
+	})
+	if err := s.Create(&Job{ID: "a", Database: "dev", Status: StatusRunning}); err != nil {
+		t.Fatal(err)
+	}
+	s.AppendLog("a", "started")
+
+	err := s.Create(&Job{ID: "a", Database: "staging", Status: StatusPending})
+	if !errors.Is(err, ErrJobExists) {
+		t.Fatalf("Create of a taken ID = %v, want ErrJobExists", err)
+	}
+	j, ok := s.Snapshot("a")
+	if !ok || j.Database != "dev" || j.Status != StatusRunning {
+		t.Errorf("job a after the duplicate Create = %+v, want the original", j)
+	}
+	if logs, _ := s.Logs("a"); len(logs) != 1 {
+		t.Errorf("job a has %d log lines after the duplicate Create, want 1", len(logs))
+	}
+	if len(created) != 1 {
+		t.Errorf("creation reported %d times, want once", len(created))
+	}
+}
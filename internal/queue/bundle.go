@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+)
+
+// bundleShare is the range of a bundle job's progress, in percent, that the
+// dump being imported covers.
+type bundleShare struct {
+	offset, span float64
+}
+
+// scale maps the progress of one dump onto the whole bundle.
+func (s bundleShare) scale(pct float64) float64 {
+	return math.Round((s.offset+pct*s.span/100)*10) / 10
+}
+
+// performImportBundle imports the dumps of p in order, each as performImport
+// would, dividing the job's progress between them by size. It stops at the
+// first dump that fails; those imported before it stay imported.
+func (w *Worker) performImportBundle(ctx context.Context, p ImportBundleTaskPayload) error {
+	var total int64
+	for _, f := range p.Files {
+		total += f.Size
+	}
+	defer w.bundleShares.Delete(p.JobID)
+	var done int64
+	for i, f := range p.Files {
+		s := bundleShare{offset: float64(i) * 100 / float64(len(p.Files)), span: 100 / float64(len(p.Files))}
+		if total > 0 {
+			s = bundleShare{offset: float64(done) * 100 / float64(total), span: float64(f.Size) * 100 / float64(total)}
+		}
+		w.bundleShares.Store(p.JobID, s)
+		w.logf(p.JobID, "Importing %s (%d of %d)", f.Path, i+1, len(p.Files))
+		ip := p.ImportTaskPayload
+		ip.DumpPath, ip.DumpSize = f.Path, f.Size
+		if err := w.performImport(ctx, ip); err != nil {
+			return fmt.Errorf("%s: %w", f.Path, err)
+		}
+		done += f.Size
+	}
+	return nil
+}
+
+func (w *Worker) handleImportBundle(ctx context.Context, t *asynq.Task) error {
+	var p ImportBundleTaskPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return err
+	}
+	release, err := w.acquireSlot(ctx, p.JobID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	now := time.Now()
+	w.jobs.Update(p.JobID, func(j *models.Job) {
+		j.Status = models.StatusRunning
+		j.StartedAt = &now
+		j.SetProgress(0)
+		j.Warnings = nil
+	})
+	w.logRetry(ctx, p.JobID)
+	w.logf(p.JobID, "Starting import of %d dumps into %s", len(p.Files), p.Target)
+
+	ctx, cancel := w.withJobTimeout(ctx, p.JobID)
+	defer cancel()
+	if err := w.performImportBundle(ctx, p); err != nil {
+		w.logf(p.JobID, "Import failed: %v", err)
+		return w.failJob(ctx, p.JobID, err)
+	}
+
+	w.jobs.Update(p.JobID, func(j *models.Job) {
+		j.Complete(time.Now())
+	})
+	w.logf(p.JobID, "Completed import of %d dumps", len(p.Files))
+	return nil
+}
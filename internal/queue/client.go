@@ -2,12 +2,16 @@ package queue
 
 import (
 	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/config"
 )
 
-func NewClient(redisURL string) (*asynq.Client, error) {
-	opt, err := asynq.ParseRedisURI(redisURL)
+func NewClient(cfg config.Config) (*asynq.Client, error) {
+	opt, err := RedisOptions(cfg)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkRedisTLS(opt); err != nil {
+		return nil, err
+	}
 	return asynq.NewClient(opt), nil
 }
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+	"github.com/koilabcode/multiboard-sync-service/internal/sqlscript"
+)
+
+// dumpTableDefs reads the CREATE TABLE statements at the head of a dump,
+// stopping at the first statement that loads data.
+func dumpTableDefs(dumpPath string, remap sqlscript.Remap) ([]sqlscript.TableDef, error) {
+	f, err := openDumpFile(dumpPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rc, _, err := export.OpenDump(f)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", dumpPath, err)
+	}
+	defer rc.Close()
+
+	var defs sqlscript.TableDefs
+	sc := sqlscript.NewScanner(rc)
+	for sc.Scan() {
+		stmt := remap.Rewrite(sc.Statement())
+		head := strings.ToUpper(strings.TrimSpace(stmt))
+		if strings.HasPrefix(head, "INSERT") || strings.HasPrefix(head, "COPY") {
+			break
+		}
+		defs.Add(stmt)
+	}
+	return defs.Tables, sc.Err()
+}
+
+type targetColumn struct {
+	Type string
+	// Required is set for NOT NULL columns the target fills in no other
+	// way, so rows without them cannot be inserted.
+	Required bool
+}
+
+func targetColumns(ctx context.Context, pool *pgxpool.Pool, schema, table string) (map[string]targetColumn, error) {
+	q := `
+select a.attname, format_type(a.atttypid, a.atttypmod),
+       a.attnotnull and not a.atthasdef and a.attidentity = '' and a.attgenerated = ''
+from pg_attribute a
+join pg_class c on c.oid = a.attrelid
+join pg_namespace n on n.oid = c.relnamespace
+where n.nspname = $1 and c.relname = $2 and c.relkind in ('r', 'p')
+  and a.attnum > 0 and not a.attisdropped`
+	rows, err := pool.Query(ctx, q, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]targetColumn)
+	for rows.Next() {
+		var name string
+		var c targetColumn
+		if err := rows.Scan(&name, &c.Type, &c.Required); err != nil {
+			return nil, err
+		}
+		out[name] = c
+	}
+	return out, rows.Err()
+}
+
+// sameType compares column types by their normalized spelling. Type
+// modifiers only count when both sides have one.
+func sameType(a, b string) bool {
+	ab, am := sqlscript.NormalizeType(a)
+	bb, bm := sqlscript.NormalizeType(b)
+	return ab == bb && (am == "" || bm == "" || am == bm)
+}
+
+// checkDrift compares the tables the dump creates with the ones already in
+// the target. Tables the dump drops first and tables the target lacks are
+// created from the dump, so only the rest can clash: a column the target
+// does not have, a column of another type, or a required target column the
+// dump never fills.
+func (w *Worker) checkDrift(ctx context.Context, pool *pgxpool.Pool, p ImportTaskPayload) error {
+	defs, err := dumpTableDefs(p.DumpPath, p.Remap)
+	if err != nil {
+		return fmt.Errorf("read dump schema: %w", err)
+	}
+	var diff []string
+	for _, t := range defs {
+		if t.Dropped {
+			continue
+		}
+		schema := t.Schema
+		if schema == "" {
+			schema = "public"
+		}
+		cols, err := targetColumns(ctx, pool, schema, t.Name)
+		if err != nil {
+			return fmt.Errorf("read target columns of %s.%s: %w", schema, t.Name, err)
+		}
+		if len(cols) == 0 {
+			continue
+		}
+		name := schema + "." + t.Name
+		inDump := make(map[string]bool, len(t.Columns))
+		for _, c := range t.Columns {
+			inDump[c.Name] = true
+			tc, ok := cols[c.Name]
+			switch {
+			case !ok:
+				diff = append(diff, fmt.Sprintf("%s: column %s (%s) missing in target", name, c.Name, c.Type))
+			case !sameType(c.Type, tc.Type):
+				diff = append(diff, fmt.Sprintf("%s: column %s is %s in dump, %s in target", name, c.Name, c.Type, tc.Type))
+			}
+		}
+		var missing []string
+		for col, tc := range cols {
+			if tc.Required && !inDump[col] {
+				missing = append(missing, fmt.Sprintf("%s: target column %s (%s) is NOT NULL without a default and missing in dump", name, col, tc.Type))
+			}
+		}
+		sort.Strings(missing)
+		diff = append(diff, missing...)
+	}
+	if len(diff) > 0 {
+		return fmt.Errorf("schema drift between dump and %s (set force to import anyway):\n  %s", p.Target, strings.Join(diff, "\n  "))
+	}
+	w.logf(p.JobID, "Checked %d dump tables against %s: no schema drift", len(defs), p.Target)
+	return nil
+}
@@ -0,0 +1,237 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koilabcode/multiboard-sync-service/internal/config"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+)
+
+type reporterFunc func(jobID string, p Progress)
+
+func (f reporterFunc) Report(jobID string, p Progress) { f(jobID, p) }
+
+// newExportWorker returns a Worker exporting localhost at url into dumps/
+// under an empty working directory.
+func newExportWorker(t *testing.T, url string) *Worker {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	mgr, err := database.NewManager(context.Background(), database.URLs{Localhost: url}, database.PingPolicy{Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mgr.Close)
+	tmpl, err := config.ParseFilenameTemplate(config.DefaultDumpFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Worker{
+		jobs:          models.NewJobStore(),
+		mgr:           mgr,
+		exporter:      export.New(mgr),
+		dumpFilename:  tmpl,
+		dumpTimestamp: config.DefaultDumpTimestampFormat,
+	}
+}
+
+// dumpsOnDisk lists the files under dumps/.
+func dumpsOnDisk(t *testing.T) []string {
+	t.Helper()
+	var out []string
+	err := filepath.WalkDir("dumps", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			out = append(out, path)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestFailedExportLeavesNoFiles(t *testing.T) {
+	w := newExportWorker(t, "postgres://test@127.0.0.1:1/db?connect_timeout=1")
+	noRename := false
+	for _, opts := range []export.ExportOptions{
+		{},
+		{Compress: true},
+		{PartSize: export.MinPartSize},
+		{AtomicRename: &noRename},
+	} {
+		if err := w.performExport(context.Background(), database.DBNameLocalhost, "job", opts); err == nil {
+			t.Fatalf("export of an unreachable database succeeded with %+v", opts)
+		}
+		if files := dumpsOnDisk(t); len(files) > 0 {
+			t.Errorf("failed export with %+v left %q", opts, files)
+		}
+	}
+}
+
+func TestExportAppearsOnlyWhenComplete(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	w := newExportWorker(t, url)
+	ctx := context.Background()
+	pool, err := w.mgr.Pool(ctx, database.DBNameLocalhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("queue_test_%d", time.Now().UnixNano())
+	for _, stmt := range []string{
+		"CREATE SCHEMA " + schema,
+		"CREATE TABLE " + schema + ".t (id int PRIMARY KEY, v text)",
+		"INSERT INTO " + schema + ".t SELECT i, repeat('x', 100) FROM generate_series(1, 20000) i",
+	} {
+		if _, err := pool.Exec(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { pool.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE") })
+
+	var mu sync.Mutex
+	var reports int
+	var early []string
+	w.reporters = []ProgressReporter{reporterFunc(func(string, Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports++
+		for _, f := range dumpsOnDisk(t) {
+			if !strings.HasPrefix(filepath.Base(f), ".") {
+				early = append(early, f)
+			}
+		}
+	})}
+	opts := export.ExportOptions{Schema: schema, Include: []string{"t"}, BatchSize: 100}
+	if err := w.performExport(ctx, database.DBNameLocalhost, "job", opts); err != nil {
+		t.Fatal(err)
+	}
+	if reports == 0 {
+		t.Fatal("no progress reported during the export")
+	}
+	if len(early) > 0 {
+		t.Errorf("dumps visible before the export completed: %q", early[0])
+	}
+	files := dumpsOnDisk(t)
+	if len(files) != 1 || !strings.HasSuffix(files[0], ".sql") || strings.HasPrefix(filepath.Base(files[0]), ".") {
+		t.Errorf("dumps after the export = %q, want one .sql file", files)
+	}
+}
+
+func TestReserveDumpNameKeepsSameSecondExportsApart(t *testing.T) {
+	w := newExportWorker(t, "postgres://test@127.0.0.1:1/db?connect_timeout=1")
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	name, err := w.dumpFilename.Render(config.FilenameData{
+		Database:  database.DBNameDev,
+		Timestamp: now.Format(w.dumpTimestamp),
+		Time:      now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join("dumps", strings.TrimSuffix(name, ".sql"))
+	if err := os.MkdirAll("dumps", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// A finished dump from that second already holds the plain name.
+	if err := os.WriteFile(base+".sql.gz", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	const exports = 8
+	names := make(chan string, exports)
+	releases := make(chan func(), exports)
+	var wg sync.WaitGroup
+	for i := 0; i < exports; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, release := w.reserveDumpName(base)
+			names <- n
+			releases <- release
+		}()
+	}
+	wg.Wait()
+	close(names)
+	close(releases)
+	seen := map[string]bool{}
+	for n := range names {
+		if n == base || seen[n] {
+			t.Errorf("reserveDumpName gave out %s twice", n)
+		}
+		seen[n] = true
+		ts, ok := config.ParseDumpTimestamp(strings.TrimPrefix(filepath.Base(n), database.DBNameDev+"_"), w.dumpTimestamp)
+		if !ok || !ts.Equal(now) {
+			t.Errorf("timestamp of %s = %v, %t, want %v", n, ts, ok, now)
+		}
+	}
+	for release := range releases {
+		release()
+	}
+	// Released names that were never written are free again.
+	if n, release := w.reserveDumpName(base); n != base+"-2" {
+		t.Errorf("reserveDumpName after the releases = %s, want %s-2", n, base)
+	} else {
+		release()
+	}
+}
+
+func TestPostExportHookWaitsForTheConnectionLimit(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	mgr, err := database.NewManager(ctx, database.URLs{
+		Localhost: url,
+		MaxConns:  map[string]int{database.DBNameLocalhost: 2},
+	}, database.PingPolicy{Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+	hook := filepath.Join(t.TempDir(), "post.sql")
+	if err := os.WriteFile(hook, []byte("SELECT 1;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w := &Worker{jobs: models.NewJobStore(), mgr: mgr, hooks: config.Hooks{PostExport: hook}}
+
+	// Another export holds every slot.
+	res, err := mgr.Reserve(ctx, database.DBNameLocalhost, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := w.runPostExportHook(wctx, database.DBNameLocalhost, "job"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("post-export hook with no free slot = %v, want context.DeadlineExceeded", err)
+	}
+	res.Release()
+	if err := w.runPostExportHook(ctx, database.DBNameLocalhost, "job"); err != nil {
+		t.Errorf("post-export hook once the slots are free = %v", err)
+	}
+}
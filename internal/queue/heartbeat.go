@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// HeartbeatInterval is how often the worker checks that its asynq server
+// is still alive.
+const HeartbeatInterval = 10 * time.Second
+
+// heartbeat records a beat every HeartbeatInterval while asynq reports this
+// process's server as active. asynq's own heartbeater refreshes that record
+// in Redis every few seconds and it expires when the server stops or
+// wedges, so a stale beat means no tasks are being picked up.
+func (w *Worker) heartbeat(inspector *asynq.Inspector) {
+	host, _ := os.Hostname()
+	pid := os.Getpid()
+	t := time.NewTicker(HeartbeatInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-t.C:
+		}
+		servers, err := inspector.Servers()
+		if err != nil {
+			log.Printf("worker heartbeat: %v", err)
+			continue
+		}
+		for _, s := range servers {
+			if s.Host == host && s.PID == pid && s.Status == "active" {
+				atomic.StoreInt64(&w.lastBeat, time.Now().UnixNano())
+				break
+			}
+		}
+	}
+}
+
+// LastHeartbeat returns when the worker was last seen alive; before the
+// first check it is the time the worker started.
+func (w *Worker) LastHeartbeat() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&w.lastBeat))
+}
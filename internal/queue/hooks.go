@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/sqlscript"
+)
+
+// runHook executes the SQL script at path statement by statement. An empty
+// path is a no-op.
+func (w *Worker) runHook(ctx context.Context, db execer, jobID, name, path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s hook: %w", name, err)
+	}
+	defer f.Close()
+	sc := sqlscript.NewScanner(f)
+	n := 0
+	for sc.Scan() {
+		if err := w.execStatement(ctx, db, sc.Statement()); err != nil {
+			return fmt.Errorf("%s hook %s statement %d: %w", name, path, n+1, err)
+		}
+		n++
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("%s hook %s: %w", name, path, err)
+	}
+	w.logf(jobID, "Ran %s hook %s (%d statements)", name, path, n)
+	return nil
+}
+
+// runImport applies the pre-import hook, the dump and the post-import hook
+// to pool over a single connection, so session settings made by the pre
+// hook (e.g. session_replication_role) apply to the dump. In transactional
+// mode all three also share one transaction, so a failure anywhere leaves
+// the target as it was. A parallel import, never transactional, loads the
+// table data over further connections that take on the session settings of
+// the first.
+func (w *Worker) runImport(ctx context.Context, pool *pgxpool.Pool, p ImportTaskPayload) error {
+	if !p.Transactional {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		// Discard the connection afterwards rather than returning session
+		// state set by the hooks to the pool.
+		defer func() { conn.Hijack().Close(context.Background()) }()
+		if err := database.TagSession(ctx, conn, false); err != nil {
+			return err
+		}
+		if err := w.runHook(ctx, conn, p.JobID, "pre-import", w.hooks.PreImport); err != nil {
+			return err
+		}
+		var loader *tableLoader
+		if p.Parallel {
+			loader = w.newTableLoader(ctx, pool, conn, w.importParallelism)
+			w.logf(p.JobID, "Loading table data over up to %d parallel connections", cap(loader.slots))
+		}
+		tables, err := w.importInto(ctx, conn, p.JobID, p.DumpPath, p.DumpSize, p.Remap, loader, p.indexRebuild())
+		if err != nil {
+			return err
+		}
+		if err := w.runHook(ctx, conn, p.JobID, "post-import", w.hooks.PostImport); err != nil {
+			return err
+		}
+		if p.SkipAnalyze {
+			return nil
+		}
+		return w.analyzeTables(ctx, conn, p.JobID, p.Remap.Schema, tables)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+	if err := database.TagSession(ctx, tx, true); err != nil {
+		return err
+	}
+	if err := w.runHook(ctx, tx, p.JobID, "pre-import", w.hooks.PreImport); err != nil {
+		return err
+	}
+	tables, err := w.importInto(ctx, tx, p.JobID, p.DumpPath, p.DumpSize, p.Remap, nil, p.indexRebuild())
+	if err != nil {
+		return err
+	}
+	if err := w.runHook(ctx, tx, p.JobID, "post-import", w.hooks.PostImport); err != nil {
+		return err
+	}
+	if !p.SkipAnalyze {
+		if err := w.analyzeTables(ctx, tx, p.JobID, p.Remap.Schema, tables); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	w.logf(p.JobID, "Committed import transaction")
+	return nil
+}
+
+// runPostExportHook runs the post-export hook against the source database
+// inside a read-only transaction: exports read from shared environments, and
+// a hook must never be able to modify them.
+func (w *Worker) runPostExportHook(ctx context.Context, db, jobID string) error {
+	if w.hooks.PostExport == "" {
+		return nil
+	}
+	conn, err := w.mgr.Acquire(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+	if err := database.TagSession(ctx, tx, true); err != nil {
+		return err
+	}
+	if err := w.runHook(ctx, tx, jobID, "post-export", w.hooks.PostExport); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
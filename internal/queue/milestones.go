@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	milestoneStatements = 1000
+	milestoneMinGap     = time.Second
+)
+
+var stmtTableRe = regexp.MustCompile(`(?i)^(?:INSERT INTO|COPY|CREATE TABLE(?: IF NOT EXISTS)?|ALTER TABLE(?: ONLY)?|TRUNCATE TABLE|DROP TABLE IF EXISTS|COMMENT ON TABLE|CREATE (?:UNIQUE )?INDEX(?: IF NOT EXISTS)? \S+ ON(?: ONLY)?)\s+(?:(?:"(?:[^"]|"")+"|[^\s(."]+)\.)?("(?:[^"]|"")+"|[^\s(.]+)`)
+
+// importMilestones emits structured audit log entries while an import runs:
+// every milestoneStatements statements and at each 10% of progress, but
+// never more than once per milestoneMinGap.
+type importMilestones struct {
+	jobID   string
+	start   time.Time
+	lastLog time.Time
+	lastPct int
+	table   string
+	byKind  map[string]time.Duration
+	tables  []string
+	seen    map[string]bool
+}
+
+func newImportMilestones(jobID string) *importMilestones {
+	return &importMilestones{
+		jobID:  jobID,
+		start:  time.Now(),
+		byKind: make(map[string]time.Duration),
+		seen:   make(map[string]bool),
+	}
+}
+
+func (m *importMilestones) observe(stmt string, executed, pct int, took time.Duration) {
+	kind, table := classifyStatement(stmt)
+	m.byKind[kind] += took
+	if table != "" {
+		m.table = table
+		if (kind == "INSERT" || kind == "COPY" || kind == "CREATE TABLE") && !m.seen[table] {
+			m.seen[table] = true
+			m.tables = append(m.tables, table)
+		}
+	}
+	if executed%milestoneStatements != 0 && pct/10 <= m.lastPct/10 {
+		return
+	}
+	if time.Since(m.lastLog) < milestoneMinGap {
+		return
+	}
+	m.lastLog = time.Now()
+	m.lastPct = pct
+	m.event(log.Info(), executed, pct).Msg("import milestone")
+}
+
+func (m *importMilestones) done(executed int) {
+	m.event(log.Info(), executed, 100).Msg("import statements finished")
+}
+
+func (m *importMilestones) event(e *zerolog.Event, executed, pct int) *zerolog.Event {
+	kinds := zerolog.Dict()
+	for k, d := range m.byKind {
+		kinds.Int64(k, d.Milliseconds())
+	}
+	return e.
+		Str("job_id", m.jobID).
+		Int("statements", executed).
+		Int("progress", pct).
+		Str("table", m.table).
+		Dur("elapsed", time.Since(m.start)).
+		Dict("ms_by_kind", kinds)
+}
+
+// classifyStatement returns a coarse statement kind ("INSERT", "CREATE
+// TABLE", ...) and the table it targets when that can be read off the text.
+func classifyStatement(stmt string) (string, string) {
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	kind := strings.ToUpper(fields[0])
+	if len(fields) > 1 {
+		switch kind {
+		case "CREATE", "ALTER", "DROP", "COMMENT":
+			kind += " " + strings.ToUpper(fields[1])
+			if kind == "CREATE UNIQUE" {
+				kind = "CREATE INDEX"
+			}
+		}
+	}
+	kind = strings.TrimSuffix(kind, ";")
+	var table string
+	if m := stmtTableRe.FindStringSubmatch(stmt); m != nil {
+		table = strings.ReplaceAll(strings.Trim(m[1], `"`), `""`, `"`)
+	}
+	return kind, table
+}
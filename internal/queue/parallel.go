@@ -0,0 +1,248 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/sqlscript"
+)
+
+// MaxImportParallelism bounds the connections a parallel import loads
+// tables over, on top of the one running the rest of the dump.
+const MaxImportParallelism = 8
+
+// tableLoader loads the data of an import's tables concurrently. As the dump
+// is read, each table's INSERT and COPY statements are spooled to a
+// temporary file; once the table's run of data ends, the file is loaded over
+// a connection of its own, at most n at a time. Every other statement first
+// waits for the loads in flight, so the DDL before the data and the
+// constraints, indexes and sequence updates after it still run in dump
+// order. Exports create foreign keys only after all data, so no table's load
+// depends on another's.
+type tableLoader struct {
+	w     *Worker
+	pool  *pgxpool.Pool
+	main  *pgxpool.Conn
+	ctx   context.Context
+	stop  context.CancelFunc
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	cur *tableSpool
+	// last holds, per table, the completion of its latest load, so a table
+	// whose data reappears later in the dump is loaded in order.
+	last map[string]chan struct{}
+	// settings are main's session settings, refreshed after each statement
+	// that may have changed them and applied to every load connection.
+	settings [][2]string
+	stale    bool
+
+	mu  sync.Mutex
+	err error
+}
+
+type tableSpool struct {
+	table    string
+	file     *os.File
+	bw       *bufio.Writer
+	settings [][2]string
+}
+
+func (w *Worker) newTableLoader(ctx context.Context, pool *pgxpool.Pool, main *pgxpool.Conn, n int) *tableLoader {
+	if n < 1 {
+		n = 1
+	}
+	if n > MaxImportParallelism {
+		n = MaxImportParallelism
+	}
+	ctx, stop := context.WithCancel(ctx)
+	return &tableLoader{
+		w:     w,
+		pool:  pool,
+		main:  main,
+		ctx:   ctx,
+		stop:  stop,
+		slots: make(chan struct{}, n),
+		last:  make(map[string]chan struct{}),
+		stale: true,
+	}
+}
+
+// dataTable returns the table an INSERT or COPY statement loads into, or ""
+// for any other statement.
+func dataTable(stmt string) string {
+	kind, table := classifyStatement(stmt)
+	if kind != "INSERT" && kind != "COPY" {
+		return ""
+	}
+	return table
+}
+
+// spool appends a data statement for table, with its COPY data if any, to
+// the table's spool file, handing the previous table's file off for loading
+// when the table changes.
+func (l *tableLoader) spool(table, stmt string, data io.Reader) error {
+	if err := l.failed(); err != nil {
+		return err
+	}
+	if l.cur != nil && l.cur.table != table {
+		l.flush()
+	}
+	if l.cur == nil {
+		if l.stale {
+			if err := l.readSettings(); err != nil {
+				return err
+			}
+			l.stale = false
+		}
+		f, err := os.CreateTemp("", "multiboard-import-*.sql")
+		if err != nil {
+			return err
+		}
+		l.cur = &tableSpool{table: table, file: f, bw: bufio.NewWriterSize(f, 1024*256), settings: l.settings}
+	}
+	bw := l.cur.bw
+	bw.WriteString(stmt)
+	bw.WriteByte('\n')
+	if data != nil {
+		if _, err := io.Copy(bw, data); err != nil {
+			return err
+		}
+		bw.WriteString("\\.\n")
+	}
+	return nil
+}
+
+// flush starts loading the table being spooled.
+func (l *tableLoader) flush() {
+	s := l.cur
+	if s == nil {
+		return
+	}
+	l.cur = nil
+	prev := l.last[s.table]
+	done := make(chan struct{})
+	l.last[s.table] = done
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		defer close(done)
+		defer os.Remove(s.file.Name())
+		defer s.file.Close()
+		if prev != nil {
+			<-prev
+		}
+		if err := l.load(s); err != nil {
+			l.fail(fmt.Errorf("load %s: %w", s.table, err))
+		}
+	}()
+}
+
+func (l *tableLoader) load(s *tableSpool) error {
+	if err := s.bw.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	select {
+	case l.slots <- struct{}{}:
+	case <-l.ctx.Done():
+		return l.ctx.Err()
+	}
+	defer func() { <-l.slots }()
+	if err := l.failed(); err != nil {
+		return err
+	}
+
+	conn, err := l.pool.Acquire(l.ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { conn.Hijack().Close(context.Background()) }()
+	if err := database.TagSession(l.ctx, conn, false); err != nil {
+		return err
+	}
+	for _, kv := range s.settings {
+		if _, err := conn.Exec(l.ctx, "select set_config($1, $2, false)", kv[0], kv[1]); err != nil {
+			return fmt.Errorf("set %s: %w", kv[0], err)
+		}
+	}
+	sc := sqlscript.NewScanner(s.file)
+	for sc.Scan() {
+		var err error
+		if data := sc.CopyData(); data != nil {
+			err = l.w.copyFrom(l.ctx, conn, sc.Statement(), data)
+		} else {
+			err = l.w.execStatement(l.ctx, conn, sc.Statement())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// readSettings copies the session settings made on main, by the pre-import
+// hook or SET statements in the dump, e.g. session_replication_role or
+// search_path.
+func (l *tableLoader) readSettings() error {
+	rows, err := l.main.Query(l.ctx, `
+		SELECT name, setting FROM pg_settings
+		WHERE source = 'session' AND context IN ('user', 'superuser') AND name <> 'application_name'`)
+	if err != nil {
+		return fmt.Errorf("read session settings: %w", err)
+	}
+	defer rows.Close()
+	var settings [][2]string
+	for rows.Next() {
+		var kv [2]string
+		if err := rows.Scan(&kv[0], &kv[1]); err != nil {
+			return err
+		}
+		settings = append(settings, kv)
+	}
+	l.settings = settings
+	return rows.Err()
+}
+
+// wait loads the table being spooled and waits for every load to finish,
+// before a statement that is not table data runs on main.
+func (l *tableLoader) wait() error {
+	l.flush()
+	l.wg.Wait()
+	l.stale = true
+	return l.failed()
+}
+
+// close abandons any table still being spooled and stops the loads.
+func (l *tableLoader) close() {
+	l.stop()
+	if l.cur != nil {
+		l.cur.file.Close()
+		os.Remove(l.cur.file.Name())
+		l.cur = nil
+	}
+	l.wg.Wait()
+}
+
+func (l *tableLoader) fail(err error) {
+	l.mu.Lock()
+	if l.err == nil {
+		l.err = err
+	}
+	l.mu.Unlock()
+	l.stop()
+}
+
+func (l *tableLoader) failed() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
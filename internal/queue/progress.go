@@ -0,0 +1,179 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// PhaseAnalyze is reported while statistics are refreshed after an import.
+const PhaseAnalyze = "analyze"
+
+// Progress is a point-in-time progress update for a job. Table and Rows are
+// only set by work that streams table data, Bytes by exports as the
+// uncompressed size of the dump so far; Phase names a step that follows the
+// main work.
+type Progress struct {
+	Percent float64 `json:"percent"`
+	Phase   string  `json:"phase,omitempty"`
+	Table   string  `json:"table,omitempty"`
+	Rows    int64   `json:"rows,omitempty"`
+	Bytes   int64   `json:"bytes,omitempty"`
+}
+
+// percentOf returns done/total as a percentage rounded to one decimal and
+// capped at limit.
+func percentOf(done, total int64, limit float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	pct := math.Round(float64(done)/float64(total)*1000) / 10
+	if pct > limit {
+		pct = limit
+	}
+	return pct
+}
+
+// ProgressReporter receives progress updates from the worker. Reporters are
+// called synchronously from job goroutines and must not block for long.
+type ProgressReporter interface {
+	Report(jobID string, p Progress)
+}
+
+// JobStoreReporter records progress on the in-memory job.
+type JobStoreReporter struct {
+	Jobs *models.JobStore
+}
+
+func (r JobStoreReporter) Report(jobID string, p Progress) {
+	r.Jobs.Update(jobID, func(j *models.Job) {
+		pct := math.Round(p.Percent*10) / 10
+		if pct != j.Progress || p.Phase != j.Phase || (p.Table != "" && (p.Table != j.CurrentTable || p.Rows != j.RowsExported)) {
+			now := time.Now()
+			j.LastProgressAt = &now
+		}
+		j.SetProgress(pct)
+		j.Phase = p.Phase
+		if p.Table != "" {
+			j.CurrentTable = p.Table
+			j.RowsExported = p.Rows
+		}
+		if p.Bytes > 0 {
+			j.BytesWritten = p.Bytes
+		}
+	})
+}
+
+// RedisPublisher publishes each update as JSON on a Redis pub/sub channel.
+// Updates are published from a goroutine of its own over a client whose
+// dial, read and write timeouts are publishTimeout, so a slow or unreachable
+// Redis never holds up the job; while it is behind, updates that do not fit
+// in the queue are dropped.
+type RedisPublisher struct {
+	client  redis.UniversalClient
+	channel string
+	queue   chan []byte
+	// ctx is cancelled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	// dropping is set from the first dropped update until a publish
+	// succeeds again, so the drops are logged once.
+	dropping int32
+}
+
+const (
+	publishTimeout    = 2 * time.Second
+	publishQueueDepth = 256
+)
+
+type progressMessage struct {
+	JobID string `json:"jobId"`
+	Progress
+}
+
+func NewRedisPublisher(opt asynq.RedisConnOpt, channel string) *RedisPublisher {
+	// go-redis ignores context deadlines unless told otherwise, so the
+	// timeouts are set on the client.
+	switch o := opt.(type) {
+	case asynq.RedisClientOpt:
+		o.DialTimeout, o.ReadTimeout, o.WriteTimeout = publishTimeout, publishTimeout, publishTimeout
+		opt = o
+	case asynq.RedisFailoverClientOpt:
+		o.DialTimeout, o.ReadTimeout, o.WriteTimeout = publishTimeout, publishTimeout, publishTimeout
+		opt = o
+	case asynq.RedisClusterClientOpt:
+		o.DialTimeout, o.ReadTimeout, o.WriteTimeout = publishTimeout, publishTimeout, publishTimeout
+		opt = o
+	}
+	r := &RedisPublisher{
+		client:  opt.MakeRedisClient().(redis.UniversalClient),
+		channel: channel,
+		queue:   make(chan []byte, publishQueueDepth),
+		done:    make(chan struct{}),
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	go r.run()
+	return r
+}
+
+func (r *RedisPublisher) Report(jobID string, p Progress) {
+	b, err := json.Marshal(progressMessage{JobID: jobID, Progress: p})
+	if err != nil {
+		return
+	}
+	select {
+	case r.queue <- b:
+	default:
+		if atomic.CompareAndSwapInt32(&r.dropping, 0, 1) {
+			log.Printf("progress publishing to Redis is behind; dropping updates")
+		}
+	}
+}
+
+func (r *RedisPublisher) run() {
+	defer close(r.done)
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case b := <-r.queue:
+			if r.ctx.Err() != nil {
+				return
+			}
+			if err := r.client.Publish(r.ctx, r.channel, b).Err(); err != nil {
+				if r.ctx.Err() != nil {
+					return
+				}
+				log.Printf("publish progress: %v", err)
+				continue
+			}
+			atomic.StoreInt32(&r.dropping, 0)
+		}
+	}
+}
+
+// Close stops publishing, dropping updates not yet published. Closing the
+// client first aborts an update being published.
+func (r *RedisPublisher) Close() error {
+	r.cancel()
+	err := r.client.Close()
+	<-r.done
+	return err
+}
+
+func (w *Worker) report(jobID string, p Progress) {
+	if s, ok := w.bundleShares.Load(jobID); ok {
+		p.Percent = s.(bundleShare).scale(p.Percent)
+	}
+	for _, r := range w.reporters {
+		r.Report(jobID, p)
+	}
+}
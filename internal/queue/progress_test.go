@@ -0,0 +1,45 @@
+package queue
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// hungRedis accepts connections and never answers.
+func hungRedis(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { c.Close() })
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestRedisPublisherDoesNotBlockOnHungRedis(t *testing.T) {
+	r := NewRedisPublisher(asynq.RedisClientOpt{Addr: hungRedis(t)}, "progress")
+	start := time.Now()
+	for i := 0; i < 10*publishQueueDepth; i++ {
+		r.Report("job", Progress{Percent: float64(i % 100)})
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("reporting took %v against a hung Redis", d)
+	}
+	start = time.Now()
+	r.Close()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close took %v", d)
+	}
+}
@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/config"
+)
+
+func NewInspector(cfg config.Config) (*asynq.Inspector, error) {
+	opt, err := RedisOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewInspector(opt), nil
+}
+
+// ValidTaskType reports whether typ names a task type this service enqueues.
+func ValidTaskType(typ string) bool {
+	switch typ {
+	case TypeExport, TypeImport, TypeImportBundle, TypeTableSync, TypeVerify:
+		return true
+	}
+	return false
+}
+
+// PurgePending deletes the pending tasks of type typ, or of every type when
+// typ is empty, from all priority queues. It returns the job IDs of the
+// deleted tasks. Tasks that start running while the purge is in progress
+// are left alone.
+func PurgePending(insp *asynq.Inspector, typ string) ([]string, error) {
+	var jobIDs []string
+	for _, q := range Priorities {
+		var pending []*asynq.TaskInfo
+		for page := 1; ; page++ {
+			tasks, err := insp.ListPendingTasks(q, asynq.PageSize(500), asynq.Page(page))
+			if errors.Is(err, asynq.ErrQueueNotFound) {
+				break
+			}
+			if err != nil {
+				return jobIDs, err
+			}
+			pending = append(pending, tasks...)
+			if len(tasks) < 500 {
+				break
+			}
+		}
+		for _, t := range pending {
+			if typ != "" && t.Type != typ {
+				continue
+			}
+			if err := insp.DeleteTask(q, t.ID); err != nil {
+				if errors.Is(err, asynq.ErrTaskNotFound) {
+					continue
+				}
+				return jobIDs, err
+			}
+			jobIDs = append(jobIDs, taskJobID(t))
+		}
+	}
+	return jobIDs, nil
+}
+
+// taskJobID returns the job a task reports progress to: the jobId in its
+// payload, or the task ID for scheduled exports, which have none.
+func taskJobID(t *asynq.TaskInfo) string {
+	var p struct {
+		JobID string `json:"jobId"`
+	}
+	if err := json.Unmarshal(t.Payload, &p); err == nil && p.JobID != "" {
+		return p.JobID
+	}
+	return t.ID
+}
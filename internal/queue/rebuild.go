@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// indexRebuild drops the secondary indexes and foreign keys of each table an
+// import loads rows into, just before its first rows, and recreates them
+// from the target's own definitions once all data is in, so an existing
+// schema is not indexed and checked row by row. Primary keys and unique
+// constraints stay, as upserts and foreign keys from other tables rely on
+// them.
+type indexRebuild struct {
+	schema  string
+	seen    map[string]bool
+	indexes []string
+	fkeys   []string
+}
+
+func newIndexRebuild(schema string) *indexRebuild {
+	return &indexRebuild{schema: schema, seen: make(map[string]bool)}
+}
+
+// queryExecer is satisfied by *pgxpool.Conn and pgx.Tx.
+type queryExecer interface {
+	execer
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// drop removes table's indexes and foreign keys the first time the table is
+// loaded into.
+func (b *indexRebuild) drop(ctx context.Context, w *Worker, db execer, table string) error {
+	if b.seen[table] {
+		return nil
+	}
+	b.seen[table] = true
+	q, ok := db.(queryExecer)
+	if !ok {
+		return fmt.Errorf("rebuildIndexes needs a dedicated connection")
+	}
+	ident := pgx.Identifier{table}
+	if b.schema != "" {
+		ident = pgx.Identifier{b.schema, table}
+	}
+	// Indexes used by any constraint, including foreign keys of other
+	// tables, and indexes attached to a partitioned parent's cannot be
+	// dropped on their own.
+	rows, err := q.Query(ctx, `
+		SELECT 'i', format('%I.%I', n.nspname, c.relname), pg_get_indexdef(i.indexrelid)
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE i.indrelid = to_regclass($1)
+		  AND NOT EXISTS (SELECT 1 FROM pg_constraint k WHERE k.conindid = i.indexrelid)
+		  AND NOT EXISTS (SELECT 1 FROM pg_inherits h WHERE h.inhrelid = i.indexrelid)
+		UNION ALL
+		SELECT 'f', quote_ident(k.conname), pg_get_constraintdef(k.oid)
+		FROM pg_constraint k
+		WHERE k.conrelid = to_regclass($1) AND k.contype = 'f'`, ident.Sanitize())
+	if err != nil {
+		return fmt.Errorf("read indexes of %s: %w", table, err)
+	}
+	var drops []string
+	for rows.Next() {
+		var kind, name, def string
+		if err := rows.Scan(&kind, &name, &def); err != nil {
+			rows.Close()
+			return err
+		}
+		if kind == "i" {
+			drops = append(drops, "DROP INDEX IF EXISTS "+name)
+			def = strings.Replace(def, " INDEX ", " INDEX IF NOT EXISTS ", 1)
+			b.indexes = append(b.indexes, strings.Replace(def, " ON ONLY ", " ON ", 1))
+			continue
+		}
+		drops = append(drops, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", ident.Sanitize(), name))
+		b.fkeys = append(b.fkeys, fmt.Sprintf("DO $$ BEGIN\n  ALTER TABLE %s ADD CONSTRAINT %s %s;\nEXCEPTION WHEN duplicate_object OR duplicate_table THEN NULL;\nEND $$", ident.Sanitize(), name, def))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, stmt := range drops {
+		if err := w.execStatement(ctx, db, stmt); err != nil {
+			return fmt.Errorf("drop index of %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// restore recreates what drop removed. Indexes and foreign keys the dump
+// itself created after the data are left as they are.
+func (b *indexRebuild) restore(ctx context.Context, w *Worker, db execer, jobID string) error {
+	for _, stmt := range append(b.indexes, b.fkeys...) {
+		if err := w.execStatement(ctx, db, stmt); err != nil {
+			return fmt.Errorf("rebuild indexes: %w; stmt: %s", err, stmt)
+		}
+	}
+	if len(b.indexes)+len(b.fkeys) > 0 {
+		w.logf(jobID, "Rebuilt %d indexes and %d foreign keys dropped for the load", len(b.indexes), len(b.fkeys))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package queue
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/config"
+)
+
+// RedisOptions builds the asynq connection options from REDIS_URL, honoring
+// the ACL username that asynq's parser drops, and applies the explicit
+// REDIS_TLS, REDIS_PASSWORD and REDIS_DB overrides.
+func RedisOptions(cfg config.Config) (asynq.RedisConnOpt, error) {
+	parsed, err := asynq.ParseRedisURI(cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+	opt, ok := parsed.(asynq.RedisClientOpt)
+	if !ok {
+		if cfg.RedisTLS || cfg.RedisPassword != "" || cfg.RedisDB >= 0 {
+			return nil, fmt.Errorf("REDIS_TLS, REDIS_PASSWORD and REDIS_DB are only supported with redis:// or rediss:// URLs")
+		}
+		return parsed, nil
+	}
+	if u, err := url.Parse(cfg.RedisURL); err == nil && u.User != nil {
+		opt.Username = u.User.Username()
+	}
+	if cfg.RedisPassword != "" {
+		opt.Password = cfg.RedisPassword
+	}
+	if cfg.RedisDB >= 0 {
+		opt.DB = cfg.RedisDB
+	}
+	if cfg.RedisTLS && opt.TLSConfig == nil {
+		host, _, err := net.SplitHostPort(opt.Addr)
+		if err != nil {
+			host = opt.Addr
+		}
+		opt.TLSConfig = &tls.Config{ServerName: host}
+	}
+	return opt, nil
+}
+
+func checkRedisTLS(opt asynq.RedisConnOpt) error {
+	co, ok := opt.(asynq.RedisClientOpt)
+	if !ok || co.TLSConfig == nil {
+		return nil
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", co.Addr, co.TLSConfig)
+	if err != nil {
+		return fmt.Errorf("redis TLS handshake with %s failed: %w", co.Addr, err)
+	}
+	return conn.Close()
+}
@@ -0,0 +1,162 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/config"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+)
+
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+type Schedule struct {
+	ID       string `json:"id"`
+	Database string `json:"database"`
+	Cronspec string `json:"cronspec"`
+	Enabled  bool   `json:"enabled"`
+
+	entryID string
+}
+
+type Scheduler struct {
+	mu         sync.Mutex
+	sched      *asynq.Scheduler
+	schedules  []*Schedule
+	jobTimeout time.Duration
+	started    bool
+}
+
+// ParseSchedules parses EXPORT_SCHEDULES, a semicolon separated list of
+// database=cronspec pairs such as "staging=0 3 * * *;dev=@daily".
+func ParseSchedules(spec string) ([]*Schedule, error) {
+	var out []*Schedule
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		eq := strings.Index(part, "=")
+		if eq <= 0 || eq == len(part)-1 {
+			return nil, fmt.Errorf("invalid schedule %q; expected database=cronspec", part)
+		}
+		db := strings.ToLower(strings.TrimSpace(part[:eq]))
+		switch db {
+		case database.DBNameProduction, database.DBNameStaging, database.DBNameDev, database.DBNameLocalhost:
+		default:
+			return nil, fmt.Errorf("invalid schedule %q; unknown database %q", part, db)
+		}
+		if seen[db] {
+			return nil, fmt.Errorf("duplicate schedule for database %q", db)
+		}
+		seen[db] = true
+		out = append(out, &Schedule{
+			ID:       db,
+			Database: db,
+			Cronspec: strings.TrimSpace(part[eq+1:]),
+			Enabled:  true,
+		})
+	}
+	return out, nil
+}
+
+func NewScheduler(cfg config.Config) (*Scheduler, error) {
+	schedules, err := ParseSchedules(cfg.ExportSchedules)
+	if err != nil {
+		return nil, err
+	}
+	opt, err := RedisOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scheduler{
+		sched:      asynq.NewScheduler(opt, nil),
+		schedules:  schedules,
+		jobTimeout: cfg.JobTimeout,
+	}
+	for _, sc := range schedules {
+		if err := s.register(sc); err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", sc.ID, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *Scheduler) register(sc *Schedule) error {
+	typ, payload, err := NewScheduledExportTask(sc.Database, export.ExportOptions{})
+	if err != nil {
+		return err
+	}
+	id, err := s.sched.Register(sc.Cronspec, asynq.NewTask(typ, payload), TaskOptions(s.jobTimeout, PriorityLow)...)
+	if err != nil {
+		return err
+	}
+	sc.entryID = id
+	return nil
+}
+
+func (s *Scheduler) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.schedules) == 0 {
+		return nil
+	}
+	if err := s.sched.Start(); err != nil {
+		return err
+	}
+	s.started = true
+	return nil
+}
+
+func (s *Scheduler) Shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		s.sched.Shutdown()
+		s.started = false
+	}
+}
+
+func (s *Scheduler) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		out = append(out, *sc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (s *Scheduler) SetEnabled(id string, enabled bool) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sc := range s.schedules {
+		if sc.ID != id {
+			continue
+		}
+		if sc.Enabled == enabled {
+			return *sc, nil
+		}
+		if enabled {
+			if err := s.register(sc); err != nil {
+				return *sc, err
+			}
+		} else {
+			if err := s.sched.Unregister(sc.entryID); err != nil {
+				return *sc, err
+			}
+			sc.entryID = ""
+		}
+		sc.Enabled = enabled
+		return *sc, nil
+	}
+	return Schedule{}, ErrScheduleNotFound
+}
@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+)
+
+// performSwapImport loads the dump into a freshly created database next to
+// the target, verifies it, then renames the live database aside and the new
+// one into its place. The previous database is kept as <name>_old_<ts> for
+// manual rollback. Only the localhost target is ever swapped.
+func (w *Worker) performSwapImport(ctx context.Context, p ImportTaskPayload) error {
+	target, jobID := p.Target, p.JobID
+	if !w.allowSwapImport {
+		return fmt.Errorf("swap imports are disabled")
+	}
+	if target != database.DBNameLocalhost {
+		return fmt.Errorf("swap imports are only allowed into %s, not %s", database.DBNameLocalhost, target)
+	}
+	live, err := w.mgr.DatabaseName(target)
+	if err != nil {
+		return err
+	}
+	if live == "" || live == "postgres" || live == "template0" || live == "template1" {
+		return fmt.Errorf("refusing to swap database %q", live)
+	}
+	ts := time.Now().UTC().Format("20060102150405")
+	staging := fmt.Sprintf("%s_staging_%s", live, ts)
+	old := fmt.Sprintf("%s_old_%s", live, ts)
+
+	admin, err := w.mgr.MaintenanceConn(ctx, target)
+	if err != nil {
+		return fmt.Errorf("connect to maintenance database: %w", err)
+	}
+	defer admin.Close(context.Background())
+
+	if _, err := admin.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{staging}.Sanitize()); err != nil {
+		return fmt.Errorf("create staging database: %w", err)
+	}
+	w.logf(jobID, "Created staging database %s", staging)
+	dropStaging := true
+	defer func() {
+		if dropStaging {
+			if _, err := admin.Exec(context.Background(), "DROP DATABASE IF EXISTS "+pgx.Identifier{staging}.Sanitize()); err != nil {
+				w.logf(jobID, "Failed to drop staging database %s: %v", staging, err)
+			}
+		}
+	}()
+
+	pool, err := w.mgr.OpenSiblingPool(ctx, target, staging)
+	if err != nil {
+		return err
+	}
+	err = w.runImport(ctx, pool, p)
+	if err == nil {
+		var tables int
+		err = pool.QueryRow(ctx, "select count(*) from information_schema.tables where table_schema = 'public'").Scan(&tables)
+		if err == nil && tables == 0 {
+			err = fmt.Errorf("verification failed: staging database has no tables")
+		}
+	}
+	pool.Close()
+	if err != nil {
+		return err
+	}
+
+	// Our own cached pool holds connections to the live database; drop it
+	// and any other sessions so the rename can proceed.
+	w.mgr.ResetPool(target)
+	if _, err := admin.Exec(ctx, "select pg_terminate_backend(pid) from pg_stat_activity where datname = $1 and pid <> pg_backend_pid()", live); err != nil {
+		return fmt.Errorf("terminate sessions on %s: %w", live, err)
+	}
+	if _, err := admin.Exec(ctx, fmt.Sprintf("ALTER DATABASE %s RENAME TO %s", pgx.Identifier{live}.Sanitize(), pgx.Identifier{old}.Sanitize())); err != nil {
+		return fmt.Errorf("rename %s aside: %w", live, err)
+	}
+	if _, err := admin.Exec(ctx, fmt.Sprintf("ALTER DATABASE %s RENAME TO %s", pgx.Identifier{staging}.Sanitize(), pgx.Identifier{live}.Sanitize())); err != nil {
+		if _, rerr := admin.Exec(context.Background(), fmt.Sprintf("ALTER DATABASE %s RENAME TO %s", pgx.Identifier{old}.Sanitize(), pgx.Identifier{live}.Sanitize())); rerr != nil {
+			w.logf(jobID, "Failed to restore %s from %s: %v", live, old, rerr)
+		}
+		return fmt.Errorf("rename staging into place: %w", err)
+	}
+	dropStaging = false
+	w.logf(jobID, "Swapped %s into place; previous database kept as %s", live, old)
+	return nil
+}
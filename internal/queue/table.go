@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+	"github.com/koilabcode/multiboard-sync-service/internal/sqlscript"
+)
+
+// performTableSync copies one table's rows from source to target. The data
+// script is staged in a temp file and applied in a single transaction, so
+// the target table is either fully refreshed or left untouched.
+func (w *Worker) performTableSync(ctx context.Context, p TableSyncTaskPayload) error {
+	f, err := os.CreateTemp("", "table-sync-*.sql")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	opts := export.ExportOptions{Masking: w.masking}
+	rows, err := w.exporter.ExportTableData(ctx, p.Source, p.Table, f, opts, func(rowsExported int64) {
+		w.report(p.JobID, Progress{Table: p.Table, Rows: rowsExported})
+	})
+	if err != nil {
+		return fmt.Errorf("export %s from %s: %w", p.Table, p.Source, err)
+	}
+	w.logf(p.JobID, "Exported %d rows from %s", rows, p.Table)
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	w.jobs.Update(p.JobID, func(j *models.Job) {
+		j.RowsExported = rows
+		j.BytesWritten = st.Size()
+	})
+
+	conn, err := w.targetConn(ctx, p.JobID, p.Target)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+	if err := database.TagSession(ctx, tx, true); err != nil {
+		return err
+	}
+	refs, err := export.ReferencingTables(ctx, tx, export.DefaultSchema, p.Table)
+	if err != nil {
+		return err
+	}
+	if len(refs) > 0 {
+		return fmt.Errorf("%s cannot be truncated on %s: %s have foreign keys to it; import a full dump instead", p.Table, p.Target, strings.Join(refs, ", "))
+	}
+	tables, err := w.importInto(ctx, tx, p.JobID, f.Name(), st.Size(), sqlscript.Remap{}, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := w.analyzeTables(ctx, tx, p.JobID, "", tables); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (w *Worker) handleTableSync(ctx context.Context, t *asynq.Task) error {
+	var p TableSyncTaskPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return err
+	}
+	release, err := w.acquireSlot(ctx, p.JobID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	now := time.Now()
+	w.jobs.Update(p.JobID, func(j *models.Job) {
+		j.Status = models.StatusRunning
+		j.StartedAt = &now
+		j.SetProgress(0)
+		j.Warnings = nil
+		j.CurrentTable = p.Table
+	})
+	w.logRetry(ctx, p.JobID)
+	w.logf(p.JobID, "Starting table sync of %s from %s into %s", p.Table, p.Source, p.Target)
+
+	ctx, cancel := w.withJobTimeout(ctx, p.JobID)
+	defer cancel()
+	if err := w.performTableSync(ctx, p); err != nil {
+		w.logf(p.JobID, "Table sync failed: %v", err)
+		return w.failJob(ctx, p.JobID, err)
+	}
+
+	w.jobs.Update(p.JobID, func(j *models.Job) {
+		j.Complete(time.Now())
+	})
+	w.logf(p.JobID, "Completed table sync")
+	return nil
+}
@@ -1,46 +1,214 @@
 package queue
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
 
+	"github.com/hibiken/asynq"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+	"github.com/koilabcode/multiboard-sync-service/internal/sqlscript"
+)
+
+const (
+	TypeExport       = "export:run"
+	TypeImport       = "import:run"
+	TypeImportBundle = "import:bundle"
+	TypeTableSync    = "sync:table"
+	TypeVerify       = "sync:verify"
+)
+
+// Priorities map one-to-one onto asynq queues; the worker polls them with
+// the weights in queueWeights so interactive work runs ahead of batch work.
 const (
-	TypeExport = "export:run"
-	TypeImport = "import:run"
+	PriorityHigh    = "high"
+	PriorityDefault = "default"
+	PriorityLow     = "low"
 )
 
+// Priorities are the queues tasks are enqueued to. Each needs a weight in
+// queueWeights, which checkQueues verifies when the worker starts, or its
+// tasks would never run.
+var Priorities = []string{PriorityHigh, PriorityDefault, PriorityLow}
+
+var queueWeights = map[string]int{
+	PriorityHigh:    6,
+	PriorityDefault: 3,
+	PriorityLow:     1,
+}
+
+func ValidPriority(p string) bool {
+	if p == "" {
+		return true
+	}
+	for _, q := range Priorities {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// checkQueues reports a queue tasks can be enqueued to that weights does
+// not serve.
+func checkQueues(weights map[string]int) error {
+	for _, q := range Priorities {
+		if weights[q] <= 0 {
+			return fmt.Errorf("queue %q can be enqueued to but is not served by the worker", q)
+		}
+	}
+	return nil
+}
+
+// TaskOptions returns the enqueue options for a sync task. The asynq deadline
+// is set slightly past the job timeout so the worker's own timeout fires first
+// and the job is marked with a timeout code.
+func TaskOptions(jobTimeout time.Duration, priority string) []asynq.Option {
+	if priority == "" {
+		priority = PriorityDefault
+	}
+	opts := []asynq.Option{asynq.Queue(priority)}
+	if jobTimeout > 0 {
+		opts = append(opts, asynq.Timeout(jobTimeout+time.Minute))
+	}
+	return opts
+}
+
 type ExportTaskPayload struct {
-	Database string `json:"database"`
-	JobID    string `json:"jobId"`
+	Database string               `json:"database"`
+	JobID    string               `json:"jobId"`
+	Trigger  string               `json:"trigger,omitempty"`
+	Options  export.ExportOptions `json:"options"`
+	Labels   map[string]string    `json:"labels,omitempty"`
 }
 
-func NewExportTask(db, jobID string) (string, []byte, error) {
-	payload, err := json.Marshal(ExportTaskPayload{
+func NewExportTask(db, jobID string, opts export.ExportOptions, labels map[string]string) (string, []byte, error) {
+	return newExportTask(ExportTaskPayload{
 		Database: db,
 		JobID:    jobID,
+		Trigger:  models.TriggerAPI,
+		Options:  opts,
+		Labels:   labels,
+	})
+}
+
+// NewScheduledExportTask builds the payload registered with the scheduler.
+// It carries no job ID; the worker creates the job from the asynq task ID
+// each time the schedule fires.
+func NewScheduledExportTask(db string, opts export.ExportOptions) (string, []byte, error) {
+	return newExportTask(ExportTaskPayload{
+		Database: db,
+		Trigger:  models.TriggerSchedule,
+		Options:  opts,
 	})
+}
+
+func newExportTask(p ExportTaskPayload) (string, []byte, error) {
+	payload, err := json.Marshal(p)
 	if err != nil {
 		return "", nil, err
 	}
 	return TypeExport, payload, nil
 }
 
+const (
+	ImportStrategyDirect = "direct"
+	ImportStrategySwap   = "swap"
+)
+
 type ImportTaskPayload struct {
 	Source   string `json:"source"`
 	Target   string `json:"target"`
 	DumpPath string `json:"dumpPath"`
 	JobID    string `json:"jobId"`
 	DumpSize int64  `json:"dumpSize"`
+	Strategy string `json:"strategy,omitempty"`
+	// Transactional runs the hooks and the whole dump in one transaction.
+	Transactional bool `json:"transactional,omitempty"`
+	// SkipAnalyze skips the ANALYZE of imported tables after the load.
+	SkipAnalyze bool              `json:"skipAnalyze,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// Remap loads the dump's tables into another schema or under a name
+	// prefix instead of over the originals.
+	Remap sqlscript.Remap `json:"remap,omitempty"`
+	// Force skips the schema drift check against the target.
+	Force bool `json:"force,omitempty"`
+	// Parallel loads independent tables' data concurrently; it is ignored
+	// for transactional imports.
+	Parallel bool `json:"parallel,omitempty"`
+	// RebuildIndexes drops the secondary indexes and foreign keys of the
+	// existing tables loaded into for the load, and rebuilds them after.
+	RebuildIndexes bool `json:"rebuildIndexes,omitempty"`
 }
 
-func NewImportTask(source, target, dumpPath, jobID string, dumpSize int64) (string, []byte, error) {
-	payload, err := json.Marshal(ImportTaskPayload{
-		Source:   source,
-		Target:   target,
-		DumpPath: dumpPath,
-		JobID:    jobID,
-		DumpSize: dumpSize,
-	})
+func (p ImportTaskPayload) indexRebuild() *indexRebuild {
+	if !p.RebuildIndexes {
+		return nil
+	}
+	return newIndexRebuild(p.Remap.Schema)
+}
+
+func NewImportTask(p ImportTaskPayload) (string, []byte, error) {
+	payload, err := json.Marshal(p)
 	if err != nil {
 		return "", nil, err
 	}
 	return TypeImport, payload, nil
 }
+
+// BundleFile is one dump of an import bundle.
+type BundleFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// ImportBundleTaskPayload imports several dumps into the target one after
+// another under a single job, each with the options of the embedded payload,
+// whose DumpPath and DumpSize are ignored.
+type ImportBundleTaskPayload struct {
+	ImportTaskPayload
+	Files []BundleFile `json:"files"`
+}
+
+func NewImportBundleTask(p ImportBundleTaskPayload) (string, []byte, error) {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return "", nil, err
+	}
+	return TypeImportBundle, payload, nil
+}
+
+type TableSyncTaskPayload struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Table  string `json:"table"`
+	JobID  string `json:"jobId"`
+}
+
+func NewTableSyncTask(source, target, table, jobID string) (string, []byte, error) {
+	payload, err := json.Marshal(TableSyncTaskPayload{
+		Source: source,
+		Target: target,
+		Table:  table,
+		JobID:  jobID,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return TypeTableSync, payload, nil
+}
+
+type VerifyTaskPayload struct {
+	Source  string               `json:"source"`
+	JobID   string               `json:"jobId"`
+	Options export.ExportOptions `json:"options"`
+}
+
+func NewVerifyTask(source, jobID string, opts export.ExportOptions) (string, []byte, error) {
+	payload, err := json.Marshal(VerifyTaskPayload{Source: source, JobID: jobID, Options: opts})
+	if err != nil {
+		return "", nil, err
+	}
+	return TypeVerify, payload, nil
+}
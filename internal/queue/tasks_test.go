@@ -0,0 +1,58 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+func TestCheckQueues(t *testing.T) {
+	if err := checkQueues(queueWeights); err != nil {
+		t.Fatalf("the worker's own weights: %v", err)
+	}
+	tests := []struct {
+		name    string
+		weights map[string]int
+	}{
+		{"missing", map[string]int{PriorityHigh: 6, PriorityDefault: 3}},
+		{"zero weight", map[string]int{PriorityHigh: 6, PriorityDefault: 0, PriorityLow: 1}},
+		{"renamed", map[string]int{PriorityHigh: 6, "normal": 3, PriorityLow: 1}},
+	}
+	for _, tt := range tests {
+		if err := checkQueues(tt.weights); err == nil {
+			t.Errorf("%s: checkQueues(%v) = nil, want an error", tt.name, tt.weights)
+		}
+	}
+}
+
+// TestTaskOptionsQueueIsServed checks that every priority a handler can
+// enqueue with lands on a queue the worker polls.
+func TestTaskOptionsQueueIsServed(t *testing.T) {
+	for _, p := range append([]string{""}, Priorities...) {
+		if !ValidPriority(p) {
+			t.Errorf("ValidPriority(%q) = false", p)
+		}
+		var queue string
+		var timeout time.Duration
+		for _, o := range TaskOptions(time.Hour, p) {
+			switch o.Type() {
+			case asynq.QueueOpt:
+				queue = o.Value().(string)
+			case asynq.TimeoutOpt:
+				timeout = o.Value().(time.Duration)
+			}
+		}
+		if queueWeights[queue] <= 0 {
+			t.Errorf("priority %q enqueues to %q, which the worker does not serve", p, queue)
+		}
+		if timeout <= time.Hour {
+			t.Errorf("priority %q: asynq timeout %v does not leave the job timeout to fire first", p, timeout)
+		}
+	}
+	for _, p := range []string{"urgent", "HIGH", "medium"} {
+		if ValidPriority(p) {
+			t.Errorf("ValidPriority(%q) = true", p)
+		}
+	}
+}
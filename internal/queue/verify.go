@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/koilabcode/multiboard-sync-service/internal/database"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+)
+
+// performVerify round-trips an export of source through a throwaway
+// database on the localhost server and compares per-table row counts with
+// the export manifest. The scratch database is always dropped.
+func (w *Worker) performVerify(ctx context.Context, p VerifyTaskPayload) error {
+	f, err := os.CreateTemp("", "verify-*.sql")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	opts := p.Options
+	if opts.Parallelism == 0 {
+		opts.Parallelism = w.exportParallelism
+	}
+	opts.Masking = w.masking
+	manifest, err := w.exporter.Export(ctx, p.Source, f, opts, func(ep export.Progress) {
+		w.report(p.JobID, Progress{Percent: percentOf(int64(ep.TableIndex), int64(ep.TotalTables), 100) / 2, Table: ep.TableName, Rows: ep.RowsExported})
+	})
+	if err != nil {
+		return fmt.Errorf("export %s: %w", p.Source, err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	w.logf(p.JobID, "Exported %d tables (%d rows, %d bytes)", len(manifest.Tables), manifest.TotalRows(), st.Size())
+
+	scratch := fmt.Sprintf("verify_%s_%s", p.Source, time.Now().UTC().Format("20060102150405"))
+	admin, err := w.mgr.MaintenanceConn(ctx, database.DBNameLocalhost)
+	if err != nil {
+		return fmt.Errorf("connect to maintenance database: %w", err)
+	}
+	defer admin.Close(context.Background())
+	if _, err := admin.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{scratch}.Sanitize()); err != nil {
+		return fmt.Errorf("create scratch database: %w", err)
+	}
+	w.logf(p.JobID, "Created scratch database %s", scratch)
+	defer func() {
+		if _, err := admin.Exec(context.Background(), "DROP DATABASE IF EXISTS "+pgx.Identifier{scratch}.Sanitize()); err != nil {
+			w.logf(p.JobID, "Failed to drop scratch database %s: %v", scratch, err)
+			return
+		}
+		w.logf(p.JobID, "Dropped scratch database %s", scratch)
+	}()
+
+	pool, err := w.mgr.OpenSiblingPool(ctx, database.DBNameLocalhost, scratch)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	err = w.runImport(ctx, pool, ImportTaskPayload{
+		JobID:       p.JobID,
+		DumpPath:    f.Name(),
+		DumpSize:    st.Size(),
+		SkipAnalyze: true,
+	})
+	if err != nil {
+		return fmt.Errorf("reimport: %w", err)
+	}
+
+	var mismatches []string
+	for _, t := range manifest.Tables {
+		var n int64
+		if err := pool.QueryRow(ctx, "select count(*) from "+pgx.Identifier{t.Name}.Sanitize()).Scan(&n); err != nil {
+			return fmt.Errorf("count %s: %w", t.Name, err)
+		}
+		if n != t.Rows {
+			mismatches = append(mismatches, fmt.Sprintf("%s: exported %d, imported %d", t.Name, t.Rows, n))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("row counts differ: %s", strings.Join(mismatches, "; "))
+	}
+	w.logf(p.JobID, "Verified %d tables: row counts match", len(manifest.Tables))
+	return nil
+}
+
+func (w *Worker) handleVerify(ctx context.Context, t *asynq.Task) error {
+	var p VerifyTaskPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return err
+	}
+	release, err := w.acquireSlot(ctx, p.JobID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	now := time.Now()
+	w.jobs.Update(p.JobID, func(j *models.Job) {
+		j.Status = models.StatusRunning
+		j.StartedAt = &now
+		j.SetProgress(0)
+		j.Warnings = nil
+	})
+	w.logRetry(ctx, p.JobID)
+	w.logf(p.JobID, "Starting verification of %s", p.Source)
+
+	ctx, cancel := w.withJobTimeout(ctx, p.JobID)
+	defer cancel()
+	if err := w.performVerify(ctx, p); err != nil {
+		w.logf(p.JobID, "Verification failed: %v", err)
+		return w.failJob(ctx, p.JobID, err)
+	}
+
+	w.jobs.Update(p.JobID, func(j *models.Job) {
+		j.Complete(time.Now())
+	})
+	w.logf(p.JobID, "Completed verification")
+	return nil
+}
@@ -1,234 +1,850 @@
 package queue
 
 import (
-	"bufio"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/koilabcode/multiboard-sync-service/internal/config"
 	"github.com/koilabcode/multiboard-sync-service/internal/database"
 	"github.com/koilabcode/multiboard-sync-service/internal/export"
 	"github.com/koilabcode/multiboard-sync-service/internal/models"
+	"github.com/koilabcode/multiboard-sync-service/internal/sqlscript"
 )
 
+// WorkerConcurrency is how many tasks a worker runs at once.
+const WorkerConcurrency = 5
+
 type Worker struct {
 	server   *asynq.Server
 	mux      *asynq.ServeMux
 	jobs     *models.JobStore
 	mgr      *database.Manager
 	exporter *export.Exporter
+
+	jobTimeout        time.Duration
+	stallTimeout      time.Duration
+	statementTimeout  time.Duration
+	exportParallelism int
+	importParallelism int
+	masking           export.MaskingRules
+	allowSwapImport   bool
+	autoCreateTarget  bool
+	reporters         []ProgressReporter
+	hooks             config.Hooks
+	dumpFilename      *config.FilenameTemplate
+	dumpTimestamp     string
+	// dumpNames holds the dump names of exports in progress.
+	dumpNames sync.Map
+	// stalled holds the jobs the stall watchdog cancelled, with how long
+	// their progress had been frozen.
+	stalled sync.Map
+	// bundleShares holds, per running bundle import, the share of the job's
+	// progress taken by the dump being imported.
+	bundleShares sync.Map
+	// slots caps jobs running at once across all task types; nil means
+	// no cap beyond WorkerConcurrency.
+	slots chan struct{}
+	// slotWait is how long a task waits for a slot before it is requeued.
+	slotWait time.Duration
+
+	inspector *asynq.Inspector
+	// lastBeat is the UnixNano time of the last heartbeat.
+	lastBeat int64
+	done     chan struct{}
 }
 
-func NewWorker(redisURL string, jobs *models.JobStore, mgr *database.Manager) (*Worker, error) {
-	opt, err := asynq.ParseRedisURI(redisURL)
+func NewWorker(cfg config.Config, jobs *models.JobStore, mgr *database.Manager) (*Worker, error) {
+	if err := checkQueues(queueWeights); err != nil {
+		return nil, err
+	}
+	opt, err := RedisOptions(cfg)
 	if err != nil {
 		return nil, err
 	}
 	srv := asynq.NewServer(opt, asynq.Config{
-		Concurrency: 5,
-		Queues: map[string]int{
-			"default": 1,
-		},
+		Concurrency:    WorkerConcurrency,
+		Queues:         queueWeights,
+		RetryDelayFunc: retryDelay,
+		IsFailure:      func(err error) bool { return !errors.Is(err, errSlotBusy) },
 	})
+	var masking export.MaskingRules
+	if cfg.MaskingConfigFile != "" {
+		masking, err = export.LoadMaskingRules(cfg.MaskingConfigFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dumpFilename := cfg.DumpFilename
+	if dumpFilename == nil {
+		if dumpFilename, err = config.ParseFilenameTemplate(config.DefaultDumpFilename); err != nil {
+			return nil, err
+		}
+	}
+	dumpTimestamp := cfg.DumpTimestampFormat
+	if dumpTimestamp == "" {
+		dumpTimestamp = config.DefaultDumpTimestampFormat
+	}
 	mux := asynq.NewServeMux()
-	w := &Worker{server: srv, mux: mux, jobs: jobs, mgr: mgr}
+	w := &Worker{
+		server:            srv,
+		mux:               mux,
+		inspector:         asynq.NewInspector(opt),
+		done:              make(chan struct{}),
+		jobs:              jobs,
+		mgr:               mgr,
+		jobTimeout:        cfg.JobTimeout,
+		stallTimeout:      cfg.StallTimeout,
+		statementTimeout:  cfg.StatementTimeout,
+		exportParallelism: cfg.ExportParallelism,
+		importParallelism: cfg.ImportParallelism,
+		masking:           masking,
+		allowSwapImport:   cfg.AllowSwapImport,
+		autoCreateTarget:  cfg.AutoCreateTarget,
+		reporters:         []ProgressReporter{JobStoreReporter{Jobs: jobs}},
+		hooks:             cfg.Hooks,
+		dumpFilename:      dumpFilename,
+		dumpTimestamp:     dumpTimestamp,
+	}
+	if cfg.MaxInflightJobs > 0 {
+		w.slots = make(chan struct{}, cfg.MaxInflightJobs)
+		w.slotWait = defaultSlotWait
+	}
+	if cfg.ProgressChannel != "" {
+		w.reporters = append(w.reporters, NewRedisPublisher(opt, cfg.ProgressChannel))
+	}
 	w.exporter = export.New(mgr)
+	w.exporter.SetDenyTables(cfg.ExportDenyTables)
 	mux.HandleFunc(TypeExport, w.handleExport)
 	mux.HandleFunc(TypeImport, w.handleImport)
+	mux.HandleFunc(TypeImportBundle, w.handleImportBundle)
+	mux.HandleFunc(TypeTableSync, w.handleTableSync)
+	mux.HandleFunc(TypeVerify, w.handleVerify)
 	return w, nil
 }
 
-func (w *Worker) performExport(ctx context.Context, db string, jobID string) error {
-	if err := os.MkdirAll("dumps", 0o755); err != nil {
-		return err
-	}
-	filename := fmt.Sprintf("dumps/%s_%s.sql", db, time.Now().Format("20060102_150405"))
-	f, err := os.Create(filename)
+func (w *Worker) performExport(ctx context.Context, db string, jobID string, opts export.ExportOptions) error {
+	now := time.Now()
+	name, err := w.dumpFilename.Render(config.FilenameData{
+		Database:  db,
+		Timestamp: now.UTC().Format(w.dumpTimestamp),
+		JobID:     jobID,
+		Time:      now,
+	})
 	if err != nil {
+		return fmt.Errorf("dump filename: %w", err)
+	}
+	base, release := w.reserveDumpName(filepath.Join("dumps", strings.TrimSuffix(name, ".sql")))
+	defer release()
+	if err := os.MkdirAll(filepath.Dir(base), 0o755); err != nil {
 		return err
 	}
-	defer f.Close()
+	var (
+		out      io.Writer
+		parts    *export.PartWriter
+		gz       *gzip.Writer
+		file     *os.File
+		filename string
+		ok       bool
+	)
+	if opts.PartSize > 0 {
+		pw := export.NewPartWriter(base, db, opts.PartSize)
+		pw.Fsync, pw.AtomicIndex = opts.Fsync, opts.RenamesAtomically()
+		out, parts, filename = pw, pw, pw.IndexPath()
+		defer func() {
+			if !ok {
+				pw.Remove()
+			}
+		}()
+	} else {
+		filename = base + ".sql"
+		if opts.Compress {
+			filename += ".gz"
+		}
+		path := filename
+		if opts.RenamesAtomically() {
+			path = export.TempPath(filename)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out, file = f, f
+		if opts.Compress {
+			if gz, err = gzip.NewWriterLevel(f, opts.CompressionLevel.GzipLevel()); err != nil {
+				return err
+			}
+			out = gz
+		}
+		defer func() {
+			if !ok {
+				os.Remove(path)
+			}
+		}()
+	}
 
-	progFn := func(current, total int, table string, rows int64) {
-		pct := int((float64(current) / float64(total)) * 100.0)
-		if pct > 100 {
-			pct = 100
+	lastTable := ""
+	progFn := func(p export.Progress) {
+		if p.TableName != lastTable {
+			w.logf(jobID, "Exporting table %s (%d/%d)", p.TableName, p.TableIndex, p.TotalTables)
+			lastTable = p.TableName
 		}
-		w.jobs.Update(jobID, func(j *models.Job) {
-			j.Progress = pct
-			j.CurrentTable = table
-			j.RowsExported = rows
-		})
+		pct := percentOf(int64(p.TableIndex), int64(p.TotalTables), 100)
+		w.report(jobID, Progress{Percent: pct, Table: p.TableName, Rows: p.RowsExported, Bytes: p.BytesWritten})
 	}
 
-	_, _ = f.WriteString(fmt.Sprintf("-- Export started at %s\n\n", time.Now().UTC().Format(time.RFC3339)))
-	if err := w.exporter.Export(ctx, db, f, progFn); err != nil {
+	counter := &countingWriter{w: out}
+	out = counter
+	_, _ = fmt.Fprintf(out, "-- Export started at %s\n\n", time.Now().UTC().Format(time.RFC3339))
+	if opts.Parallelism == 0 {
+		opts.Parallelism = w.exportParallelism
+	}
+	opts.Masking = w.masking
+	if opts.SampleRows > 0 {
+		w.logf(jobID, "Export is sampled (%d rows per table); foreign key integrity is not guaranteed", opts.SampleRows)
+	}
+	manifest, err := w.exporter.Export(ctx, db, out, opts, progFn)
+	if err != nil {
 		return fmt.Errorf("exporter.Export db=%s: %w", db, err)
 	}
+	for _, t := range manifest.Tables {
+		w.logf(jobID, "Exported %d rows from %s", t.Rows, t.Name)
+	}
+	if manifest.MaxUpdatedAt != nil {
+		w.logf(jobID, "Incremental export; pass since=%s for the next run", manifest.MaxUpdatedAt.UTC().Format(time.RFC3339Nano))
+	}
+	for _, t := range manifest.Skipped {
+		w.warnf(jobID, "Skipped data for %s: %s", t.Name, t.Error)
+	}
+	if err := w.runPostExportHook(ctx, db, jobID); err != nil {
+		return err
+	}
+	written := counter.n
+	if parts != nil {
+		if err := parts.Close(); err != nil {
+			return fmt.Errorf("write %s: %w", filename, err)
+		}
+		w.logf(jobID, "Wrote %s (%d parts, %d bytes)", filename, parts.Count(), written)
+	} else if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("write %s: %w", filename, err)
+		}
+		st, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		w.logf(jobID, "Wrote %s (%d bytes, %d uncompressed, level %d)", filename, st.Size(), written, opts.CompressionLevel.GzipLevel())
+		written = st.Size()
+	} else {
+		w.logf(jobID, "Wrote %s (%d bytes)", filename, written)
+	}
+	if file != nil {
+		if err := commitFile(file, filename, opts.Fsync); err != nil {
+			return fmt.Errorf("write %s: %w", filename, err)
+		}
+	}
+	ok = true
 	w.jobs.Update(jobID, func(j *models.Job) {
-		j.Progress = 100
+		j.SetProgress(100)
+		j.RowsExported = manifest.TotalRows()
+		j.BytesWritten = written
 	})
 	return nil
 }
 
+// reserveDumpName returns base, or base with a -2, -3, ... suffix when an
+// export in progress or an existing dump already has that name, as happens
+// for two exports started in the same second. The returned func releases
+// the name once the dump is written.
+func (w *Worker) reserveDumpName(base string) (string, func()) {
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		if _, taken := w.dumpNames.LoadOrStore(name, struct{}{}); taken {
+			continue
+		}
+		if dumpExists(name) {
+			w.dumpNames.Delete(name)
+			continue
+		}
+		return name, func() { w.dumpNames.Delete(name) }
+	}
+}
+
+func dumpExists(base string) bool {
+	for _, suffix := range []string{".sql", ".sql.gz", export.IndexSuffix} {
+		if _, err := os.Stat(base + suffix); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// commitFile closes f, syncing it first when fsync is set, and renames it to
+// name if it was written under a temporary name.
+func commitFile(f *os.File, name string, fsync bool) error {
+	var err error
+	if fsync {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if f.Name() != name {
+		if err := os.Rename(f.Name(), name); err != nil {
+			return err
+		}
+	}
+	if fsync {
+		return export.SyncDir(filepath.Dir(name))
+	}
+	return nil
+}
+
+// errSlotBusy is returned by acquireSlot when no job slot frees up within
+// the worker's slot wait. It is not counted as a failure: asynq requeues the
+// task after slotRetryDelay with a fresh deadline.
+var errSlotBusy = errors.New("no free job slot")
+
+const (
+	// defaultSlotWait bounds how long a task holds its asynq deadline, which
+	// runs from dequeue and allows a minute past the job timeout, waiting for
+	// a slot before it is requeued.
+	defaultSlotWait = 30 * time.Second
+	slotRetryDelay  = 15 * time.Second
+)
+
+// retryDelay requeues tasks that found no free slot after slotRetryDelay
+// and backs off as asynq does by default otherwise.
+func retryDelay(n int, err error, t *asynq.Task) time.Duration {
+	if errors.Is(err, errSlotBusy) {
+		return slotRetryDelay
+	}
+	return asynq.DefaultRetryDelayFunc(n, err, t)
+}
+
+// acquireSlot waits until fewer than MAX_INFLIGHT_JOBS jobs are running.
+// The job stays pending while it waits; after the slot wait it gives up with
+// errSlotBusy so the task is requeued rather than killed by its asynq
+// deadline mid-run.
+func (w *Worker) acquireSlot(ctx context.Context, jobID string) (func(), error) {
+	if w.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case w.slots <- struct{}{}:
+	default:
+		w.logf(jobID, "Waiting for a free job slot (%d in flight)", cap(w.slots))
+		t := time.NewTimer(w.slotWait)
+		defer t.Stop()
+		select {
+		case w.slots <- struct{}{}:
+		case <-t.C:
+			w.logf(jobID, "No job slot freed up within %s, requeueing", w.slotWait)
+			return nil, errSlotBusy
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() { <-w.slots }, nil
+}
+
+func (w *Worker) logf(jobID, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("[job %s] %s", jobID, msg)
+	w.jobs.AppendLog(jobID, msg)
+}
+
+// warnf logs a non-fatal issue and records it among the job's warnings.
+func (w *Worker) warnf(jobID, format string, args ...any) {
+	w.logf(jobID, format, args...)
+	w.jobs.AddWarning(jobID, fmt.Sprintf(format, args...))
+}
+
+func (w *Worker) logRetry(ctx context.Context, jobID string) {
+	if n, ok := asynq.GetRetryCount(ctx); ok && n > 0 {
+		w.logf(jobID, "Retry attempt %d", n)
+	}
+}
+
+func (w *Worker) withJobTimeout(ctx context.Context, jobID string) (context.Context, context.CancelFunc) {
+	ctx = database.WithJobID(ctx, jobID)
+	var cancel context.CancelFunc
+	if w.jobTimeout <= 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, w.jobTimeout)
+	}
+	if w.stallTimeout <= 0 {
+		return ctx, cancel
+	}
+	go w.watchStall(ctx, cancel, jobID)
+	return ctx, func() {
+		cancel()
+		w.stalled.Delete(jobID)
+	}
+}
+
+// watchStall cancels a running job whose progress has not advanced for the
+// stall timeout, counted from its start if it has reported none yet. This
+// catches jobs stuck on a hung statement long before the job timeout.
+func (w *Worker) watchStall(ctx context.Context, cancel context.CancelFunc, jobID string) {
+	interval := w.stallTimeout / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		j, ok := w.jobs.Snapshot(jobID)
+		if !ok || j.Status != models.StatusRunning || j.StartedAt == nil {
+			continue
+		}
+		last := *j.StartedAt
+		if j.LastProgressAt != nil && j.LastProgressAt.After(last) {
+			last = *j.LastProgressAt
+		}
+		if idle := time.Since(last); idle >= w.stallTimeout {
+			w.stalled.Store(jobID, idle)
+			w.logf(jobID, "No progress for %s, cancelling", idle.Round(time.Second))
+			cancel()
+			return
+		}
+	}
+}
+
+func (w *Worker) failJob(ctx context.Context, jobID string, err error) error {
+	code := ""
+	if idle, ok := w.stalled.Load(jobID); ok {
+		code = models.ErrCodeStalled
+		err = fmt.Errorf("job made no progress for %s: %w", idle.(time.Duration).Round(time.Second), err)
+	} else if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		code = models.ErrCodeTimeout
+		err = fmt.Errorf("job exceeded timeout of %s: %w", w.jobTimeout, err)
+	} else if errors.Is(err, export.ErrNoTables) {
+		code = models.ErrCodeNoTables
+	}
+	w.jobs.Update(jobID, func(j *models.Job) {
+		j.Status = models.StatusFailed
+		j.Error = err.Error()
+		j.ErrorCode = code
+	})
+	if code == models.ErrCodeTimeout || code == models.ErrCodeNoTables {
+		return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	}
+	return err
+}
+
 func (w *Worker) handleExport(ctx context.Context, t *asynq.Task) error {
 	var p ExportTaskPayload
 	if err := json.Unmarshal(t.Payload(), &p); err != nil {
 		return err
 	}
+	if p.JobID == "" {
+		id, ok := asynq.GetTaskID(ctx)
+		if !ok {
+			return fmt.Errorf("export task without job id: %w", asynq.SkipRetry)
+		}
+		p.JobID = id
+		// A retry finds the job created by the first attempt.
+		err := w.jobs.Create(&models.Job{
+			ID:       id,
+			Database: p.Database,
+			Trigger:  p.Trigger,
+			Labels:   p.Labels,
+			Status:   models.StatusPending,
+			Request:  &models.JobRequest{Type: TypeExport, Payload: t.Payload()},
+		})
+		if err != nil && !errors.Is(err, models.ErrJobExists) {
+			return err
+		}
+	}
+	release, err := w.acquireSlot(ctx, p.JobID)
+	if err != nil {
+		return err
+	}
+	defer release()
 	now := time.Now()
 	w.jobs.Update(p.JobID, func(j *models.Job) {
 		j.Status = models.StatusRunning
 		j.StartedAt = &now
-		j.Progress = 0
+		j.SetProgress(0)
+		j.Warnings = nil
 	})
-	log.Printf("Starting export for database %s (job %s)", p.Database, p.JobID)
+	w.logRetry(ctx, p.JobID)
+	w.logf(p.JobID, "Starting export for database %s", p.Database)
 
-	if err := w.performExport(ctx, p.Database, p.JobID); err != nil {
-		w.jobs.Update(p.JobID, func(j *models.Job) {
-			j.Status = models.StatusFailed
-			j.Error = err.Error()
-		})
-		log.Printf("Export failed for job %s: %v", p.JobID, err)
-		return err
+	ctx, cancel := w.withJobTimeout(ctx, p.JobID)
+	defer cancel()
+	if err := w.performExport(ctx, p.Database, p.JobID, p.Options); err != nil {
+		w.logf(p.JobID, "Export failed: %v", err)
+		return w.failJob(ctx, p.JobID, err)
 	}
 
-	done := time.Now()
 	w.jobs.Update(p.JobID, func(j *models.Job) {
-		j.Status = models.StatusCompleted
-		j.CompletedAt = &done
-		j.Progress = 100
+		j.Complete(time.Now())
 	})
-	log.Printf("Completed export for job %s", p.JobID)
+	w.logf(p.JobID, "Completed export")
 	return nil
 }
 
-func (w *Worker) performImport(ctx context.Context, target, jobID, dumpPath string, dumpSize int64) error {
-	pool, err := w.mgr.Pool(ctx, target)
+// targetPool leases the pool for an import target, first creating the
+// target database when auto-creation is enabled and the target is one that
+// may be created.
+func (w *Worker) targetPool(ctx context.Context, jobID, target string) (*pgxpool.Pool, func(), error) {
+	if err := w.ensureTarget(ctx, jobID, target); err != nil {
+		return nil, nil, err
+	}
+	return w.mgr.Lease(ctx, target)
+}
+
+// targetConn is targetPool for work done on a single connection, which is
+// taken under the target's connection limit.
+func (w *Worker) targetConn(ctx context.Context, jobID, target string) (*database.Conn, error) {
+	if err := w.ensureTarget(ctx, jobID, target); err != nil {
+		return nil, err
+	}
+	return w.mgr.Acquire(ctx, target)
+}
+
+func (w *Worker) ensureTarget(ctx context.Context, jobID, target string) error {
+	if !w.autoCreateTarget || (target != database.DBNameLocalhost && target != database.DBNameDev) {
+		return nil
+	}
+	created, err := w.mgr.EnsureDatabase(ctx, target)
 	if err != nil {
 		return err
 	}
-	f, err := os.Open(dumpPath)
+	if created {
+		w.logf(jobID, "Created missing %s database", target)
+	}
+	return nil
+}
+
+func (w *Worker) performImport(ctx context.Context, p ImportTaskPayload) error {
+	pool, release, err := w.targetPool(ctx, p.JobID, p.Target)
 	if err != nil {
 		return err
 	}
+	defer release()
+	if !p.Force {
+		if err := w.checkDrift(ctx, pool, p); err != nil {
+			return err
+		}
+	}
+	return w.runImport(ctx, pool, p)
+}
+
+// execer is satisfied by both *pgxpool.Pool and pgx.Tx, so scripts can run
+// either statement-by-statement on the pool or inside one transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// importInto executes the dump at dumpPath, with relation names rewritten by
+// remap, and returns the tables it created or loaded rows into, in order of
+// first appearance. With a loader, table data is handed to it to load
+// concurrently instead of being executed on db; with rebuild, the indexes of
+// the tables loaded into are dropped for the load and rebuilt after it.
+func (w *Worker) importInto(ctx context.Context, db execer, jobID, dumpPath string, dumpSize int64, remap sqlscript.Remap, loader *tableLoader, rebuild *indexRebuild) ([]string, error) {
+	if remap.Schema != "" {
+		if err := w.execStatement(ctx, db, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{remap.Schema}.Sanitize()); err != nil {
+			return nil, fmt.Errorf("create schema %s: %w", remap.Schema, err)
+		}
+	}
+	f, err := openDumpFile(dumpPath)
+	if err != nil {
+		return nil, err
+	}
 	defer f.Close()
 
-	reader := bufio.NewReaderSize(f, 1024*256)
+	// Progress is measured on the file as stored, so it stays meaningful
+	// for gzipped dumps.
+	counter := &countingReader{r: f}
+	rc, _, err := export.OpenDump(counter)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", dumpPath, err)
+	}
+	defer rc.Close()
+
+	if loader != nil {
+		defer loader.close()
+	}
+	sc := sqlscript.NewScanner(rc)
+	milestones := newImportMilestones(jobID)
 	var (
-		stmtBuf     strings.Builder
-		totalRead   int64
 		lastUpdated time.Time
+		executed    int
 	)
 
-	updateProgress := func() {
-		if dumpSize <= 0 {
-			return
-		}
-		pct := int((float64(totalRead) / float64(dumpSize)) * 100.0)
-		if pct > 100 {
-			pct = 100
-		}
-		w.jobs.Update(jobID, func(j *models.Job) {
-			j.Progress = pct
-		})
+	// The counter runs ahead of execution by whatever the gzip and scanner
+	// buffers hold, so it can reach the file size before the last
+	// statements have run; 100% is only reported once they have.
+	percent := func() float64 {
+		return percentOf(counter.n, dumpSize, 99)
 	}
 
-	for {
-		chunk, err := reader.ReadString('\n')
-		if len(chunk) > 0 {
-			totalRead += int64(len(chunk))
-			lineTrim := strings.TrimSpace(chunk)
-			if strings.HasPrefix(lineTrim, "--") {
-				if time.Since(lastUpdated) > 500*time.Millisecond {
-					updateProgress()
-					lastUpdated = time.Now()
-				}
-				continue
+	for sc.Scan() {
+		// Stop between statements once the job is cancelled or times out;
+		// a transactional import is rolled back by the caller.
+		select {
+		case <-ctx.Done():
+			w.logf(jobID, "Import stopped after %d statements: %v", executed, ctx.Err())
+			return nil, ctx.Err()
+		default:
+		}
+		stmt := remap.Rewrite(sc.Statement())
+		_, inTx := db.(pgx.Tx)
+		if (inTx || loader != nil) && isTransactionControl(stmt) {
+			// A transaction-wrapped dump already runs inside ours; its
+			// COMMIT would end ours early. Loaded in parallel, its data
+			// could not see tables created in an open transaction.
+			continue
+		}
+		if inTx && concurrentIndexRe.MatchString(stmt) {
+			return nil, fmt.Errorf("the dump creates indexes concurrently, which cannot run in a transaction; import it non-transactionally")
+		}
+		started := time.Now()
+		var errExec error
+		table := dataTable(stmt)
+		if rebuild != nil && table != "" {
+			if err := rebuild.drop(ctx, w, db, table); err != nil {
+				return nil, err
 			}
-			stmtBuf.WriteString(chunk)
-			if strings.HasSuffix(strings.TrimSpace(chunk), ";") {
-				stmt := strings.TrimSpace(stmtBuf.String())
-				stmtBuf.Reset()
-				if stmt != "" {
-					if _, errExec := pool.Exec(ctx, stmt); errExec != nil {
-						max := 500
-						if len(stmt) < max {
-							max = len(stmt)
-						}
-						return fmt.Errorf("exec failed: %w; stmt: %s", errExec, strings.TrimSpace(stmt[:max]))
-					}
+		}
+		if loader != nil && table != "" {
+			errExec = loader.spool(table, stmt, sc.CopyData())
+		} else {
+			if loader != nil {
+				if err := loader.wait(); err != nil {
+					return nil, err
 				}
 			}
-			if time.Since(lastUpdated) > 500*time.Millisecond {
-				updateProgress()
-				lastUpdated = time.Now()
+			if data := sc.CopyData(); data != nil {
+				errExec = w.copyFrom(ctx, db, stmt, data)
+			} else {
+				errExec = w.execStatement(ctx, db, stmt)
 			}
 		}
-		if err != nil {
-			if err == io.EOF {
-				break
+		if errExec != nil {
+			max := 500
+			if len(stmt) < max {
+				max = len(stmt)
 			}
-			return err
+			w.logf(jobID, "Statement %d failed after %d bytes read", executed+1, sc.BytesRead())
+			return nil, fmt.Errorf("exec failed: %w; stmt: %s", errExec, strings.TrimSpace(stmt[:max]))
 		}
+		executed++
+		milestones.observe(stmt, executed, int(percent()), time.Since(started))
+		if dumpSize > 0 && time.Since(lastUpdated) > 500*time.Millisecond {
+			w.report(jobID, Progress{Percent: percent()})
+			lastUpdated = time.Now()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", dumpPath, err)
 	}
-	if s := strings.TrimSpace(stmtBuf.String()); s != "" {
-		if _, err := pool.Exec(ctx, s); err != nil {
-			return fmt.Errorf("exec failed: %w", err)
+	if loader != nil {
+		if err := loader.wait(); err != nil {
+			return nil, err
 		}
 	}
-	w.jobs.Update(jobID, func(j *models.Job) {
-		j.Progress = 100
-	})
+	if rebuild != nil {
+		if err := rebuild.restore(ctx, w, db, jobID); err != nil {
+			return nil, err
+		}
+	}
+	milestones.done(executed)
+	w.logf(jobID, "Executed %d statements", executed)
+	w.report(jobID, Progress{Percent: 100})
+	return milestones.tables, nil
+}
+
+var concurrentIndexRe = regexp.MustCompile(`(?i)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+CONCURRENTLY\b`)
+
+// isTransactionControl reports whether stmt begins or ends a transaction.
+func isTransactionControl(stmt string) bool {
+	fields := strings.Fields(strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(stmt), ";")))
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "BEGIN", "COMMIT", "END":
+		return true
+	case "START":
+		return len(fields) > 1 && fields[1] == "TRANSACTION"
+	}
+	return false
+}
+
+// analyzeTables refreshes planner statistics for freshly loaded tables,
+// which live in schema when it is set.
+func (w *Worker) analyzeTables(ctx context.Context, db execer, jobID, schema string, tables []string) error {
+	// pg_dump scripts clear search_path for the session; table names are
+	// recorded unqualified, so restore the default before resolving them.
+	if err := w.execStatement(ctx, db, "RESET search_path"); err != nil {
+		return err
+	}
+	for _, t := range tables {
+		w.report(jobID, Progress{Percent: 100, Phase: PhaseAnalyze, Table: t})
+		ident := pgx.Identifier{t}
+		if schema != "" {
+			ident = pgx.Identifier{schema, t}
+		}
+		if err := w.execStatement(ctx, db, "ANALYZE "+ident.Sanitize()); err != nil {
+			return fmt.Errorf("analyze %s: %w", t, err)
+		}
+	}
+	w.logf(jobID, "Analyzed %d tables", len(tables))
 	return nil
 }
 
+// copyFrom streams inline COPY ... FROM stdin data, as found in plain
+// pg_dump output, over the connection behind db.
+func (w *Worker) copyFrom(ctx context.Context, db execer, stmt string, data io.Reader) error {
+	var conn *pgx.Conn
+	switch c := db.(type) {
+	case *pgxpool.Conn:
+		conn = c.Conn()
+	case pgx.Tx:
+		conn = c.Conn()
+	case *pgx.Conn:
+		conn = c
+	default:
+		return fmt.Errorf("COPY FROM stdin needs a dedicated connection")
+	}
+	if w.statementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.statementTimeout)
+		defer cancel()
+	}
+	_, err := conn.PgConn().CopyFrom(ctx, data, stmt)
+	return err
+}
+
+// openDumpFile opens a dump as stored on disk; a multi-part dump is read
+// through its index as the concatenation of its parts.
+func openDumpFile(path string) (io.ReadCloser, error) {
+	if strings.HasSuffix(path, export.IndexSuffix) {
+		rc, _, err := export.OpenParts(path)
+		return rc, err
+	}
+	return os.Open(path)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (w *Worker) execStatement(ctx context.Context, db execer, stmt string) error {
+	if w.statementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.statementTimeout)
+		defer cancel()
+	}
+	_, err := db.Exec(ctx, stmt)
+	return err
+}
+
 func (w *Worker) handleImport(ctx context.Context, t *asynq.Task) error {
 	var p ImportTaskPayload
 	if err := json.Unmarshal(t.Payload(), &p); err != nil {
 		return err
 	}
+	release, err := w.acquireSlot(ctx, p.JobID)
+	if err != nil {
+		return err
+	}
+	defer release()
 	now := time.Now()
 	w.jobs.Update(p.JobID, func(j *models.Job) {
 		j.Status = models.StatusRunning
 		j.StartedAt = &now
-		j.Progress = 0
+		j.SetProgress(0)
+		j.Warnings = nil
 	})
-	log.Printf("Starting import from %s (%s) into %s (job %s)", p.Source, p.DumpPath, p.Target, p.JobID)
+	w.logRetry(ctx, p.JobID)
+	w.logf(p.JobID, "Starting import from %s (%s) into %s", p.Source, p.DumpPath, p.Target)
 
-	if err := w.performImport(ctx, p.Target, p.JobID, p.DumpPath, p.DumpSize); err != nil {
-		w.jobs.Update(p.JobID, func(j *models.Job) {
-			j.Status = models.StatusFailed
-			j.Error = err.Error()
-		})
-		log.Printf("Import failed for job %s: %v", p.JobID, err)
-		return err
+	ctx, cancel := w.withJobTimeout(ctx, p.JobID)
+	defer cancel()
+	perform := w.performImport
+	if p.Strategy == ImportStrategySwap {
+		perform = w.performSwapImport
+	}
+	if err := perform(ctx, p); err != nil {
+		w.logf(p.JobID, "Import failed: %v", err)
+		return w.failJob(ctx, p.JobID, err)
 	}
 
-	done := time.Now()
 	w.jobs.Update(p.JobID, func(j *models.Job) {
-		j.Status = models.StatusCompleted
-		j.CompletedAt = &done
-		j.Progress = 100
+		j.Complete(time.Now())
 	})
-	log.Printf("Completed import for job %s", p.JobID)
+	w.logf(p.JobID, "Completed import")
 	return nil
 }
 
 func (w *Worker) Start() {
+	atomic.StoreInt64(&w.lastBeat, time.Now().UnixNano())
 	go func() {
 		if err := w.server.Start(w.mux); err != nil {
 			log.Printf("asynq server stopped: %v", err)
 		}
 	}()
+	go w.heartbeat(w.inspector)
 }
 
 func (w *Worker) Shutdown() {
+	close(w.done)
 	w.server.Shutdown()
+	_ = w.inspector.Close()
+	for _, r := range w.reporters {
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+	}
 }
@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/koilabcode/multiboard-sync-service/internal/export"
+	"github.com/koilabcode/multiboard-sync-service/internal/models"
+	"github.com/koilabcode/multiboard-sync-service/internal/sqlscript"
+)
+
+func TestAcquireSlotRequeuesWhenBusy(t *testing.T) {
+	w := &Worker{jobs: models.NewJobStore(), slots: make(chan struct{}, 1), slotWait: 50 * time.Millisecond}
+	ctx := context.Background()
+	release, err := w.acquireSlot(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := w.acquireSlot(ctx, "b"); !errors.Is(err, errSlotBusy) {
+		t.Fatalf("acquireSlot with no free slot = %v, want errSlotBusy", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("acquireSlot waited %v past a slot wait of %v", d, w.slotWait)
+	}
+	task := asynq.NewTask(TypeExport, nil)
+	if d := retryDelay(0, errSlotBusy, task); d != slotRetryDelay {
+		t.Errorf("retryDelay(errSlotBusy) = %v, want %v", d, slotRetryDelay)
+	}
+
+	// A slot freed during the wait is taken.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	w.slotWait = 5 * time.Second
+	release, err = w.acquireSlot(ctx, "b")
+	if err != nil {
+		t.Fatalf("acquireSlot after release = %v", err)
+	}
+	release()
+
+	// Cancellation still ends the wait.
+	w.slots <- struct{}{}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := w.acquireSlot(cctx, "c"); !errors.Is(err, context.Canceled) {
+		t.Errorf("acquireSlot on a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+// cancellingExecer cancels the import while it runs statement number
+// after, which still succeeds.
+type cancellingExecer struct {
+	after  int64
+	cancel context.CancelFunc
+	n      int64
+}
+
+func (e *cancellingExecer) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if atomic.AddInt64(&e.n, 1) == e.after {
+		e.cancel()
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func TestImportStopsWhenCancelled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.sql")
+	const stmts = 100000
+	if err := os.WriteFile(path, []byte(strings.Repeat("INSERT INTO t VALUES (1);\n", stmts)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Worker{jobs: models.NewJobStore()}
+
+	for _, after := range []int64{1, 50} {
+		ctx, cancel := context.WithCancel(context.Background())
+		db := &cancellingExecer{after: after, cancel: cancel}
+		start := time.Now()
+		_, err := w.importInto(ctx, db, "job", path, st.Size(), sqlscript.Remap{}, nil, nil)
+		cancel()
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("importInto cancelled after %d statements = %v, want context.Canceled", after, err)
+		}
+		if n := atomic.LoadInt64(&db.n); n != after {
+			t.Errorf("importInto ran %d statements after being cancelled at %d", n-after, after)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("importInto took %v to stop", d)
+		}
+	}
+}
+
+func TestFailJobWithNoTablesSkipsRetry(t *testing.T) {
+	tests := []struct {
+		err       error
+		wantCode  string
+		wantRetry bool
+	}{
+		{fmt.Errorf("%w for database dev", export.ErrNoTables), models.ErrCodeNoTables, false},
+		{fmt.Errorf("data for t: %w", export.ErrNoTables), models.ErrCodeNoTables, false},
+		{errors.New("connection refused"), "", true},
+	}
+	for _, tt := range tests {
+		w := &Worker{jobs: models.NewJobStore()}
+		if err := w.jobs.Create(&models.Job{ID: "job", Status: models.StatusRunning}); err != nil {
+			t.Fatal(err)
+		}
+		err := w.failJob(context.Background(), "job", tt.err)
+		if retry := !errors.Is(err, asynq.SkipRetry); retry != tt.wantRetry {
+			t.Errorf("failJob(%v) = %v, retried %t, want %t", tt.err, err, retry, tt.wantRetry)
+		}
+		j, _ := w.jobs.Snapshot("job")
+		if j.Status != models.StatusFailed || j.ErrorCode != tt.wantCode || j.Error != tt.err.Error() {
+			t.Errorf("job after failJob(%v) = %s %q %q, want failed %q", tt.err, j.Status, j.ErrorCode, j.Error, tt.wantCode)
+		}
+	}
+}
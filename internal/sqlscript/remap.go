@@ -0,0 +1,330 @@
+package sqlscript
+
+import "strings"
+
+// Remap rewrites the tables a script touches into another schema and/or
+// under a name prefix, so a dump can be loaded next to the data it came
+// from. Relation names are only rewritten where the grammar puts them
+// (CREATE/ALTER/DROP/TRUNCATE TABLE, INSERT INTO, COPY, CREATE INDEX ... ON,
+// triggers, comments, REFERENCES, PARTITION OF, ATTACH/DETACH PARTITION,
+// sequence names and the regclass arguments of nextval/setval); string constants and comments are left untouched.
+// Function bodies are not rewritten.
+type Remap struct {
+	// Schema, if set, replaces the schema of every relation and qualifies
+	// unqualified ones.
+	Schema string `json:"schema,omitempty"`
+	// Prefix is prepended to every table, sequence and index name.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// IsZero reports whether m leaves statements unchanged.
+func (m Remap) IsZero() bool { return m.Schema == "" && m.Prefix == "" }
+
+// Rewrite returns stmt with its relation names remapped.
+func (m Remap) Rewrite(stmt string) string {
+	if m.IsZero() {
+		return stmt
+	}
+	r := &remapper{m: m, toks: Tokenize(stmt)}
+	r.statement()
+	var b strings.Builder
+	b.Grow(len(stmt) + 64)
+	for _, t := range r.toks {
+		b.WriteString(t.Text)
+	}
+	return b.String()
+}
+
+// regclassFuncs take a relation name as their first, string, argument.
+var regclassFuncs = map[string]bool{
+	"nextval": true, "setval": true, "currval": true, "pg_get_serial_sequence": true,
+}
+
+type remapper struct {
+	m    Remap
+	toks []Token
+}
+
+func (r *remapper) statement() {
+	i := r.next(0)
+	for r.word(i) == "begin" {
+		i = r.next(i + 1)
+	}
+	switch r.word(i) {
+	case "create":
+		i = r.skip(i+1, "or", "replace")
+		i = r.skip(i, "unique")
+		i = r.skip(i, "unlogged")
+		i = r.skip(i, "constraint")
+		switch k := r.next(i); r.word(k) {
+		case "table", "sequence":
+			r.relation(r.skip(k+1, "if", "not", "exists"))
+		case "index":
+			j := r.skip(r.skip(k+1, "concurrently"), "if", "not", "exists")
+			if r.word(r.next(j)) != "on" {
+				j = r.index(j, false)
+			}
+			r.relationAfterOn(j)
+		case "trigger":
+			r.relationAfterOn(k + 1)
+		}
+	case "drop":
+		switch k := r.next(i + 1); r.word(k) {
+		case "table", "sequence":
+			r.relation(r.skip(k+1, "if", "exists"))
+		case "index":
+			r.index(r.skip(k+1, "if", "exists"), true)
+		case "trigger":
+			r.relationAfterOn(k + 1)
+		}
+	case "alter":
+		switch k := r.next(i + 1); r.word(k) {
+		case "table", "sequence":
+			r.relation(r.skip(r.skip(k+1, "if", "exists"), "only"))
+		}
+	case "insert":
+		if k := r.next(i + 1); r.word(k) == "into" {
+			r.relation(k + 1)
+		}
+	case "copy":
+		r.relation(i + 1)
+	case "analyze":
+		r.relation(r.skip(i+1, "verbose"))
+	case "truncate":
+		j := r.relation(r.skip(r.skip(i+1, "table"), "only"))
+		for k := r.next(j); k < len(r.toks) && r.toks[k].Text == ","; k = r.next(j) {
+			j = r.relation(r.skip(k+1, "only"))
+		}
+	case "comment":
+		k := r.next(r.skip(i+1, "on"))
+		switch r.word(k) {
+		case "table", "sequence":
+			r.relation(k + 1)
+		case "column":
+			r.column(k + 1)
+		case "index":
+			r.index(k+1, true)
+		}
+	case "do":
+		if k := r.next(i + 1); k < len(r.toks) && r.toks[k].Kind == TokenString {
+			r.block(k)
+		}
+	}
+
+	for k := range r.toks {
+		switch w := r.word(k); {
+		case w == "references":
+			r.relation(k + 1)
+		case w == "partition":
+			// PARTITION OF names the parent; PARTITION BY is left alone.
+			if j := r.next(k + 1); r.word(j) == "of" {
+				r.relation(j + 1)
+			}
+		case w == "attach" || w == "detach":
+			if j := r.next(k + 1); r.word(j) == "partition" {
+				r.relation(j + 1)
+			}
+		case w == "owned":
+			if j := r.next(k + 1); r.word(j) == "by" && r.word(r.next(j+1)) != "none" {
+				r.column(j + 1)
+			}
+		case regclassFuncs[w]:
+			if j := r.next(k + 1); j < len(r.toks) && r.toks[j].Text == "(" {
+				r.regclass(r.next(j + 1))
+			}
+		}
+	}
+}
+
+// next returns the index of the first non-space token at or after i.
+func (r *remapper) next(i int) int {
+	for i < len(r.toks) && r.toks[i].Kind == TokenSpace {
+		i++
+	}
+	return i
+}
+
+// word returns the lower-cased keyword at i, or "" if i is not a word.
+func (r *remapper) word(i int) string {
+	if i >= len(r.toks) || r.toks[i].Kind != TokenWord {
+		return ""
+	}
+	return strings.ToLower(r.toks[i].Text)
+}
+
+// skip consumes words if they all follow i, returning the index after
+// them; otherwise it returns i.
+func (r *remapper) skip(i int, words ...string) int {
+	j := i
+	for _, w := range words {
+		k := r.next(j)
+		if r.word(k) != w {
+			return i
+		}
+		j = k + 1
+	}
+	return j
+}
+
+// name parses a dotted name starting at or after i and returns the indices
+// of its identifier tokens.
+func (r *remapper) name(i int) []int {
+	var parts []int
+	for {
+		k := r.next(i)
+		if k >= len(r.toks) || (r.toks[k].Kind != TokenWord && r.toks[k].Kind != TokenQuotedIdent) {
+			return parts
+		}
+		parts = append(parts, k)
+		i = k + 1
+		if d := r.next(i); d < len(r.toks) && r.toks[d].Text == "." {
+			i = d + 1
+			continue
+		}
+		return parts
+	}
+}
+
+// replace swaps the tokens spanning parts for text.
+func (r *remapper) replace(parts []int, text string) {
+	first, last := parts[0], parts[len(parts)-1]
+	r.toks[first].Text = text
+	for k := first + 1; k <= last; k++ {
+		r.toks[k].Text = ""
+	}
+}
+
+func (r *remapper) values(parts []int) []string {
+	out := make([]string, len(parts))
+	for i, p := range parts {
+		out[i] = identValue(r.toks[p])
+	}
+	return out
+}
+
+// relation remaps the relation name at i and returns the index after it.
+func (r *remapper) relation(i int) int {
+	parts := r.name(i)
+	if len(parts) == 0 || len(parts) > 3 {
+		return i
+	}
+	r.replace(parts, r.m.relation(r.values(parts)))
+	return parts[len(parts)-1] + 1
+}
+
+// column remaps the relation of a table.column reference at i.
+func (r *remapper) column(i int) {
+	parts := r.name(i)
+	if len(parts) < 2 || len(parts) > 4 {
+		return
+	}
+	rel := parts[:len(parts)-1]
+	r.replace(rel, r.m.relation(r.values(rel)))
+}
+
+// index prefixes the index name at i. CREATE INDEX does not allow a
+// qualified name, so qualify is false there.
+func (r *remapper) index(i int, qualify bool) int {
+	parts := r.name(i)
+	if len(parts) == 0 || len(parts) > 2 {
+		return i
+	}
+	names := r.values(parts)
+	if !qualify && len(names) == 1 {
+		r.replace(parts, quoteIdent(r.m.Prefix+names[0]))
+	} else {
+		r.replace(parts, r.m.relation(names))
+	}
+	return parts[len(parts)-1] + 1
+}
+
+// relationAfterOn remaps the relation following the first ON after i.
+func (r *remapper) relationAfterOn(i int) {
+	for k := i; k < len(r.toks); k++ {
+		if r.word(k) == "on" {
+			r.relation(r.skip(k+1, "only"))
+			return
+		}
+	}
+}
+
+// regclass remaps a relation name given as a '...' string constant.
+func (r *remapper) regclass(i int) {
+	if i >= len(r.toks) || !strings.HasPrefix(r.toks[i].Text, "'") {
+		return
+	}
+	t := r.toks[i].Text
+	if len(t) < 2 || t[len(t)-1] != '\'' {
+		return
+	}
+	names, ok := parseQualified(strings.ReplaceAll(t[1:len(t)-1], "''", "'"))
+	if !ok || len(names) > 3 {
+		return
+	}
+	r.toks[i].Text = "'" + strings.ReplaceAll(r.m.relation(names), "'", "''") + "'"
+}
+
+// block rewrites the statements inside the dollar-quoted body of a DO.
+func (r *remapper) block(i int) {
+	t := r.toks[i].Text
+	n := dollarTagLen(t)
+	if n == 0 || len(t) < 2*n {
+		return
+	}
+	var b strings.Builder
+	body := t[n : len(t)-n]
+	inner := Tokenize(body)
+	from, pos := 0, 0
+	for k, tok := range inner {
+		pos += len(tok.Text)
+		if (tok.Kind == TokenOther && tok.Text == ";") || k == len(inner)-1 {
+			b.WriteString(r.m.Rewrite(body[from:pos]))
+			from = pos
+		}
+	}
+	r.toks[i].Text = t[:n] + b.String() + t[len(t)-n:]
+}
+
+// relation renders a remapped relation from its name parts.
+func (m Remap) relation(names []string) string {
+	var schema string
+	if len(names) > 1 {
+		schema = names[len(names)-2]
+	}
+	if m.Schema != "" {
+		schema = m.Schema
+	}
+	name := quoteIdent(m.Prefix + names[len(names)-1])
+	if schema == "" {
+		return name
+	}
+	return quoteIdent(schema) + "." + name
+}
+
+// identValue returns the name an identifier token denotes: quoted
+// identifiers verbatim, unquoted ones folded to lower case.
+func identValue(t Token) string {
+	if t.Kind == TokenQuotedIdent && len(t.Text) >= 2 {
+		return strings.ReplaceAll(t.Text[1:len(t.Text)-1], `""`, `"`)
+	}
+	return strings.ToLower(t.Text)
+}
+
+// parseQualified splits a textual relation name such as public."Foo".
+func parseQualified(s string) ([]string, bool) {
+	var names []string
+	for _, t := range Tokenize(strings.TrimSpace(s)) {
+		switch {
+		case t.Kind == TokenWord || t.Kind == TokenQuotedIdent:
+			names = append(names, identValue(t))
+		case t.Kind == TokenOther && t.Text == ".":
+		default:
+			return nil, false
+		}
+	}
+	return names, len(names) > 0
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,88 @@
+package sqlscript
+
+import "testing"
+
+func TestRemapRewrite(t *testing.T) {
+	schema := Remap{Schema: "x"}
+	both := Remap{Schema: "x", Prefix: "p_"}
+	tests := []struct {
+		name string
+		m    Remap
+		stmt string
+		want string
+	}{
+		{
+			name: "zero remap",
+			m:    Remap{},
+			stmt: `CREATE TABLE "t" (a int);`,
+			want: `CREATE TABLE "t" (a int);`,
+		},
+		{
+			name: "create table",
+			m:    both,
+			stmt: `CREATE TABLE IF NOT EXISTS public."T" (a int REFERENCES "u"(id));`,
+			want: `CREATE TABLE IF NOT EXISTS "x"."p_T" (a int REFERENCES "x"."p_u"(id));`,
+		},
+		{
+			name: "insert leaves strings alone",
+			m:    schema,
+			stmt: `INSERT INTO "t" (a) VALUES ('INSERT INTO t');`,
+			want: `INSERT INTO "x"."t" (a) VALUES ('INSERT INTO t');`,
+		},
+		{
+			name: "create index",
+			m:    both,
+			stmt: `CREATE UNIQUE INDEX "t_a" ON public."t" USING btree (a);`,
+			want: `CREATE UNIQUE INDEX "p_t_a" ON "x"."p_t" USING btree (a);`,
+		},
+		{
+			name: "sequence default",
+			m:    both,
+			stmt: `ALTER TABLE ONLY "t" ALTER COLUMN id SET DEFAULT nextval('public.t_id_seq'::regclass);`,
+			want: `ALTER TABLE ONLY "x"."p_t" ALTER COLUMN id SET DEFAULT nextval('"x"."p_t_id_seq"'::regclass);`,
+		},
+		{
+			name: "partitioned parent",
+			m:    schema,
+			stmt: `CREATE TABLE "parent" (a int, d date) PARTITION BY RANGE (d);`,
+			want: `CREATE TABLE "x"."parent" (a int, d date) PARTITION BY RANGE (d);`,
+		},
+		{
+			name: "partition of",
+			m:    schema,
+			stmt: `CREATE TABLE "x"."p1" PARTITION OF "parent" FOR VALUES FROM ('2024-01-01') TO ('2024-02-01');`,
+			want: `CREATE TABLE "x"."p1" PARTITION OF "x"."parent" FOR VALUES FROM ('2024-01-01') TO ('2024-02-01');`,
+		},
+		{
+			name: "sub-partitioned partition of",
+			m:    both,
+			stmt: `CREATE TABLE IF NOT EXISTS "p1" PARTITION OF public."parent" DEFAULT PARTITION BY LIST (a);`,
+			want: `CREATE TABLE IF NOT EXISTS "x"."p_p1" PARTITION OF "x"."p_parent" DEFAULT PARTITION BY LIST (a);`,
+		},
+		{
+			name: "attach partition",
+			m:    both,
+			stmt: `ALTER TABLE "parent" ATTACH PARTITION public."p1" FOR VALUES IN (1);`,
+			want: `ALTER TABLE "x"."p_parent" ATTACH PARTITION "x"."p_p1" FOR VALUES IN (1);`,
+		},
+		{
+			name: "detach partition",
+			m:    schema,
+			stmt: `ALTER TABLE parent DETACH PARTITION p1;`,
+			want: `ALTER TABLE "x"."parent" DETACH PARTITION "x"."p1";`,
+		},
+		{
+			name: "window partition by untouched",
+			m:    schema,
+			stmt: `SELECT rank() OVER (PARTITION BY a) FROM "t";`,
+			want: `SELECT rank() OVER (PARTITION BY a) FROM "t";`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.m.Rewrite(tt.stmt); got != tt.want {
+				t.Errorf("Rewrite(%q)\n got %q\nwant %q", tt.stmt, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+// Package sqlscript splits SQL scripts into individual statements.
+package sqlscript
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const maxDollarTag = 64
+
+// Scanner reads statements from a SQL script one at a time. Semicolons only
+// end a statement outside of single-quoted strings (including E'...' strings
+// with backslash escapes), double-quoted identifiers, dollar-quoted bodies
+// and comments. Comments are dropped from the returned statements; a
+// trailing statement without a semicolon is still returned.
+//
+// Plain-format pg_dump output is understood as well: psql meta-commands such
+// as \connect are skipped, and the data of a COPY ... FROM stdin statement
+// is exposed through CopyData rather than parsed as SQL.
+//
+// Usage mirrors bufio.Scanner:
+//
+//	sc := sqlscript.NewScanner(r)
+//	for sc.Scan() {
+//		exec(sc.Statement())
+//	}
+//	if err := sc.Err(); err != nil { ... }
+type Scanner struct {
+	r    *bufio.Reader
+	n    int64
+	buf  []byte
+	stmt string
+	err  error
+	done bool
+	copy *copyReader
+}
+
+var copyFromStdinRe = regexp.MustCompile(`(?is)^COPY\s.*\sFROM\s+stdin\b`)
+
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: bufio.NewReaderSize(r, 256*1024)}
+}
+
+// Statement returns the most recent statement found by Scan, including its
+// terminating semicolon when present.
+func (s *Scanner) Statement() string { return s.stmt }
+
+// CopyData returns the inline data of the current statement when it is a
+// COPY ... FROM stdin, up to but excluding the terminating \. line. It
+// returns nil for any other statement. The reader is only valid until the
+// next call to Scan; unread data is skipped.
+func (s *Scanner) CopyData() io.Reader {
+	if s.copy == nil {
+		return nil
+	}
+	return s.copy
+}
+
+// Err returns the first non-EOF error encountered by the Scanner.
+func (s *Scanner) Err() error { return s.err }
+
+// BytesRead returns the number of script bytes consumed so far.
+func (s *Scanner) BytesRead() int64 { return s.n }
+
+// Scan advances to the next non-empty statement. It returns false at the end
+// of the script or on error.
+func (s *Scanner) Scan() bool {
+	s.stmt = ""
+	if s.copy != nil {
+		if _, err := io.Copy(io.Discard, s.copy); err != nil {
+			s.err = err
+			return false
+		}
+		s.copy = nil
+	}
+	for !s.done && s.err == nil {
+		s.buf = s.buf[:0]
+		if err := s.scanStatement(); err != nil {
+			if err != io.EOF {
+				s.err = err
+				return false
+			}
+			s.done = true
+		}
+		if stmt := strings.TrimSpace(string(s.buf)); stmt != "" && stmt != ";" {
+			s.stmt = stmt
+			if copyFromStdinRe.MatchString(stmt) {
+				// The data starts on the line after the statement.
+				if err := s.skipLineComment(); err != nil && err != io.EOF {
+					s.err = err
+					return false
+				}
+				s.copy = &copyReader{s: s, atStart: true}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// scanStatement fills s.buf up to and including the next top-level ';'.
+// io.EOF is returned when the script ends first.
+func (s *Scanner) scanStatement() error {
+	for {
+		c, err := s.readByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == ';':
+			s.buf = append(s.buf, c)
+			return nil
+		case c == '\'':
+			escapes := s.prevIsEscapePrefix()
+			s.buf = append(s.buf, c)
+			if err := s.readQuoted('\'', escapes); err != nil {
+				return err
+			}
+		case c == '"':
+			s.buf = append(s.buf, c)
+			if err := s.readQuoted('"', false); err != nil {
+				return err
+			}
+		case c == '-' && s.peekIs('-'):
+			if err := s.skipLineComment(); err != nil {
+				return err
+			}
+			s.buf = append(s.buf, '\n')
+		case c == '/' && s.peekIs('*'):
+			if err := s.skipBlockComment(); err != nil {
+				return err
+			}
+			s.buf = append(s.buf, ' ')
+		case c == '\\' && len(bytes.TrimSpace(s.buf)) == 0:
+			// psql meta-command (\connect, \restrict, ...): not SQL.
+			if err := s.skipLineComment(); err != nil {
+				return err
+			}
+		case c == '$' && !s.prevIsIdent():
+			s.buf = append(s.buf, c)
+			if err := s.readDollarQuoted(); err != nil {
+				return err
+			}
+		default:
+			s.buf = append(s.buf, c)
+		}
+	}
+}
+
+func (s *Scanner) readByte() (byte, error) {
+	c, err := s.r.ReadByte()
+	if err == nil {
+		s.n++
+	}
+	return c, err
+}
+
+func (s *Scanner) peekIs(want byte) bool {
+	b, err := s.r.Peek(1)
+	return err == nil && b[0] == want
+}
+
+func (s *Scanner) prevIsIdent() bool {
+	return len(s.buf) > 0 && isIdent(s.buf[len(s.buf)-1])
+}
+
+// prevIsEscapePrefix reports whether the quote about to be read opens an
+// E'...' string, in which backslash escapes the next character.
+func (s *Scanner) prevIsEscapePrefix() bool {
+	n := len(s.buf)
+	if n == 0 || (s.buf[n-1] != 'E' && s.buf[n-1] != 'e') {
+		return false
+	}
+	return n == 1 || !isIdent(s.buf[n-2])
+}
+
+func (s *Scanner) readQuoted(quote byte, escapes bool) error {
+	for {
+		c, err := s.readByte()
+		if err != nil {
+			return unterminated(err, "quoted string")
+		}
+		s.buf = append(s.buf, c)
+		if escapes && c == '\\' {
+			c, err = s.readByte()
+			if err != nil {
+				return unterminated(err, "quoted string")
+			}
+			s.buf = append(s.buf, c)
+			continue
+		}
+		// A doubled quote is an escaped quote; it closes and immediately
+		// reopens, so treating each quote as a toggle is correct.
+		if c == quote {
+			if s.peekIs(quote) {
+				c, _ = s.readByte()
+				s.buf = append(s.buf, c)
+				continue
+			}
+			return nil
+		}
+	}
+}
+
+// readDollarQuoted is called after a '$' that may open a $tag$ body. If the
+// following bytes do not form a tag, the '$' is left as an ordinary byte
+// (e.g. a $1 parameter).
+func (s *Scanner) readDollarQuoted() error {
+	tagLen := -1
+	for i := 1; i <= maxDollarTag+1; i++ {
+		b, err := s.r.Peek(i)
+		if err != nil {
+			return nil
+		}
+		c := b[i-1]
+		if c == '$' {
+			tagLen = i - 1
+			break
+		}
+		if !isIdent(c) || c == '$' || (i == 1 && c >= '0' && c <= '9') {
+			return nil
+		}
+	}
+	if tagLen < 0 {
+		return nil
+	}
+	start := len(s.buf) - 1
+	for i := 0; i <= tagLen; i++ {
+		c, _ := s.readByte()
+		s.buf = append(s.buf, c)
+	}
+	delim := append([]byte(nil), s.buf[start:]...)
+	bodyStart := len(s.buf)
+	for {
+		c, err := s.readByte()
+		if err != nil {
+			return unterminated(err, "dollar-quoted string")
+		}
+		s.buf = append(s.buf, c)
+		if c == '$' && len(s.buf)-bodyStart >= len(delim) && bytes.HasSuffix(s.buf, delim) {
+			return nil
+		}
+	}
+}
+
+func (s *Scanner) skipLineComment() error {
+	for {
+		c, err := s.readByte()
+		if err != nil {
+			return err
+		}
+		if c == '\n' {
+			return nil
+		}
+	}
+}
+
+// skipBlockComment consumes a /* */ comment; like Postgres, nested comments
+// are supported.
+func (s *Scanner) skipBlockComment() error {
+	s.readByte()
+	depth := 1
+	for depth > 0 {
+		c, err := s.readByte()
+		if err != nil {
+			return unterminated(err, "block comment")
+		}
+		switch {
+		case c == '/' && s.peekIs('*'):
+			s.readByte()
+			depth++
+		case c == '*' && s.peekIs('/'):
+			s.readByte()
+			depth--
+		}
+	}
+	return nil
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func unterminated(err error, what string) error {
+	if err == io.EOF {
+		return errors.New("sqlscript: unterminated " + what + " at end of script")
+	}
+	return err
+}
+
+// copyReader streams COPY data lines straight from the underlying reader.
+type copyReader struct {
+	s       *Scanner
+	pending []byte
+	atStart bool
+	done    bool
+	err     error
+}
+
+func (c *copyReader) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		if c.done {
+			return 0, io.EOF
+		}
+		line, err := c.s.r.ReadSlice('\n')
+		c.s.n += int64(len(line))
+		if c.atStart && isCopyEnd(line) {
+			c.done = true
+			return 0, io.EOF
+		}
+		c.atStart = len(line) > 0 && line[len(line)-1] == '\n'
+		switch err {
+		case nil, bufio.ErrBufferFull:
+		case io.EOF:
+			c.err = errors.New("sqlscript: unterminated COPY data at end of script")
+		default:
+			c.err = err
+		}
+		c.pending = line
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func isCopyEnd(line []byte) bool {
+	return string(bytes.TrimRight(line, "\r\n")) == `\.`
+}
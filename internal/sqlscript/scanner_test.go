@@ -0,0 +1,163 @@
+package sqlscript
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func scanAll(t *testing.T, script string) []string {
+	t.Helper()
+	var out []string
+	sc := NewScanner(strings.NewReader(script))
+	for sc.Scan() {
+		out = append(out, sc.Statement())
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	return out
+}
+
+func TestScannerSplitsOnTopLevelSemicolons(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "plain",
+			script: "SELECT 1;\nSELECT 2;\n",
+			want:   []string{"SELECT 1;", "SELECT 2;"},
+		},
+		{
+			name:   "semicolon in string",
+			script: "INSERT INTO t VALUES ('a;b', 'it''s; fine');\nSELECT 2;",
+			want:   []string{"INSERT INTO t VALUES ('a;b', 'it''s; fine');", "SELECT 2;"},
+		},
+		{
+			name:   "line ending in semicolon inside string",
+			script: "INSERT INTO t VALUES ('x;\nDROP TABLE t;\n');\n",
+			want:   []string{"INSERT INTO t VALUES ('x;\nDROP TABLE t;\n');"},
+		},
+		{
+			name:   "escape string",
+			script: `INSERT INTO t VALUES (E'a\';b');SELECT 2;`,
+			want:   []string{`INSERT INTO t VALUES (E'a\';b');`, "SELECT 2;"},
+		},
+		{
+			name:   "quoted identifier",
+			script: `CREATE TABLE "a;b" (x int);SELECT 2;`,
+			want:   []string{`CREATE TABLE "a;b" (x int);`, "SELECT 2;"},
+		},
+		{
+			name: "dollar-quoted function body",
+			script: `CREATE FUNCTION f() RETURNS trigger AS $$
+BEGIN
+  NEW.x := 1;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+SELECT 2;`,
+			want: []string{"CREATE FUNCTION f() RETURNS trigger AS $$\nBEGIN\n  NEW.x := 1;\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql;", "SELECT 2;"},
+		},
+		{
+			name:   "tagged dollar quote containing $$",
+			script: "SELECT $body$ a $$; b $body$;SELECT 2;",
+			want:   []string{"SELECT $body$ a $$; b $body$;", "SELECT 2;"},
+		},
+		{
+			name:   "positional parameter is not a dollar quote",
+			script: "PREPARE p AS SELECT $1;SELECT 2;",
+			want:   []string{"PREPARE p AS SELECT $1;", "SELECT 2;"},
+		},
+		{
+			name:   "comments",
+			script: "-- a; comment\nSELECT 1; /* b; */ SELECT 2;\n-- trailing",
+			want:   []string{"SELECT 1;", "SELECT 2;"},
+		},
+		{
+			name:   "empty statements",
+			script: ";;\nSELECT 1;;",
+			want:   []string{"SELECT 1;"},
+		},
+		{
+			name:   "no final semicolon",
+			script: "SELECT 1;\nSELECT 2",
+			want:   []string{"SELECT 1;", "SELECT 2"},
+		},
+		{
+			name:   "psql meta-command",
+			script: "\\connect db\nSELECT 1;",
+			want:   []string{"SELECT 1;"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scanAll(t, tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScannerCopyData(t *testing.T) {
+	script := "COPY t (a) FROM stdin;\nx;y\n\\.\nSELECT 1;\nCOPY t (a) FROM stdin;\nunread\n\\.\nSELECT 2;\n"
+	sc := NewScanner(strings.NewReader(script))
+	var stmts, data []string
+	for sc.Scan() {
+		stmts = append(stmts, sc.Statement())
+		if r := sc.CopyData(); r != nil && len(data) == 0 {
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = append(data, string(b))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"COPY t (a) FROM stdin;", "SELECT 1;", "COPY t (a) FROM stdin;", "SELECT 2;"}
+	if !reflect.DeepEqual(stmts, want) {
+		t.Errorf("statements = %q, want %q", stmts, want)
+	}
+	if !reflect.DeepEqual(data, []string{"x;y\n"}) {
+		t.Errorf("copy data = %q, want %q", data, []string{"x;y\n"})
+	}
+}
+
+func TestScannerUnterminated(t *testing.T) {
+	for _, script := range []string{"SELECT 'abc;", `SELECT "abc;`, "SELECT $$abc;", "SELECT /* abc;"} {
+		sc := NewScanner(strings.NewReader(script))
+		for sc.Scan() {
+		}
+		if sc.Err() == nil {
+			t.Errorf("%q: no error for unterminated input", script)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	stmt := `INSERT INTO "Part" (a) VALUES ('x;"y', E'\'', $t$ "z" $t$) -- c` + "\n/* d */;"
+	toks := Tokenize(stmt)
+	var b strings.Builder
+	var kinds []TokenKind
+	for _, tok := range toks {
+		b.WriteString(tok.Text)
+		if tok.Kind != TokenSpace {
+			kinds = append(kinds, tok.Kind)
+		}
+	}
+	if b.String() != stmt {
+		t.Errorf("tokens reassemble to %q, want %q", b.String(), stmt)
+	}
+	want := []TokenKind{
+		TokenWord, TokenWord, TokenQuotedIdent, TokenOther, TokenWord, TokenOther, TokenWord, TokenOther,
+		TokenString, TokenOther, TokenString, TokenOther, TokenString, TokenOther, TokenOther,
+	}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("kinds = %v, want %v", kinds, want)
+	}
+}
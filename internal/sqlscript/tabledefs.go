@@ -0,0 +1,203 @@
+package sqlscript
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ColumnDef is a column as declared in a CREATE TABLE statement.
+type ColumnDef struct {
+	Name string
+	Type string
+}
+
+// TableDef is a table created by a script. Dropped is set when the script
+// drops the table first, so whatever the target has is replaced.
+type TableDef struct {
+	Schema  string
+	Name    string
+	Columns []ColumnDef
+	Dropped bool
+}
+
+// TableDefs collects the CREATE TABLE statements of a script from the
+// statements fed to Add. Partitions and other tables without a column list
+// are skipped.
+type TableDefs struct {
+	Tables  []TableDef
+	dropped map[string]bool
+}
+
+// Add records stmt if it creates or drops a table.
+func (d *TableDefs) Add(stmt string) {
+	r := &remapper{toks: Tokenize(stmt)}
+	i := r.next(0)
+	switch r.word(i) {
+	case "drop":
+		k := r.next(i + 1)
+		if r.word(k) != "table" {
+			return
+		}
+		if d.dropped == nil {
+			d.dropped = make(map[string]bool)
+		}
+		for _, name := range r.names(r.skip(k+1, "if", "exists")) {
+			d.dropped[name] = true
+		}
+	case "create":
+		k := r.next(r.skip(i+1, "unlogged"))
+		if r.word(k) != "table" {
+			return
+		}
+		parts := r.name(r.skip(k+1, "if", "not", "exists"))
+		if len(parts) == 0 || len(parts) > 3 {
+			return
+		}
+		open := r.next(parts[len(parts)-1] + 1)
+		if open >= len(r.toks) || r.toks[open].Text != "(" {
+			return
+		}
+		names := r.values(parts)
+		t := TableDef{Name: names[len(names)-1], Columns: r.columns(open + 1)}
+		if len(names) > 1 {
+			t.Schema = names[len(names)-2]
+		}
+		t.Dropped = d.dropped[qualified(t.Schema, t.Name)]
+		d.Tables = append(d.Tables, t)
+	}
+}
+
+// names parses a comma-separated list of relation names at i.
+func (r *remapper) names(i int) []string {
+	var out []string
+	for {
+		parts := r.name(i)
+		if len(parts) == 0 {
+			return out
+		}
+		names := r.values(parts)
+		schema := ""
+		if len(names) > 1 {
+			schema = names[len(names)-2]
+		}
+		out = append(out, qualified(schema, names[len(names)-1]))
+		k := r.next(parts[len(parts)-1] + 1)
+		if k >= len(r.toks) || r.toks[k].Text != "," {
+			return out
+		}
+		i = k + 1
+	}
+}
+
+func qualified(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+	return schema + "." + name
+}
+
+// tableConstraints start a table element that is not a column.
+var tableConstraints = map[string]bool{
+	"constraint": true, "primary": true, "unique": true, "check": true,
+	"foreign": true, "exclude": true, "like": true,
+}
+
+// typeEnd are the words that end a column's type.
+var typeEnd = map[string]bool{
+	"not": true, "null": true, "default": true, "generated": true, "constraint": true,
+	"primary": true, "unique": true, "check": true, "references": true, "collate": true,
+}
+
+// columns parses the column definitions of a table element list starting
+// after its opening parenthesis.
+func (r *remapper) columns(i int) []ColumnDef {
+	var out []ColumnDef
+	for i < len(r.toks) {
+		start := r.next(i)
+		if start >= len(r.toks) || r.toks[start].Text == ")" {
+			return out
+		}
+		// Find the end of this element and the end of the column's type.
+		depth, typeStop, end := 0, -1, start
+		for end = start + 1; end < len(r.toks); end++ {
+			t := r.toks[end].Text
+			if depth == 0 && (t == "," || t == ")") {
+				break
+			}
+			switch t {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				depth--
+			}
+			if depth == 0 && typeStop < 0 && typeEnd[r.word(end)] {
+				typeStop = end
+			}
+		}
+		if typeStop < 0 {
+			typeStop = end
+		}
+		if first := r.toks[start]; !(first.Kind == TokenWord && tableConstraints[strings.ToLower(first.Text)]) &&
+			(first.Kind == TokenWord || first.Kind == TokenQuotedIdent) {
+			var typ strings.Builder
+			for k := start + 1; k < typeStop; k++ {
+				typ.WriteString(r.toks[k].Text)
+			}
+			out = append(out, ColumnDef{Name: identValue(first), Type: strings.Join(strings.Fields(typ.String()), " ")})
+		}
+		if end >= len(r.toks) || r.toks[end].Text == ")" {
+			return out
+		}
+		i = end + 1
+	}
+	return out
+}
+
+var typeRe = regexp.MustCompile(`^(.*?)\s*(\([^)]*\))?\s*(with time zone|without time zone)?$`)
+
+var typeSynonyms = map[string]string{
+	"int":         "integer",
+	"int4":        "integer",
+	"int8":        "bigint",
+	"int2":        "smallint",
+	"float8":      "double precision",
+	"float4":      "real",
+	"bool":        "boolean",
+	"varchar":     "character varying",
+	"bpchar":      "character",
+	"char":        "character",
+	"decimal":     "numeric",
+	"timestamptz": "timestamp with time zone",
+	"timetz":      "time with time zone",
+	"timestamp":   "timestamp without time zone",
+	"time":        "time without time zone",
+	"varbit":      "bit varying",
+}
+
+// NormalizeType reduces a column type to a canonical spelling so that the
+// same type written by different tools compares equal: synonyms are
+// resolved, quoting, case and schema qualification are dropped, and the
+// type modifier is returned separately because not every tool keeps it.
+func NormalizeType(typ string) (base, modifier string) {
+	t := strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(typ, `"`, "")), " "))
+	array := ""
+	for strings.HasSuffix(t, "[]") {
+		array += "[]"
+		t = strings.TrimSpace(strings.TrimSuffix(t, "[]"))
+	}
+	m := typeRe.FindStringSubmatch(t)
+	if m == nil {
+		return t + array, ""
+	}
+	base, modifier = m[1], strings.ReplaceAll(m[2], " ", "")
+	if i := strings.LastIndexByte(base, '.'); i >= 0 {
+		base = base[i+1:]
+	}
+	if s, ok := typeSynonyms[base]; ok {
+		base = s
+	}
+	if m[3] != "" {
+		base = strings.TrimSuffix(strings.TrimSuffix(base, " without time zone"), " with time zone") + " " + m[3]
+	}
+	return base + array, modifier
+}
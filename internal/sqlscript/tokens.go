@@ -0,0 +1,133 @@
+package sqlscript
+
+import "strings"
+
+// TokenKind classifies a lexical token of a single SQL statement.
+type TokenKind int
+
+const (
+	// TokenSpace is whitespace or a comment.
+	TokenSpace TokenKind = iota
+	// TokenWord is an unquoted identifier or keyword.
+	TokenWord
+	// TokenQuotedIdent is a double-quoted identifier.
+	TokenQuotedIdent
+	// TokenString is a string constant: '...', E'...' or dollar-quoted.
+	TokenString
+	// TokenOther is anything else: numbers, operators and punctuation.
+	TokenOther
+)
+
+// Token is a lexical token. Concatenating the Text of every token returned
+// by Tokenize reproduces the input exactly.
+type Token struct {
+	Kind TokenKind
+	Text string
+}
+
+// Tokenize splits one SQL statement into tokens with the same quoting rules
+// the Scanner uses, so string constants and comments are never mistaken
+// for identifiers. Unterminated constructs run to the end of the input.
+func Tokenize(stmt string) []Token {
+	var toks []Token
+	for i := 0; i < len(stmt); {
+		start := i
+		c := stmt[i]
+		var kind TokenKind
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			kind = TokenSpace
+			for i < len(stmt) && strings.IndexByte(" \t\n\r\f", stmt[i]) >= 0 {
+				i++
+			}
+		case c == '-' && strings.HasPrefix(stmt[i:], "--"):
+			kind = TokenSpace
+			if n := strings.IndexByte(stmt[i:], '\n'); n >= 0 {
+				i += n + 1
+			} else {
+				i = len(stmt)
+			}
+		case c == '/' && strings.HasPrefix(stmt[i:], "/*"):
+			kind = TokenSpace
+			i = skipBlock(stmt, i)
+		case c == '\'':
+			kind = TokenString
+			i = skipQuoted(stmt, i, '\'', false)
+		case (c == 'E' || c == 'e') && i+1 < len(stmt) && stmt[i+1] == '\'':
+			kind = TokenString
+			i = skipQuoted(stmt, i+1, '\'', true)
+		case c == '"':
+			kind = TokenQuotedIdent
+			i = skipQuoted(stmt, i, '"', false)
+		case c == '$' && dollarTagLen(stmt[i:]) > 0:
+			kind = TokenString
+			delim := stmt[i : i+dollarTagLen(stmt[i:])]
+			if n := strings.Index(stmt[i+len(delim):], delim); n >= 0 {
+				i += len(delim) + n + len(delim)
+			} else {
+				i = len(stmt)
+			}
+		case isIdent(c) && c != '$' && !(c >= '0' && c <= '9'):
+			kind = TokenWord
+			for i < len(stmt) && isIdent(stmt[i]) {
+				i++
+			}
+		default:
+			kind = TokenOther
+			i++
+		}
+		toks = append(toks, Token{Kind: kind, Text: stmt[start:i]})
+	}
+	return toks
+}
+
+// dollarTagLen returns the length of the $tag$ delimiter at the start of s,
+// or 0 if s does not start with one.
+func dollarTagLen(s string) int {
+	for i := 1; i < len(s) && i <= maxDollarTag+1; i++ {
+		c := s[i]
+		if c == '$' {
+			return i + 1
+		}
+		if !isIdent(c) || (i == 1 && c >= '0' && c <= '9') {
+			return 0
+		}
+	}
+	return 0
+}
+
+func skipQuoted(s string, i int, quote byte, escapes bool) int {
+	for i++; i < len(s); i++ {
+		switch {
+		case escapes && s[i] == '\\':
+			i++
+		case s[i] == quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func skipBlock(s string, i int) int {
+	depth := 0
+	for i < len(s) {
+		switch {
+		case strings.HasPrefix(s[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(s[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(s)
+}
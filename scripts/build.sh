@@ -8,6 +8,7 @@ mkdir -p "$BIN_DIR"
 pushd "$REPO_ROOT" >/dev/null
 go mod tidy
 GOOS=linux GOARCH=amd64 go build -o "$BIN_DIR/multiboard-sync-service" ./cmd/server
+GOOS=linux GOARCH=amd64 go build -o "$BIN_DIR/multiboard" ./cmd/multiboard
 popd >/dev/null
 
-echo "Built: $BIN_DIR/multiboard-sync-service"
+echo "Built: $BIN_DIR/multiboard-sync-service $BIN_DIR/multiboard"